@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ansiPalette is the 16-colour palette used for SGR 30–37, 90–97 and the
+// first 16 entries of the 256-colour table.
+var ansiPalette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// ansiStyle is the SGR state in effect for a run of text. Colours are CSS
+// "#rrggbb" values; empty means the terminal default.
+type ansiStyle struct {
+	FG        string `json:"fg,omitempty"`
+	BG        string `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Dim       bool   `json:"dim,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	Inverse   bool   `json:"inverse,omitempty"`
+	Strike    bool   `json:"strike,omitempty"`
+}
+
+// ansiSpan is a run of text with one style.
+type ansiSpan struct {
+	Text string `json:"text"`
+	ansiStyle
+}
+
+// ansiLine holds the styled spans of one line of a response's content,
+// addressed by its 0-based index among the content's lines.
+type ansiLine struct {
+	Line  int        `json:"line"`
+	Spans []ansiSpan `json:"spans"`
+}
+
+// parseANSIMode reads the ansi parameter: "" (or raw) leaves escapes
+// alone, strip removes them and spans parses them into styled spans.
+func parseANSIMode(params url.Values) (string, error) {
+	switch mode := params.Get("ansi"); mode {
+	case "", "raw":
+		return "", nil
+	case "strip", "spans":
+		return mode, nil
+	default:
+		return "", errors.New("invalid ansi mode")
+	}
+}
+
+// applyANSIMode prepares log content for an ansi mode. strip returns the
+// text without escapes. spans keeps the content byte-exact, so offsets and
+// entry starts still add up, and describes every line that has escapes.
+func applyANSIMode(mode string, content []byte) ([]byte, []ansiLine) {
+	switch mode {
+	case "strip":
+		return stripANSI(content), nil
+	case "spans":
+		return content, ansiLines(content)
+	}
+	return content, nil
+}
+
+// stripANSI removes escape sequences from text.
+func stripANSI(text []byte) []byte {
+	if bytes.IndexByte(text, 0x1b) < 0 {
+		return text
+	}
+	out := make([]byte, 0, len(text))
+	scanANSI(text, func(run []byte, _ ansiStyle) {
+		out = append(out, run...)
+	})
+	return out
+}
+
+// ansiSpans splits text into styled spans, merging neighbours that share a
+// style. Newlines are ordinary text.
+func ansiSpans(text []byte) []ansiSpan {
+	spans := []ansiSpan{}
+	scanANSI(text, func(run []byte, st ansiStyle) {
+		if n := len(spans); n > 0 && spans[n-1].ansiStyle == st {
+			spans[n-1].Text += string(run)
+			return
+		}
+		spans = append(spans, ansiSpan{Text: string(run), ansiStyle: st})
+	})
+	return spans
+}
+
+// ansiLines returns the spans of each line of content holding an escape.
+// Styles do not carry over from one line to the next, as log writers reset
+// them per line and a tail may start anywhere.
+func ansiLines(content []byte) []ansiLine {
+	var out []ansiLine
+	for i := 0; len(content) > 0; i++ {
+		line := content
+		if j := bytes.IndexByte(content, '\n'); j >= 0 {
+			line, content = content[:j], content[j+1:]
+		} else {
+			content = nil
+		}
+		if bytes.IndexByte(line, 0x1b) >= 0 {
+			out = append(out, ansiLine{Line: i, Spans: ansiSpans(line)})
+		}
+	}
+	return out
+}
+
+// scanANSI walks text and calls emit for each run between escape
+// sequences, with the style set by the SGR sequences before it. Other CSI,
+// OSC and two-byte escapes are dropped.
+func scanANSI(text []byte, emit func(run []byte, st ansiStyle)) {
+	var st ansiStyle
+	runStart := 0
+	for i := 0; i < len(text); {
+		if text[i] != 0x1b {
+			i++
+			continue
+		}
+		if i > runStart {
+			emit(text[runStart:i], st)
+		}
+		n, params, final := ansiSequence(text[i:])
+		if final == 'm' {
+			st.apply(params)
+		}
+		i += n
+		runStart = i
+	}
+	if runStart < len(text) {
+		emit(text[runStart:], st)
+	}
+}
+
+// ansiSequence measures the escape sequence at the start of b, returning
+// its length and, for a CSI sequence, its parameters and final byte. A
+// sequence cut off by the end of b spans the rest of it.
+func ansiSequence(b []byte) (n int, params string, final byte) {
+	if len(b) < 2 {
+		return len(b), "", 0
+	}
+	switch b[1] {
+	case '[': // CSI: parameters 0x30–0x3f, intermediates 0x20–0x2f, final 0x40–0x7e
+		j := 2
+		for j < len(b) && b[j] >= 0x30 && b[j] <= 0x3f {
+			j++
+		}
+		p := string(b[2:j])
+		for j < len(b) && b[j] >= 0x20 && b[j] <= 0x2f {
+			j++
+		}
+		if j < len(b) && b[j] >= 0x40 && b[j] <= 0x7e {
+			return j + 1, p, b[j]
+		}
+		return j, "", 0
+	case ']', 'P', '_', '^': // OSC, DCS, APC, PM: up to BEL or ST (ESC \)
+		for j := 2; j < len(b); j++ {
+			switch {
+			case b[j] == 0x07:
+				return j + 1, "", 0
+			case b[j] == 0x1b && j+1 < len(b) && b[j+1] == '\\':
+				return j + 2, "", 0
+			case b[j] == '\n':
+				return j, "", 0 // unterminated; keep the next line
+			}
+		}
+		return len(b), "", 0
+	}
+	// Two-byte escapes, with optional intermediates (ESC ( B).
+	j := 1
+	for j < len(b) && b[j] >= 0x20 && b[j] <= 0x2f {
+		j++
+	}
+	if j < len(b) && b[j] >= 0x30 && b[j] <= 0x7e {
+		j++
+	}
+	return j, "", 0
+}
+
+// apply updates the style with the parameters of an SGR sequence. Private
+// sequences (ESC [ ? … m) are ignored.
+func (st *ansiStyle) apply(params string) {
+	if strings.ContainsAny(params, "<=>?") {
+		return
+	}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		sub := strings.Split(codes[i], ":")
+		code, _ := strconv.Atoi(sub[0]) // empty means 0
+		switch {
+		case code == 0:
+			*st = ansiStyle{}
+		case code == 1:
+			st.Bold = true
+		case code == 2:
+			st.Dim = true
+		case code == 3:
+			st.Italic = true
+		case code == 4:
+			st.Underline = len(sub) < 2 || sub[1] != "0" // 4:0 is "no underline"
+		case code == 7:
+			st.Inverse = true
+		case code == 9:
+			st.Strike = true
+		case code == 21:
+			st.Underline = true
+		case code == 22:
+			st.Bold, st.Dim = false, false
+		case code == 23:
+			st.Italic = false
+		case code == 24:
+			st.Underline = false
+		case code == 27:
+			st.Inverse = false
+		case code == 29:
+			st.Strike = false
+		case code >= 30 && code <= 37:
+			st.FG = ansiPalette[code-30]
+		case code >= 90 && code <= 97:
+			st.FG = ansiPalette[code-90+8]
+		case code == 39:
+			st.FG = ""
+		case code >= 40 && code <= 47:
+			st.BG = ansiPalette[code-40]
+		case code >= 100 && code <= 107:
+			st.BG = ansiPalette[code-100+8]
+		case code == 49:
+			st.BG = ""
+		case code == 38 || code == 48:
+			var color string
+			if len(sub) > 1 {
+				// Colon form: 38:5:n or 38:2:[colorspace:]r:g:b.
+				color = extendedANSIColor(sub[1:])
+			} else {
+				var used int
+				color, used = extendedANSIColorArgs(codes[i+1:])
+				i += used
+			}
+			if code == 38 {
+				st.FG = color
+			} else {
+				st.BG = color
+			}
+		}
+	}
+}
+
+// extendedANSIColorArgs reads the semicolon form of an extended colour,
+// "5;n" or "2;r;g;b", returning the colour and the parameters consumed.
+func extendedANSIColorArgs(args []string) (string, int) {
+	if len(args) == 0 {
+		return "", 0
+	}
+	switch args[0] {
+	case "5":
+		if len(args) >= 2 {
+			return extendedANSIColor(args[:2]), 2
+		}
+	case "2":
+		if len(args) >= 4 {
+			return extendedANSIColor(args[:4]), 4
+		}
+	}
+	return "", len(args)
+}
+
+// extendedANSIColor converts ["5", n] or ["2", [colorspace,] r, g, b] to a
+// CSS colour, or "" when malformed.
+func extendedANSIColor(args []string) string {
+	num := func(s string) (int, bool) {
+		v, err := strconv.Atoi(s)
+		return v, err == nil && v >= 0 && v <= 255
+	}
+	switch {
+	case len(args) == 2 && args[0] == "5":
+		n, ok := num(args[1])
+		if !ok {
+			return ""
+		}
+		return ansi256Color(n)
+	case (len(args) == 4 || len(args) == 5) && args[0] == "2":
+		rgb := args[len(args)-3:]
+		r, ok1 := num(rgb[0])
+		g, ok2 := num(rgb[1])
+		b, ok3 := num(rgb[2])
+		if !ok1 || !ok2 || !ok3 {
+			return ""
+		}
+		return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+	}
+	return ""
+}
+
+// ansi256Color maps an xterm 256-colour index to a CSS colour.
+func ansi256Color(n int) string {
+	switch {
+	case n < 16:
+		return ansiPalette[n]
+	case n < 232:
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
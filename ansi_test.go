@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestANSISequence(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		n      int
+		params string
+		final  byte
+	}{
+		{"sgr", "\x1b[1;31mx", 7, "1;31", 'm'},
+		{"private csi", "\x1b[?25hx", 6, "?25", 'h'},
+		{"csi with intermediate", "\x1b[2 qx", 5, "2", 'q'},
+		{"cut csi", "\x1b[12", 4, "", 0},
+		{"lone esc", "\x1b", 1, "", 0},
+		{"osc bel", "\x1b]0;title\x07x", 10, "", 0},
+		{"osc st", "\x1b]8;;u\x1b\\x", 8, "", 0},
+		{"unterminated osc stops at newline", "\x1b]0;t\nnext", 5, "", 0},
+		{"cut osc", "\x1b]0;t", 5, "", 0},
+		{"charset", "\x1b(Bx", 3, "", 0},
+		{"two byte", "\x1b7x", 2, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, params, final := ansiSequence([]byte(tt.in))
+			if n != tt.n || params != tt.params || final != tt.final {
+				t.Errorf("ansiSequence(%q) = %d, %q, %q; want %d, %q, %q", tt.in, n, params, final, tt.n, tt.params, tt.final)
+			}
+		})
+	}
+}
+
+func TestANSISpans(t *testing.T) {
+	red := ansiPalette[1]
+	tests := []struct {
+		name string
+		in   string
+		want []ansiSpan
+	}{
+		{"empty", "", []ansiSpan{}},
+		{"plain", "a b", []ansiSpan{{Text: "a b"}}},
+		{"colour and reset", "a\x1b[1;31mb\x1b[0mc", []ansiSpan{{Text: "a"}, {Text: "b", ansiStyle: ansiStyle{FG: red, Bold: true}}, {Text: "c"}}},
+		{"same style merges", "\x1b[1mx\x1b[1my", []ansiSpan{{Text: "xy", ansiStyle: ansiStyle{Bold: true}}}},
+		{"bright and background", "\x1b[91;104mx", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{FG: ansiPalette[9], BG: ansiPalette[12]}}}},
+		{"256 colour", "\x1b[38;5;196mx", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{FG: "#ff0000"}}}},
+		{"truecolor", "\x1b[48;2;1;2;3mx", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{BG: "#010203"}}}},
+		{"colon truecolor", "\x1b[38:2::10:20:30mx", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{FG: "#0a141e"}}}},
+		{"extended then more codes", "\x1b[38;5;1;1mx", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{FG: red, Bold: true}}}},
+		{"underline off", "\x1b[4mx\x1b[4:0my", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{Underline: true}}, {Text: "y"}}},
+		{"22 clears bold and dim", "\x1b[1;2mx\x1b[22my", []ansiSpan{{Text: "x", ansiStyle: ansiStyle{Bold: true, Dim: true}}, {Text: "y"}}},
+		{"private sgr ignored", "\x1b[?1mx", []ansiSpan{{Text: "x"}}},
+		{"other escapes dropped", "a\x1b[2Kb\x1b]0;t\x07c", []ansiSpan{{Text: "abc"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ansiSpans([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ansiSpans(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"\x1b[31mred\x1b[0m \x1b]0;t\x07ok", "red ok"},
+		{"cut \x1b[3", "cut "},
+	}
+	for _, tt := range tests {
+		if got := string(stripANSI([]byte(tt.in))); got != tt.want {
+			t.Errorf("stripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestANSILines(t *testing.T) {
+	got := ansiLines([]byte("a\n\x1b[1mb\nc\n\x1b[0m"))
+	want := []ansiLine{
+		{Line: 1, Spans: []ansiSpan{{Text: "b", ansiStyle: ansiStyle{Bold: true}}}},
+		{Line: 3, Spans: []ansiSpan{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ansiLines = %+v, want %+v", got, want)
+	}
+}
+
+func TestExtendedANSIColor(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"5", "9"}, ansiPalette[9]},
+		{[]string{"5", "16"}, "#000000"},
+		{[]string{"5", "231"}, "#ffffff"},
+		{[]string{"5", "232"}, "#080808"},
+		{[]string{"5", "255"}, "#eeeeee"},
+		{[]string{"5", "256"}, ""},
+		{[]string{"5", "x"}, ""},
+		{[]string{"2", "1", "2", "3"}, "#010203"},
+		{[]string{"2", "0", "1", "2", "3"}, "#010203"},
+		{[]string{"2", "300", "0", "0"}, ""},
+		{[]string{"2", "1", "2"}, ""},
+		{[]string{"7"}, ""},
+	}
+	for _, tt := range tests {
+		if got := extendedANSIColor(tt.args); got != tt.want {
+			t.Errorf("extendedANSIColor(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestExtendedANSIColorArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		color string
+		used  int
+	}{
+		{nil, "", 0},
+		{[]string{"5", "9", "1"}, ansiPalette[9], 2},
+		{[]string{"2", "1", "2", "3", "4"}, "#010203", 4},
+		{[]string{"2", "1"}, "", 2},
+	}
+	for _, tt := range tests {
+		color, used := extendedANSIColorArgs(tt.args)
+		if color != tt.color || used != tt.used {
+			t.Errorf("extendedANSIColorArgs(%q) = %q, %d; want %q, %d", tt.args, color, used, tt.color, tt.used)
+		}
+	}
+}
+
+func TestParseANSIMode(t *testing.T) {
+	for in, want := range map[string]string{"": "", "raw": "", "strip": "strip", "spans": "spans"} {
+		if got, err := parseANSIMode(url.Values{"ansi": {in}}); err != nil || got != want {
+			t.Errorf("parseANSIMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseANSIMode(url.Values{"ansi": {"html"}}); err == nil {
+		t.Error("parseANSIMode accepted an unknown mode")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphNode is a note (or a linked attachment such as an image) in the
+// knowledge-base graph.
+type graphNode struct {
+	ID        string   `json:"id"` // path relative to root
+	Name      string   `json:"name"`
+	Folder    string   `json:"folder"`
+	Kind      string   `json:"kind"` // "note" or "attachment"
+	Tags      []string `json:"tags"`
+	Links     int      `json:"links"`     // outgoing edges
+	Backlinks int      `json:"backlinks"` // incoming edges
+}
+
+// graphEdge connects two nodes. Weight counts how many times source links
+// to target with the same kind.
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"` // "link" or "embed"
+	Weight int    `json:"weight"`
+}
+
+type graphResult struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphFilter narrows the graph. Folder and Tag select notes; Focus keeps
+// only nodes within Depth hops (in either direction) of the focus note.
+type graphFilter struct {
+	Folder string
+	Tag    string
+	Focus  string
+	Depth  int
+}
+
+// buildGraph links every markdown note under root to the notes and files it
+// links to or embeds. Unresolvable and external links are left out.
+func buildGraph(root string, filter graphFilter) (graphResult, error) {
+	v, err := loadVault(root)
+	if err != nil {
+		return graphResult{}, err
+	}
+	tags, err := collectAllTags(root)
+	if err != nil {
+		return graphResult{}, err
+	}
+
+	inFolder := func(p string) bool {
+		return filter.Folder == "" || strings.HasPrefix(p, filter.Folder+"/")
+	}
+	hasTag := func(p string) bool {
+		if filter.Tag == "" {
+			return true
+		}
+		for _, t := range tags.Tags[p] {
+			if strings.EqualFold(t, filter.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	nodes := make(map[string]*graphNode)
+	addNode := func(p, kind string) {
+		if _, ok := nodes[p]; ok {
+			return
+		}
+		folder := path.Dir(p)
+		if folder == "." {
+			folder = ""
+		}
+		nodeTags := tags.Tags[p]
+		if nodeTags == nil {
+			nodeTags = []string{}
+		}
+		name := path.Base(p)
+		if kind == "note" {
+			name = strings.TrimSuffix(name, path.Ext(name))
+		}
+		nodes[p] = &graphNode{
+			ID:     p,
+			Name:   name,
+			Folder: folder,
+			Kind:   kind,
+			Tags:   nodeTags,
+		}
+	}
+	for _, p := range v.paths {
+		if inFolder(p) && hasTag(p) {
+			addNode(p, "note")
+		}
+	}
+
+	type edgeKey struct{ source, target, kind string }
+	weights := make(map[edgeKey]int)
+	for _, src := range v.paths {
+		if _, ok := nodes[src]; !ok {
+			continue
+		}
+		for _, l := range v.docs[src].Links {
+			target, _, internal, rerr := v.resolveLink(src, l)
+			if !internal || rerr != nil || target == src || !v.exists(target) {
+				continue
+			}
+			if isMarkdownFile(target) {
+				if _, ok := nodes[target]; !ok {
+					continue
+				}
+			} else {
+				addNode(target, "attachment")
+			}
+			kind := "link"
+			if l.Kind == "image" || l.Kind == "embed" {
+				kind = "embed"
+			}
+			weights[edgeKey{src, target, kind}]++
+		}
+	}
+
+	keep := nodes
+	if filter.Focus != "" {
+		keep = make(map[string]*graphNode)
+		if n, ok := nodes[filter.Focus]; ok {
+			adj := make(map[string][]string)
+			for k := range weights {
+				adj[k.source] = append(adj[k.source], k.target)
+				adj[k.target] = append(adj[k.target], k.source)
+			}
+			keep[filter.Focus] = n
+			frontier := []string{filter.Focus}
+			for d := 0; d < filter.Depth && len(frontier) > 0; d++ {
+				var next []string
+				for _, p := range frontier {
+					for _, q := range adj[p] {
+						if _, seen := keep[q]; !seen {
+							keep[q] = nodes[q]
+							next = append(next, q)
+						}
+					}
+				}
+				frontier = next
+			}
+		}
+	}
+
+	result := graphResult{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	for k, w := range weights {
+		if keep[k.source] == nil || keep[k.target] == nil {
+			continue
+		}
+		keep[k.source].Links++
+		keep[k.target].Backlinks++
+		result.Edges = append(result.Edges, graphEdge{Source: k.source, Target: k.target, Kind: k.kind, Weight: w})
+	}
+	for _, n := range keep {
+		result.Nodes = append(result.Nodes, *n)
+	}
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].ID < result.Nodes[j].ID })
+	sort.Slice(result.Edges, func(i, j int) bool {
+		a, b := result.Edges[i], result.Edges[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Kind < b.Kind
+	})
+	return result, nil
+}
+
+// handleGraph returns the note graph: nodes (notes with their tags, plus
+// linked attachments) and edges (links and embeds). Query parameters:
+// folder, tag, focus and depth (default 1, used with focus).
+func (a *app) handleGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter := graphFilter{Tag: strings.TrimSpace(q.Get("tag")), Depth: 1}
+	if raw := q.Get("folder"); raw != "" {
+		folder, err := sanitizeRelativePath(raw)
+		if err != nil {
+			http.Error(w, "invalid folder", http.StatusBadRequest)
+			return
+		}
+		filter.Folder = folder
+	}
+	if raw := q.Get("focus"); raw != "" {
+		focus, err := sanitizeRelativePath(raw)
+		if err != nil {
+			http.Error(w, "invalid focus path", http.StatusBadRequest)
+			return
+		}
+		filter.Focus = focus
+	}
+	if raw := q.Get("depth"); raw != "" {
+		d, err := strconv.Atoi(raw)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid depth", http.StatusBadRequest)
+			return
+		}
+		filter.Depth = d
+	}
+
+	graph, err := buildGraph(a.root, filter)
+	if err != nil {
+		http.Error(w, "failed to build graph", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(graph)
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// brokenLink is a link or embed whose target could not be resolved.
+type brokenLink struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// linkReport is the result of checking the links of the markdown files
+// under the root.
+type linkReport struct {
+	Files  int          `json:"files"`
+	Links  int          `json:"links"`
+	Broken []brokenLink `json:"broken"`
+}
+
+// linkFix is a single link destination rewritten by fixLinksAfterRename.
+type linkFix struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+var urlSchemeRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// vault is a parsed snapshot of every markdown file under the root, used to
+// resolve links (including wikilinks, which are matched by note name).
+type vault struct {
+	root   string
+	docs   map[string]mdDocument
+	byName map[string][]string // lower-case note name (no extension) -> paths
+	byFile map[string][]string // lower-case file name of other viewable files -> paths
+	paths  []string
+}
+
+// loadVault reads and parses every markdown file under root and indexes the
+// other viewable files by name so embeds can be resolved.
+func loadVault(root string) (*vault, error) {
+	v := &vault{
+		root:   root,
+		docs:   make(map[string]mdDocument),
+		byName: make(map[string][]string),
+		byFile: make(map[string][]string),
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isViewableFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if !isMarkdownFile(rel) {
+			name := strings.ToLower(path.Base(rel))
+			v.byFile[name] = append(v.byFile[name], rel)
+			return nil
+		}
+		_, doc, err := readMarkdownDocument(p)
+		if err != nil {
+			return nil
+		}
+		v.docs[rel] = doc
+		v.paths = append(v.paths, rel)
+		name := strings.ToLower(strings.TrimSuffix(path.Base(rel), path.Ext(rel)))
+		v.byName[name] = append(v.byName[name], rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(v.paths)
+	for _, paths := range v.byName {
+		sort.Strings(paths)
+	}
+	for _, paths := range v.byFile {
+		sort.Strings(paths)
+	}
+	return v, nil
+}
+
+// splitLinkTarget parses a link destination as written in fromRel into a
+// root-relative path and fragment. external is true for URLs with a scheme
+// (http:, mailto:, data: …) and protocol-relative URLs.
+func splitLinkTarget(fromRel, dest string) (rel, anchor string, external bool, err error) {
+	dest = strings.TrimSpace(dest)
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	if urlSchemeRe.MatchString(dest) || strings.HasPrefix(dest, "//") {
+		return "", "", true, nil
+	}
+	p := dest
+	if i := strings.IndexByte(p, '#'); i >= 0 {
+		p, anchor = p[:i], p[i+1:]
+	}
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	if u, uerr := url.PathUnescape(p); uerr == nil {
+		p = u
+	}
+	if a, uerr := url.PathUnescape(anchor); uerr == nil {
+		anchor = a
+	}
+	if p == "" {
+		return fromRel, anchor, false, nil
+	}
+	if strings.HasPrefix(p, "/") {
+		p = strings.TrimLeft(p, "/")
+	} else {
+		p = path.Join(path.Dir(fromRel), p)
+	}
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", "", false, errors.New("path escapes root")
+	}
+	return p, anchor, false, nil
+}
+
+// resolveWikiLink finds the note a [[wikilink]] refers to. Names containing
+// a slash are matched against root-relative paths, everything else by note
+// name, preferring a note in the linking file's own directory.
+func (v *vault) resolveWikiLink(fromRel, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fromRel, true
+	}
+	lower := strings.ToLower(name)
+	if strings.Contains(name, "/") {
+		want := strings.TrimPrefix(lower, "/")
+		for _, p := range v.paths {
+			lp := strings.ToLower(p)
+			if lp == want || strings.TrimSuffix(lp, path.Ext(lp)) == want {
+				return p, true
+			}
+		}
+		return "", false
+	}
+	if isMarkdownFile(lower) {
+		lower = strings.TrimSuffix(lower, path.Ext(lower))
+	}
+	candidates := v.byName[lower]
+	if len(candidates) == 0 {
+		// Embeds may name other files, e.g. ![[diagram.png]].
+		candidates = v.byFile[lower]
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	dir := path.Dir(fromRel)
+	for _, c := range candidates {
+		if path.Dir(c) == dir {
+			return c, true
+		}
+	}
+	return candidates[0], true
+}
+
+// exists reports whether a root-relative path exists on disk.
+func (v *vault) exists(rel string) bool {
+	full, err := secureJoin(v.root, rel)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(full)
+	return err == nil
+}
+
+// hasAnchor reports whether the markdown file rel has a heading with the
+// given anchor id. Non-markdown targets accept any anchor.
+func (v *vault) hasAnchor(rel, anchor string) bool {
+	if anchor == "" || !isMarkdownFile(rel) {
+		return true
+	}
+	doc, ok := v.docs[rel]
+	if !ok {
+		return true
+	}
+	want := strings.ToLower(anchor)
+	for _, h := range doc.Headings {
+		if h.Slug == want || h.Slug == headingSlug(anchor) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveLink resolves l, found in fromRel, to a root-relative path and
+// anchor. ok is false when the link points outside the vault (external URL).
+func (v *vault) resolveLink(fromRel string, l mdLink) (rel, anchor string, ok bool, err error) {
+	if l.Kind == "wikilink" || l.Kind == "embed" {
+		rel, found := v.resolveWikiLink(fromRel, l.Target)
+		if !found {
+			return "", "", true, errors.New("note not found")
+		}
+		return rel, l.Anchor, true, nil
+	}
+	rel, anchor, external, err := splitLinkTarget(fromRel, l.Target)
+	if external {
+		return "", "", false, nil
+	}
+	return rel, anchor, true, err
+}
+
+// checkLinks scans the markdown files under root (or only the file or
+// folder named by only, if non-empty) and reports links, images and embeds
+// whose target file or heading anchor does not exist.
+func checkLinks(root, only string) (linkReport, error) {
+	report := linkReport{Broken: []brokenLink{}}
+	v, err := loadVault(root)
+	if err != nil {
+		return report, err
+	}
+	for _, rel := range v.paths {
+		if only != "" && rel != only && !strings.HasPrefix(rel, only+"/") {
+			continue
+		}
+		report.Files++
+		for _, l := range v.docs[rel].Links {
+			target, anchor, internal, rerr := v.resolveLink(rel, l)
+			if !internal {
+				continue
+			}
+			report.Links++
+			reason := ""
+			switch {
+			case rerr != nil:
+				reason = rerr.Error()
+			case !v.exists(target):
+				reason = "file not found"
+			case !v.hasAnchor(target, anchor):
+				reason = "anchor not found"
+			}
+			if reason != "" {
+				report.Broken = append(report.Broken, brokenLink{File: rel, Line: l.Line, Kind: l.Kind, Target: l.Target, Reason: reason})
+			}
+		}
+	}
+	return report, nil
+}
+
+// fixLinksAfterRename repairs links after the file or folder from was
+// renamed to to (both relative to root; the rename must already have
+// happened). Links pointing at the old location are rewritten, and relative
+// links inside moved markdown files are rebased. With dryRun nothing is
+// written. Each file is re-read and re-parsed right before it is rewritten;
+// callers serialize this with other writers of markdown files.
+func fixLinksAfterRename(root, from, to string, dryRun bool) ([]linkFix, error) {
+	toFull, err := secureJoin(root, to)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(toFull)
+	if err != nil {
+		return nil, fmt.Errorf("rename target: %w", err)
+	}
+	isDir := info.IsDir()
+
+	// moved maps a path in the old layout to the new layout.
+	moved := func(p string) (string, bool) {
+		if p == from {
+			return to, true
+		}
+		if isDir && strings.HasPrefix(p, from+"/") {
+			return to + p[len(from):], true
+		}
+		return p, false
+	}
+	// original maps a current path back to where it was before the rename.
+	original := func(p string) string {
+		if p == to {
+			return from
+		}
+		if isDir && strings.HasPrefix(p, to+"/") {
+			return from + p[len(to):]
+		}
+		return p
+	}
+
+	v, err := loadVault(root)
+	if err != nil {
+		return nil, err
+	}
+	oldName := strings.ToLower(strings.TrimSuffix(path.Base(from), path.Ext(from)))
+	newName := strings.TrimSuffix(path.Base(to), path.Ext(to))
+	renamedNote := !isDir && isMarkdownFile(to) && !strings.EqualFold(oldName, newName)
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	// plan lists the link rewrites for the document cur.
+	plan := func(cur string, doc mdDocument) ([]edit, []linkFix) {
+		orig := original(cur)
+		var edits []edit
+		var fixes []linkFix
+		for _, l := range doc.Links {
+			replacement := ""
+			switch l.Kind {
+			case "wikilink", "embed":
+				if !renamedNote {
+					continue
+				}
+				target := strings.ToLower(l.Target)
+				if isMarkdownFile(target) {
+					target = strings.TrimSuffix(target, path.Ext(target))
+				}
+				switch {
+				case target == oldName:
+					replacement = newName
+				case strings.Contains(target, "/") && strings.TrimPrefix(target, "/") == strings.ToLower(strings.TrimSuffix(from, path.Ext(from))):
+					replacement = strings.TrimSuffix(to, path.Ext(to))
+				default:
+					continue
+				}
+			default:
+				target, anchor, external, serr := splitLinkTarget(orig, l.Target)
+				if external || serr != nil || strings.HasPrefix(strings.TrimSpace(l.Target), "#") {
+					continue
+				}
+				newTarget, wasMoved := moved(target)
+				if !wasMoved && orig == cur {
+					continue
+				}
+				if !v.exists(newTarget) {
+					continue
+				}
+				replacement = formatLinkTarget(l.Target, cur, newTarget, anchor)
+			}
+			if replacement == "" || replacement == l.Target {
+				continue
+			}
+			edits = append(edits, edit{l.Start, l.End, replacement})
+			fixes = append(fixes, linkFix{File: cur, Line: l.Line, Old: l.Target, New: replacement})
+		}
+		return edits, fixes
+	}
+
+	fixes := []linkFix{}
+	for _, cur := range v.paths {
+		edits, found := plan(cur, v.docs[cur])
+		if len(edits) == 0 {
+			continue
+		}
+		if dryRun {
+			fixes = append(fixes, found...)
+			continue
+		}
+
+		full, err := secureJoin(root, cur)
+		if err != nil {
+			continue
+		}
+		// The vault may predate a save; offsets must come from the
+		// content being rewritten.
+		text, doc, err := readMarkdownDocument(full)
+		if err != nil {
+			return fixes, err
+		}
+		if edits, found = plan(cur, doc); len(edits) == 0 {
+			continue
+		}
+		sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+		for _, e := range edits {
+			text = text[:e.start] + e.text + text[e.end:]
+		}
+		if err := writeFileKeepMode(full, []byte(text)); err != nil {
+			return fixes, err
+		}
+		fixes = append(fixes, found...)
+	}
+	return fixes, nil
+}
+
+// formatLinkTarget writes a link destination for target as seen from the
+// file fromRel, keeping the style of the original destination: angle
+// brackets, root-relative form and any query string.
+func formatLinkTarget(orig, fromRel, target, anchor string) string {
+	orig = strings.TrimSpace(orig)
+	bracketed := strings.HasPrefix(orig, "<") && strings.HasSuffix(orig, ">")
+	bare := strings.TrimSuffix(strings.TrimPrefix(orig, "<"), ">")
+
+	var p string
+	if strings.HasPrefix(bare, "/") {
+		p = "/" + target
+	} else {
+		r, err := filepath.Rel(filepath.FromSlash(path.Dir(fromRel)), filepath.FromSlash(target))
+		if err != nil {
+			return orig
+		}
+		p = filepath.ToSlash(r)
+	}
+	if !bracketed {
+		p = strings.ReplaceAll(p, " ", "%20")
+	}
+	if i := strings.IndexAny(bare, "?#"); i >= 0 && bare[i] == '?' {
+		q := bare[i:]
+		if j := strings.IndexByte(q, '#'); j >= 0 {
+			q = q[:j]
+		}
+		p += q
+	}
+	if anchor != "" {
+		p += "#" + anchor
+	}
+	if bracketed {
+		return "<" + p + ">"
+	}
+	return p
+}
+
+// handleLinksCheck reports broken links, images and embeds. An optional
+// path restricts the check to one markdown file or folder.
+func (a *app) handleLinksCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	only := ""
+	if raw := r.URL.Query().Get("path"); raw != "" {
+		relPath, err := sanitizeRelativePath(raw)
+		if err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		only = relPath
+	}
+
+	report, err := checkLinks(a.root, only)
+	if err != nil {
+		http.Error(w, "link check failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// handleLinksFix rewrites links after a file or folder has been renamed.
+func (a *app) handleLinksFix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		DryRun bool   `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	from, err := sanitizeRelativePath(req.From)
+	if err != nil {
+		http.Error(w, "invalid from path", http.StatusBadRequest)
+		return
+	}
+	to, err := sanitizeRelativePath(req.To)
+	if err != nil {
+		http.Error(w, "invalid to path", http.StatusBadRequest)
+		return
+	}
+
+	a.editMu.Lock()
+	fixes, err := fixLinksAfterRename(a.root, from, to, req.DryRun)
+	a.editMu.Unlock()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "renamed file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to fix links", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Fixes  []linkFix `json:"fixes"`
+		DryRun bool      `json:"dryRun"`
+	}{Fixes: fixes, DryRun: req.DryRun})
+}
+
+// runCheckLinks implements the `mdviewer check-links` subcommand. It prints
+// broken links as file:line and exits non-zero if any were found.
+func runCheckLinks(args []string) int {
+	fset := flag.NewFlagSet("check-links", flag.ExitOnError)
+	rootFlag := fset.String("root", ".", "Root directory to scan for markdown files")
+	fromFlag := fset.String("from", "", "Old path (relative to -root) of a renamed file or folder whose links should be fixed")
+	toFlag := fset.String("to", "", "New path (relative to -root) of the renamed file or folder")
+	dryRunFlag := fset.Bool("dry-run", false, "With -from/-to, print the fixes without writing them")
+	fset.Parse(args)
+
+	absRoot, err := filepath.Abs(*rootFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve root: %v\n", err)
+		return 2
+	}
+
+	if *fromFlag != "" || *toFlag != "" {
+		from, ferr := sanitizeRelativePath(*fromFlag)
+		to, terr := sanitizeRelativePath(*toFlag)
+		if ferr != nil || terr != nil {
+			fmt.Fprintln(os.Stderr, "check-links: -from and -to must both be paths relative to -root")
+			return 2
+		}
+		fixes, err := fixLinksAfterRename(absRoot, from, to, *dryRunFlag)
+		for _, f := range fixes {
+			fmt.Printf("%s:%d: %s -> %s\n", f.File, f.Line, f.Old, f.New)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fix links: %v\n", err)
+			return 2
+		}
+		verb := "Fixed"
+		if *dryRunFlag {
+			verb = "Would fix"
+		}
+		fmt.Printf("%s %d link(s)\n", verb, len(fixes))
+		if *dryRunFlag {
+			return 0
+		}
+	}
+
+	report, err := checkLinks(absRoot, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check links: %v\n", err)
+		return 2
+	}
+	for _, b := range report.Broken {
+		fmt.Printf("%s:%d: %s %q: %s\n", b.File, b.Line, b.Kind, b.Target, b.Reason)
+	}
+	fmt.Printf("Checked %d link(s) in %d file(s): %d broken\n", report.Links, report.Files, len(report.Broken))
+	if len(report.Broken) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,827 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// alertRescanInterval is how often, while any rule exists, .mdviewer
+	// files are re-read for alert rules and the set of watched logs is
+	// updated.
+	alertRescanInterval = 10 * time.Second
+	// defaultAlertWindow and defaultAlertCooldown apply when a rule leaves
+	// window or cooldown empty.
+	defaultAlertWindow   = time.Minute
+	defaultAlertCooldown = 5 * time.Minute
+	// maxAlertHistory bounds the fired alerts kept in memory.
+	maxAlertHistory = 500
+	// maxAlertSamples bounds the matching lines attached to a fired alert.
+	maxAlertSamples = 5
+	// alertHookTimeout bounds a webhook request or hook command.
+	alertHookTimeout = 30 * time.Second
+	// maxAlertCatchUp bounds the bytes re-read after a watch falls behind.
+	maxAlertCatchUp = 16 << 20
+)
+
+// logAlertRule is an alert rule stored in a .mdviewer file next to the saved
+// log views. Like views, it applies to logs in that directory and its
+// subdirectories, optionally narrowed by Files, a glob on the file name.
+// A line matches when it contains Pattern (a regexp with Regex) and
+// satisfies every Where predicate (the /api/log/search where= syntax, e.g.
+// "level=error"). The rule fires when Threshold lines match within Window,
+// then stays quiet for Cooldown.
+type logAlertRule struct {
+	Name      string   `json:"name"`
+	Files     string   `json:"files,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Regex     bool     `json:"regex,omitempty"`
+	Where     []string `json:"where,omitempty"`
+	Threshold int      `json:"threshold,omitempty"` // default 1
+	Window    string   `json:"window,omitempty"`    // duration, default 1m
+	Cooldown  string   `json:"cooldown,omitempty"`  // duration, default 5m
+	Notify    bool     `json:"notify,omitempty"`    // desktop notification
+	Webhook   string   `json:"webhook,omitempty"`   // URL receiving a JSON POST
+	Command   string   `json:"command,omitempty"`   // shell command; needs -alert-commands
+	Disabled  bool     `json:"disabled,omitempty"`
+}
+
+// alertRule is a validated rule with the directory (relative to root) of
+// the .mdviewer file declaring it.
+type alertRule struct {
+	logAlertRule
+	dir       string
+	query     logQuery
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+}
+
+// key identifies a rule across rescans.
+func (r *alertRule) key() string { return r.dir + "\x00" + r.Name }
+
+// compileAlertRule validates a stored rule.
+func compileAlertRule(dir string, rule logAlertRule) (*alertRule, error) {
+	if strings.TrimSpace(rule.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	if rule.Pattern == "" && len(rule.Where) == 0 {
+		return nil, errors.New("pattern or where is required")
+	}
+	if rule.Files != "" {
+		if _, err := path.Match(rule.Files, ""); err != nil {
+			return nil, errors.New("invalid files glob")
+		}
+	}
+	params := url.Values{"where": rule.Where}
+	if rule.Pattern != "" {
+		params.Set("q", rule.Pattern)
+	}
+	if rule.Regex {
+		params.Set("mode", "regex")
+	}
+	query, err := parseLogQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Webhook != "" {
+		if u, err := url.Parse(rule.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, errors.New("webhook must be an http(s) URL")
+		}
+	}
+	r := &alertRule{logAlertRule: rule, dir: dir, query: query, threshold: max(rule.Threshold, 1),
+		window: defaultAlertWindow, cooldown: defaultAlertCooldown}
+	if rule.Window != "" {
+		if r.window, err = time.ParseDuration(rule.Window); err != nil || r.window <= 0 {
+			return nil, errors.New("invalid window")
+		}
+	}
+	if rule.Cooldown != "" {
+		if r.cooldown, err = time.ParseDuration(rule.Cooldown); err != nil || r.cooldown < 0 {
+			return nil, errors.New("invalid cooldown")
+		}
+	}
+	return r, nil
+}
+
+// appliesTo reports whether the rule covers the log at rel.
+func (r *alertRule) appliesTo(rel string) bool {
+	if r.dir != "" && !strings.HasPrefix(rel, r.dir+"/") {
+		return false
+	}
+	if r.Files == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Files, path.Base(rel))
+	return ok
+}
+
+// firedAlert is one entry of the alert history.
+type firedAlert struct {
+	ID     int64    `json:"id"`
+	Rule   string   `json:"rule"`
+	Dir    string   `json:"dir"`
+	Path   string   `json:"path"`
+	Time   string   `json:"time"`
+	Count  int      `json:"count"` // matching lines within the window
+	Window string   `json:"window"`
+	Lines  []string `json:"lines"` // most recent matching lines
+	Errors []string `json:"errors,omitempty"`
+}
+
+// logAlerter evaluates alert rules against every live log they apply to.
+// It tails the logs through the shared logHub, so logs open in the viewer
+// cost no extra watcher.
+type logAlerter struct {
+	app      *app
+	commands bool // run command hooks (-alert-commands)
+
+	mu       sync.Mutex
+	rules    []*alertRule
+	invalid  map[string]string // rule key -> validation error
+	watches  map[string]*alertWatch
+	history  []firedAlert
+	nextID   int64
+	rescanCh chan struct{}
+}
+
+func newLogAlerter(a *app, commands bool) *logAlerter {
+	return &logAlerter{
+		app:      a,
+		commands: commands,
+		invalid:  make(map[string]string),
+		watches:  make(map[string]*alertWatch),
+		rescanCh: make(chan struct{}, 1),
+	}
+}
+
+// run loads the rules at startup and whenever they are edited through the
+// API. While any rule exists it also rescans periodically, to pick up new
+// logs and hand edits; without rules the tree is not walked again.
+func (al *logAlerter) run() {
+	timer := time.NewTimer(alertRescanInterval)
+	defer timer.Stop()
+	for {
+		var tick <-chan time.Time
+		if al.rescan() {
+			timer.Reset(alertRescanInterval)
+			tick = timer.C
+		}
+		select {
+		case <-tick:
+		case <-al.rescanCh:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// requestRescan makes run pick up edited rules without waiting.
+func (al *logAlerter) requestRescan() {
+	select {
+	case al.rescanCh <- struct{}{}:
+	default:
+	}
+}
+
+// loadAlertRules reads the alert rules of every .mdviewer file under root.
+func loadAlertRules(root string) ([]*alertRule, map[string]string) {
+	var rules []*alertRule
+	invalid := make(map[string]string)
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != mdviewerFile {
+			return nil
+		}
+		dirPath := filepath.Dir(p)
+		data, err := readMdviewerFile(dirPath)
+		if err != nil || len(data.LogAlerts) == 0 {
+			return nil
+		}
+		relDir, err := filepath.Rel(root, dirPath)
+		if err != nil {
+			return nil
+		}
+		relDir = filepath.ToSlash(relDir)
+		if relDir == "." {
+			relDir = ""
+		}
+		for _, stored := range data.LogAlerts {
+			r, err := compileAlertRule(relDir, stored)
+			if err != nil {
+				invalid[relDir+"\x00"+stored.Name] = err.Error()
+				continue
+			}
+			if !stored.Disabled {
+				rules = append(rules, r)
+			}
+		}
+		return nil
+	})
+	return rules, invalid
+}
+
+// rescan reloads the rules and starts or stops log watches to match. It
+// reports whether any .mdviewer file defines rules, valid or not.
+func (al *logAlerter) rescan() bool {
+	rules, invalid := loadAlertRules(al.app.root)
+	want := make(map[string]bool)
+	if len(rules) > 0 {
+		files, _ := listMarkdownFiles(al.app.root)
+		for _, rel := range files {
+			if !isLogFile(rel) || isArchivedLog(rel) {
+				continue
+			}
+			for _, r := range rules {
+				if r.appliesTo(rel) {
+					want[rel] = true
+					break
+				}
+			}
+		}
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for key, msg := range invalid {
+		if al.invalid[key] != msg {
+			dir, name, _ := strings.Cut(key, "\x00")
+			log.Printf("[alerts] ignoring rule %q in %s/%s: %s", name, dir, mdviewerFile, msg)
+		}
+	}
+	al.rules, al.invalid = rules, invalid
+	for rel, w := range al.watches {
+		if !want[rel] {
+			close(w.stop)
+			delete(al.watches, rel)
+		}
+	}
+	for rel := range want {
+		if _, ok := al.watches[rel]; ok {
+			continue
+		}
+		full, err := secureJoin(al.app.root, rel)
+		if err != nil {
+			continue
+		}
+		w := &alertWatch{al: al, rel: rel, full: full, stop: make(chan struct{}), state: make(map[string]*alertState)}
+		al.watches[rel] = w
+		go w.run()
+	}
+	return len(rules) > 0 || len(invalid) > 0
+}
+
+// rulesFor returns the rules currently applying to rel.
+func (al *logAlerter) rulesFor(rel string) []*alertRule {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	var out []*alertRule
+	for _, r := range al.rules {
+		if r.appliesTo(rel) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// alertState is the sliding window of one rule on one log.
+type alertState struct {
+	hits      []time.Time
+	samples   []string
+	lastFired time.Time
+}
+
+// alertWatch tails one log and evaluates the rules applying to it.
+type alertWatch struct {
+	al      *logAlerter
+	rel     string
+	full    string
+	stop    chan struct{}
+	state   map[string]*alertState // by rule key; owned by run
+	partial []byte
+	parse   func([]byte) map[string]any
+}
+
+// run follows the log from its current end until stopped. A subscription
+// dropped for falling behind is renewed, reading what was missed from the
+// file.
+func (w *alertWatch) run() {
+	if f, err := os.Open(w.full); err == nil {
+		if format, err := detectLogFileFormat(f); err == nil {
+			w.parse = logRecordParser(format)
+		}
+		f.Close()
+	}
+	offset := int64(-1)
+	for {
+		sub, current, err := w.al.app.logs.subscribe(w.full)
+		if err != nil {
+			// Missing for now; retry until the rescan drops the watch.
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(alertRescanInterval):
+				continue
+			}
+		}
+		if offset >= 0 && offset < current {
+			// Dropped for falling behind: evaluate what was missed, up to
+			// maxAlertCatchUp bytes.
+			if current-offset > maxAlertCatchUp {
+				offset, w.partial = current-maxAlertCatchUp, nil
+			}
+			if f, err := os.Open(w.full); err == nil {
+				missed, _ := readLogRange(f, offset, current)
+				f.Close()
+				w.feed(missed)
+			}
+		}
+		offset = current
+		for dropped := false; !dropped; {
+			select {
+			case <-w.stop:
+				w.al.app.logs.unsubscribe(sub)
+				return
+			case c, ok := <-sub.C:
+				if !ok {
+					dropped = true
+					break
+				}
+				if c.Reset {
+					w.partial = nil
+				}
+				w.feed([]byte(c.Content))
+				offset = c.Offset
+			}
+		}
+	}
+}
+
+// feed evaluates the complete lines in data, keeping an unfinished tail.
+func (w *alertWatch) feed(data []byte) {
+	data = append(w.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		w.partial = data
+		return
+	}
+	w.partial = append([]byte(nil), data[end+1:]...)
+	rules := w.al.rulesFor(w.rel)
+	if len(rules) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		for _, r := range rules {
+			q := r.query
+			q.Parse = w.parse
+			if !q.match(line) {
+				continue
+			}
+			st := w.state[r.key()]
+			if st == nil {
+				st = &alertState{}
+				w.state[r.key()] = st
+			}
+			st.hits = append(st.hits, now)
+			st.samples = append(st.samples, string(line))
+			if len(st.samples) > maxAlertSamples {
+				st.samples = st.samples[len(st.samples)-maxAlertSamples:]
+			}
+		}
+	}
+	for _, r := range rules {
+		st := w.state[r.key()]
+		if st == nil {
+			continue
+		}
+		cut := 0
+		for cut < len(st.hits) && now.Sub(st.hits[cut]) > r.window {
+			cut++
+		}
+		st.hits = st.hits[cut:]
+		if len(st.hits) < r.threshold || (!st.lastFired.IsZero() && now.Sub(st.lastFired) < r.cooldown) {
+			continue
+		}
+		st.lastFired = now
+		w.al.fire(r, w.rel, len(st.hits), append([]string(nil), st.samples...))
+		st.hits, st.samples = nil, nil
+	}
+}
+
+// fire records an alert and runs its actions in the background. Sample
+// lines are masked first, so history, webhooks and notifications never
+// carry secrets under -redact.
+func (al *logAlerter) fire(r *alertRule, rel string, count int, lines []string) {
+	for i, l := range lines {
+		lines[i] = al.app.redact.redactString(l)
+	}
+	al.mu.Lock()
+	al.nextID++
+	alert := firedAlert{
+		ID:     al.nextID,
+		Rule:   r.Name,
+		Dir:    r.dir,
+		Path:   rel,
+		Time:   time.Now().Format(time.RFC3339),
+		Count:  count,
+		Window: r.window.String(),
+		Lines:  lines,
+	}
+	al.history = append(al.history, alert)
+	if len(al.history) > maxAlertHistory {
+		al.history = al.history[len(al.history)-maxAlertHistory:]
+	}
+	al.mu.Unlock()
+	log.Printf("[alerts] %q fired on %s (%d matches in %s)", r.Name, rel, count, r.window)
+
+	go func() {
+		var errs []string
+		if r.Notify {
+			body := fmt.Sprintf("%s: %d matching lines", rel, count)
+			if len(lines) > 0 {
+				body += "\n" + lines[len(lines)-1]
+			}
+			if err := desktopNotify("mdviewer alert: "+r.Name, body); err != nil {
+				errs = append(errs, "notify: "+err.Error())
+			}
+		}
+		if r.Webhook != "" {
+			if err := postAlertWebhook(r.Webhook, alert); err != nil {
+				errs = append(errs, "webhook: "+err.Error())
+			}
+		}
+		if r.Command != "" {
+			if !al.commands {
+				errs = append(errs, "command: hooks are disabled (start mdviewer with -alert-commands)")
+			} else if err := al.runAlertCommand(r, alert); err != nil {
+				errs = append(errs, "command: "+err.Error())
+			}
+		}
+		if len(errs) == 0 {
+			return
+		}
+		for _, e := range errs {
+			log.Printf("[alerts] %q: %s", r.Name, e)
+		}
+		al.mu.Lock()
+		for i := range al.history {
+			if al.history[i].ID == alert.ID {
+				al.history[i].Errors = errs
+			}
+		}
+		al.mu.Unlock()
+	}()
+}
+
+// desktopNotify shows a desktop notification with the platform's tool:
+// osascript on macOS, PowerShell on Windows and notify-send elsewhere.
+func desktopNotify(title, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertHookTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(body), strconv.Quote(title))
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "windows":
+		script := `Add-Type -AssemblyName System.Windows.Forms; $n = New-Object System.Windows.Forms.NotifyIcon; ` +
+			`$n.Icon = [System.Drawing.SystemIcons]::Warning; $n.Visible = $true; ` +
+			`$n.ShowBalloonTip(10000, $env:MDVIEWER_TITLE, $env:MDVIEWER_BODY, 'Warning'); Start-Sleep -Seconds 10; $n.Dispose()`
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", script)
+		cmd.Env = append(os.Environ(), "MDVIEWER_TITLE="+title, "MDVIEWER_BODY="+body)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--", title, body)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// postAlertWebhook POSTs the alert as JSON.
+func postAlertWebhook(target string, alert firedAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertHookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mdviewer-alerts")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// runAlertCommand runs a rule's command hook through the shell, in the
+// directory of its .mdviewer file. The alert is passed as JSON on stdin and
+// summarised in MDVIEWER_ALERT_* environment variables.
+func (al *logAlerter) runAlertCommand(r *alertRule, alert firedAlert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertHookTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", r.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", r.Command)
+	}
+	cmd.Dir = filepath.Join(al.app.root, filepath.FromSlash(r.dir))
+	last := ""
+	if len(alert.Lines) > 0 {
+		last = alert.Lines[len(alert.Lines)-1]
+	}
+	cmd.Env = append(os.Environ(),
+		"MDVIEWER_ALERT_RULE="+alert.Rule,
+		"MDVIEWER_ALERT_PATH="+alert.Path,
+		"MDVIEWER_ALERT_COUNT="+strconv.Itoa(alert.Count),
+		"MDVIEWER_ALERT_LINE="+last,
+	)
+	payload, _ := json.Marshal(alert)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// alertRuleResponse is a stored rule returned to the client with the
+// directory of its .mdviewer file and any validation error.
+type alertRuleResponse struct {
+	logAlertRule
+	Dir   string `json:"dir"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleLogAlerts lists the alert rules applying to a log file (its own
+// directory and ancestors, like views), or every rule when path is empty.
+func (a *app) handleLogAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var relPath string
+	if raw := r.URL.Query().Get("path"); raw != "" {
+		var err error
+		if relPath, err = sanitizeRelativePath(raw); err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rules := []alertRuleResponse{}
+	add := func(relDir string, data mdviewerData) {
+		for _, stored := range data.LogAlerts {
+			resp := alertRuleResponse{logAlertRule: stored, Dir: relDir}
+			compiled, err := compileAlertRule(relDir, stored)
+			if err != nil {
+				resp.Error = err.Error()
+			} else if relPath != "" && !compiled.appliesTo(relPath) {
+				continue
+			}
+			rules = append(rules, resp)
+		}
+	}
+	if relPath == "" {
+		_ = filepath.WalkDir(a.root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || d.Name() != mdviewerFile {
+				return nil
+			}
+			relDir, rerr := filepath.Rel(a.root, filepath.Dir(p))
+			if rerr != nil {
+				return nil
+			}
+			if relDir = filepath.ToSlash(relDir); relDir == "." {
+				relDir = ""
+			}
+			if data, rerr := readMdviewerFile(filepath.Dir(p)); rerr == nil {
+				add(relDir, data)
+			}
+			return nil
+		})
+	} else {
+		for _, relDir := range logViewDirs(relPath) {
+			dirFull := a.root
+			if relDir != "" {
+				var err error
+				if dirFull, err = secureJoin(a.root, relDir); err != nil {
+					continue
+				}
+			}
+			if data, err := readMdviewerFile(dirFull); err == nil {
+				add(relDir, data)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]any{"rules": rules, "commands": a.alerts.commands})
+}
+
+// handleLogAlertSave upserts an alert rule into the .mdviewer file of the
+// log file's own directory. Webhook and command hooks make the server reach
+// out or run programs, so they are only taken from .mdviewer files edited
+// by hand: the request may not set them, and an updated rule keeps its own.
+func (a *app) handleLogAlertSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	var rule logAlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Webhook != "" || rule.Command != "" {
+		http.Error(w, "webhook and command hooks can only be set by editing .mdviewer", http.StatusBadRequest)
+		return
+	}
+	relDir, dirFull, err := a.logDir(relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if _, err := compileAlertRule(relDir, rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := readMdviewerFile(dirFull)
+	if err != nil {
+		http.Error(w, "failed to read alerts", http.StatusInternalServerError)
+		return
+	}
+	updated := false
+	for i := range data.LogAlerts {
+		if data.LogAlerts[i].Name == rule.Name {
+			rule.Webhook, rule.Command = data.LogAlerts[i].Webhook, data.LogAlerts[i].Command
+			data.LogAlerts[i] = rule
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		data.LogAlerts = append(data.LogAlerts, rule)
+	}
+	if err := writeMdviewerFile(dirFull, data); err != nil {
+		http.Error(w, "failed to save alert", http.StatusInternalServerError)
+		return
+	}
+	a.alerts.requestRescan()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "dir": relDir})
+}
+
+// handleLogAlertDelete removes an alert rule, searching from the log file's
+// own directory upward like view deletion.
+func (a *app) handleLogAlertDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	dirs := logViewDirs(relPath)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirFull := a.root
+		if dirs[i] != "" {
+			if dirFull, err = secureJoin(a.root, dirs[i]); err != nil {
+				continue
+			}
+		}
+		data, rerr := readMdviewerFile(dirFull)
+		if rerr != nil {
+			continue
+		}
+		for j := range data.LogAlerts {
+			if data.LogAlerts[j].Name != body.Name {
+				continue
+			}
+			data.LogAlerts = append(data.LogAlerts[:j], data.LogAlerts[j+1:]...)
+			if err := writeMdviewerFile(dirFull, data); err != nil {
+				http.Error(w, "failed to delete alert", http.StatusInternalServerError)
+				return
+			}
+			a.alerts.requestRescan()
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_ = json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+			return
+		}
+	}
+	http.Error(w, "alert not found", http.StatusNotFound)
+}
+
+// handleLogAlertHistory returns fired alerts, newest first, optionally for
+// one log (path) and after a given id (since) for polling.
+func (a *app) handleLogAlertHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var relPath string
+	if raw := q.Get("path"); raw != "" {
+		var err error
+		if relPath, err = sanitizeRelativePath(raw); err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+	var since int64
+	if raw := q.Get("since"); raw != "" {
+		var err error
+		if since, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if raw := q.Get("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(v, maxAlertHistory)
+	}
+
+	a.alerts.mu.Lock()
+	alerts := []firedAlert{}
+	for i := len(a.alerts.history) - 1; i >= 0 && len(alerts) < limit; i-- {
+		h := a.alerts.history[i]
+		if h.ID > since && (relPath == "" || h.Path == relPath) {
+			alerts = append(alerts, h)
+		}
+	}
+	watching := make([]string, 0, len(a.alerts.watches))
+	for rel := range a.alerts.watches {
+		watching = append(watching, rel)
+	}
+	a.alerts.mu.Unlock()
+	sort.Strings(watching)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]any{"alerts": alerts, "watching": watching})
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxDecompressedLogBytes caps the size of a decompressed log (or log set)
+// so a corrupt or hostile archive cannot fill the temp directory.
+const maxDecompressedLogBytes = 4 << 30 // 4 GiB
+
+var (
+	// logNameRe matches log file names including rotated and compressed
+	// variants: app.log, app.log.1, app.log.2.gz, app.log-20261015,
+	// app-2026-10-15.jsonl.gz, events.ndjson.zst.
+	logNameRe = regexp.MustCompile(`(?i)\.(?:log|jsonl|ndjson)(?:[.-]\d[\d-]*)?(?:\.(?:gz|zst))?$`)
+	// logSeqSuffixRe matches a numeric rotation suffix: app.log.3
+	logSeqSuffixRe = regexp.MustCompile(`^(.+)\.(\d+)$`)
+	// logDateSuffixRe matches a date rotation suffix: app.log-20261015
+	logDateSuffixRe = regexp.MustCompile(`(?i)^(.+\.(?:log|jsonl|ndjson))[.-](\d{4}-?\d{2}-?\d{2}[\d-]*)$`)
+	// logDateInfixRe matches a date before the extension: app-2026-10-15.jsonl
+	logDateInfixRe = regexp.MustCompile(`(?i)^(.+?)[-_.](\d{4}-?\d{2}-?\d{2}(?:[-_T]?\d{2,6})?)(\.(?:log|jsonl|ndjson))$`)
+)
+
+// logCompression returns "gzip" or "zstd" for compressed logs, or "".
+func logCompression(p string) string {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".gz":
+		return "gzip"
+	case ".zst":
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// logRotation describes a file's place in its rotation family: the name of
+// the live file it was rotated from, and the date or sequence number of the
+// rotation. The live file itself has neither.
+type logRotation struct {
+	Family string // file name of the live log, e.g. "app.log"
+	Date   string // digits of a date suffix or infix, e.g. "20261015"
+	Seq    int    // numeric suffix; higher is older
+}
+
+// parseLogRotation splits a log file name into its rotation family and
+// position.
+func parseLogRotation(name string) logRotation {
+	base := name
+	if logCompression(base) != "" {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if m := logSeqSuffixRe.FindStringSubmatch(base); m != nil && isPlainLogName(m[1]) {
+		n, _ := strconv.Atoi(m[2])
+		return logRotation{Family: m[1], Seq: n}
+	}
+	if m := logDateSuffixRe.FindStringSubmatch(base); m != nil {
+		return logRotation{Family: m[1], Date: strings.NewReplacer("-", "", "_", "", "T", "").Replace(m[2])}
+	}
+	if m := logDateInfixRe.FindStringSubmatch(base); m != nil {
+		return logRotation{Family: m[1] + m[3], Date: strings.NewReplacer("-", "", "_", "", "T", "").Replace(m[2])}
+	}
+	return logRotation{Family: base}
+}
+
+// isPlainLogName reports whether name has a log extension and no rotation
+// or compression suffix.
+func isPlainLogName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".log", ".jsonl", ".ndjson":
+		return true
+	default:
+		return false
+	}
+}
+
+// isArchivedLog reports whether p is a rotated or compressed log, which is
+// read-only: it cannot be live-tailed or cleared.
+func isArchivedLog(p string) bool {
+	return logCompression(p) != "" || !isPlainLogName(path.Base(p))
+}
+
+// logSetMember is one file of a rotation family.
+type logSetMember struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Compressed bool   `json:"compressed"`
+	Live       bool   `json:"live"`
+	rotation   logRotation
+}
+
+// logSetMembers lists the rotation family of the log relPath, oldest first
+// and ending with the live file (when it exists).
+func logSetMembers(root, relPath string) ([]logSetMember, error) {
+	dir := path.Dir(relPath)
+	family := parseLogRotation(path.Base(relPath)).Family
+	fullDir, err := secureJoin(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(fullDir)
+	if err != nil {
+		return nil, err
+	}
+	var members []logSetMember
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !isLogFile(name) {
+			continue
+		}
+		rot := parseLogRotation(name)
+		if rot.Family != family {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		rel := name
+		if dir != "." {
+			rel = dir + "/" + name
+		}
+		members = append(members, logSetMember{
+			Path:       rel,
+			Size:       info.Size(),
+			Compressed: logCompression(name) != "",
+			Live:       name == family,
+			rotation:   rot,
+		})
+	}
+	// Dated rotations sort by date, numbered ones by descending number
+	// (app.log.3 is older than app.log.1), and the live file comes last.
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if a.Live != b.Live {
+			return b.Live
+		}
+		if (a.rotation.Date != "") != (b.rotation.Date != "") {
+			return a.rotation.Date != ""
+		}
+		if a.rotation.Date != b.rotation.Date {
+			return a.rotation.Date < b.rotation.Date
+		}
+		return a.rotation.Seq > b.rotation.Seq
+	})
+	return members, nil
+}
+
+// logFileCache holds decompressed copies of compressed logs and
+// concatenations of log sets in a private temp directory, so the viewer's
+// random-access readers (paging, seeking, search) work on them unchanged.
+// An entry is rebuilt when its sources change, and the least recently used
+// entries are removed once the cache holds more than maxLogCacheEntries
+// files or maxLogCacheBytes.
+type logFileCache struct {
+	mu      sync.Mutex // guards the fields below and each entry's size and use
+	dir     string
+	entries map[string]*logCacheEntry // keyed by source path or set family
+	size    int64                     // bytes held by built entries
+	clock   int64                     // advances on every use, for LRU order
+	// index holds line indexes keyed by cached file name; an entry's index
+	// is dropped with it.
+	index *logIndexCache
+}
+
+// logCacheEntry is one cached file. Evicted entries stay in the map with
+// no file; they are small and keyed by files on disk.
+type logCacheEntry struct {
+	// mu is held while the entry is built or opened, so concurrent requests
+	// for the same archive decompress it once without blocking other keys,
+	// and eviction cannot remove the file before it is open.
+	mu   sync.Mutex
+	sig  string // identifies the source versions the file was built from
+	path string // "" when not built
+	size int64
+	used int64
+}
+
+const (
+	maxLogCacheEntries = 32
+	maxLogCacheBytes   = 8 << 30 // 8 GiB, two copies of the largest log
+)
+
+func newLogFileCache(index *logIndexCache) *logFileCache {
+	return &logFileCache{entries: make(map[string]*logCacheEntry), index: index}
+}
+
+// cleanup removes the cache directory. The cache must not be used after.
+func (c *logFileCache) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dir != "" {
+		os.RemoveAll(c.dir)
+		c.dir = ""
+	}
+	c.entries = make(map[string]*logCacheEntry)
+	c.size = 0
+}
+
+// sourceSig identifies the current version of a set of files.
+func sourceSig(paths []string) (string, error) {
+	h := sha256.New()
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", p, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// build opens the cached file for key, (re)creating it from sources with
+// fill when the sources changed. Only the entry's lock is held while
+// building, so other archives stay readable meanwhile.
+func (c *logFileCache) build(key string, sources []string, fill func(w io.Writer) error) (*os.File, error) {
+	sig, err := sourceSig(sources)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	e := c.entries[key]
+	if e == nil {
+		e = &logCacheEntry{}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.path != "" && e.sig == sig {
+		if f, err := os.Open(e.path); err == nil {
+			c.mu.Lock()
+			c.clock++
+			e.used = c.clock
+			c.mu.Unlock()
+			return f, nil
+		}
+	}
+	c.mu.Lock()
+	c.release(e)
+	if c.dir == "" {
+		dir, err := os.MkdirTemp("", "mdviewer-logs-")
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.dir = dir
+	}
+	dir := c.dir
+	c.mu.Unlock()
+
+	tmp, err := os.CreateTemp(dir, "log-*")
+	if err != nil {
+		return nil, err
+	}
+	lw := &limitedWriter{w: tmp, n: maxDecompressedLogBytes}
+	err = fill(lw)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.Open(tmp.Name())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	c.mu.Lock()
+	e.sig, e.path, e.size = sig, tmp.Name(), maxDecompressedLogBytes-lw.n
+	c.size += e.size
+	c.clock++
+	e.used = c.clock
+	c.evict(e)
+	c.mu.Unlock()
+	return f, nil
+}
+
+// release removes the file of e. c.mu and e.mu are held.
+func (c *logFileCache) release(e *logCacheEntry) {
+	if e.path == "" {
+		return
+	}
+	os.Remove(e.path)
+	if c.index != nil {
+		c.index.drop(e.path)
+	}
+	c.size -= e.size
+	e.sig, e.path, e.size = "", "", 0
+}
+
+// evict removes least recently used files, other than keep's, until the
+// cache is within its bounds. Entries being built or opened are skipped;
+// files already open stay readable. c.mu is held.
+func (c *logFileCache) evict(keep *logCacheEntry) {
+	busy := make(map[*logCacheEntry]bool)
+	for {
+		n := 0
+		var victim *logCacheEntry
+		for _, e := range c.entries {
+			if e.path == "" {
+				continue
+			}
+			n++
+			if e != keep && !busy[e] && (victim == nil || e.used < victim.used) {
+				victim = e
+			}
+		}
+		if victim == nil || (n <= maxLogCacheEntries && c.size <= maxLogCacheBytes) {
+			return
+		}
+		if !victim.mu.TryLock() {
+			busy[victim] = true
+			continue
+		}
+		c.release(victim)
+		victim.mu.Unlock()
+	}
+}
+
+// limitedWriter fails once more than n bytes have been written.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+var errLogTooLarge = errors.New("decompressed log is too large")
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errLogTooLarge
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
+
+// decompressLog writes the decompressed contents of fullPath to w. gzip is
+// handled in-process; zstd needs the zstd command on PATH.
+func decompressLog(w io.Writer, fullPath string) error {
+	switch logCompression(fullPath) {
+	case "gzip":
+		f, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(w, zr)
+		return err
+	case "zstd":
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return errors.New("zstd is not installed")
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command("zstd", "-dc", "--", fullPath)
+		cmd.Stdout = w
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("zstd: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	default:
+		f, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+}
+
+// logReader is an open log: the file itself, the decompressed copy of an
+// archive, or a log set read as one file. Name identifies the contents, so
+// it can key the line index.
+type logReader interface {
+	io.ReaderAt
+	io.ReadSeekCloser
+	Name() string
+	Stat() (os.FileInfo, error)
+}
+
+// openLog opens a log for reading. Compressed logs are decompressed to the
+// cache first. With set, the whole rotation family of relPath is opened as
+// one file, oldest member first: the archived members are concatenated in
+// the cache and the live log is read in place after them, so appends to it
+// do not rebuild the copy.
+func (a *app) openLog(relPath, fullPath string, set bool) (logReader, error) {
+	if set {
+		members, err := logSetMembers(a.root, relPath)
+		if err != nil {
+			return nil, err
+		}
+		sources := make([]string, 0, len(members))
+		for _, m := range members {
+			p, err := secureJoin(a.root, m.Path)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, p)
+		}
+		if len(sources) == 0 {
+			return nil, os.ErrNotExist
+		}
+		live := ""
+		if last := len(members) - 1; members[last].Live && logCompression(sources[last]) == "" {
+			live, sources = sources[last], sources[:last]
+		}
+		if len(sources) == 0 {
+			return os.Open(live)
+		}
+		key := "set:" + filepath.Join(filepath.Dir(fullPath), parseLogRotation(filepath.Base(fullPath)).Family)
+		archive, err := a.logFiles.build(key, sources, func(w io.Writer) error {
+			j := &lineJoiner{w: w}
+			for _, src := range sources {
+				if err := decompressLog(j, src); err != nil {
+					return err
+				}
+				if j.last != 0 && j.last != '\n' {
+					if _, err := j.Write([]byte{'\n'}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if live == "" {
+			return archive, nil
+		}
+		return newLogSetReader(archive, live)
+	}
+	if logCompression(fullPath) == "" {
+		return os.Open(fullPath)
+	}
+	f, err := a.logFiles.build(fullPath, []string{fullPath}, func(w io.Writer) error {
+		return decompressLog(w, fullPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// logSetReader reads a log set's concatenated archived members followed by
+// its live log. Each archived member ends with a newline, so the live log
+// starts on a line of its own.
+type logSetReader struct {
+	archive *os.File
+	live    *os.File
+	split   int64 // size of archive
+	pos     int64
+}
+
+func newLogSetReader(archive *os.File, livePath string) (*logSetReader, error) {
+	info, err := archive.Stat()
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+	live, err := os.Open(livePath)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+	return &logSetReader{archive: archive, live: live, split: info.Size()}, nil
+}
+
+// Name is the archive copy's name, which changes whenever a member is
+// rotated in.
+func (s *logSetReader) Name() string { return s.archive.Name() }
+
+// logSetInfo describes a log set: the live log's file info with the size of
+// the whole set.
+type logSetInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i logSetInfo) Size() int64 { return i.size }
+
+func (s *logSetReader) Stat() (os.FileInfo, error) {
+	info, err := s.live.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return logSetInfo{FileInfo: info, size: s.split + info.Size()}, nil
+}
+
+func (s *logSetReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < s.split {
+		m, err := s.archive.ReadAt(p[:min(int64(len(p)), s.split-off)], off)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		off += int64(m)
+		if off < s.split {
+			return n, io.ErrUnexpectedEOF // the archive copy shrank
+		}
+	}
+	m, err := s.live.ReadAt(p[n:], off-s.split)
+	return n + m, err
+}
+
+func (s *logSetReader) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *logSetReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		info, err := s.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += info.Size()
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *logSetReader) Close() error {
+	err := s.archive.Close()
+	if lerr := s.live.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// sameLogFile reports whether two infos describe the same log, as
+// os.SameFile does for plain files.
+func sameLogFile(a, b os.FileInfo) bool {
+	if sa, ok := a.(logSetInfo); ok {
+		sb, ok := b.(logSetInfo)
+		return ok && os.SameFile(sa.FileInfo, sb.FileInfo)
+	}
+	if _, ok := b.(logSetInfo); ok {
+		return false
+	}
+	return os.SameFile(a, b)
+}
+
+// lineJoiner passes writes through, remembering the last byte written so a
+// log set can terminate a member's unfinished last line before the next.
+type lineJoiner struct {
+	w    io.Writer
+	last byte
+}
+
+func (j *lineJoiner) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		j.last = p[len(p)-1]
+	}
+	return j.w.Write(p)
+}
+
+// handleLogSet lists the rotation family of a log file (app.log.2.gz,
+// app.log.1, app.log, ...), oldest first. Pass set=1 to /api/log,
+// /api/log/search or /api/log/seek to read the family as one file.
+func (a *app) handleLogSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	members, err := logSetMembers(a.root, relPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to list log set", http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []logSetMember{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path    string         `json:"path"`
+		Family  string         `json:"family"`
+		Members []logSetMember `json:"members"`
+	}{
+		Path:    relPath,
+		Family:  parseLogRotation(path.Base(relPath)).Family,
+		Members: members,
+	})
+}
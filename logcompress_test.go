@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLogRotation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want logRotation
+	}{
+		{"app.log", logRotation{Family: "app.log"}},
+		{"app.log.1", logRotation{Family: "app.log", Seq: 1}},
+		{"app.log.12.gz", logRotation{Family: "app.log", Seq: 12}},
+		{"events.ndjson.zst", logRotation{Family: "events.ndjson"}},
+		{"app.log-20261015", logRotation{Family: "app.log", Date: "20261015"}},
+		{"app.log-2026-10-15.gz", logRotation{Family: "app.log", Date: "20261015"}},
+		{"app.log-20261018-130534", logRotation{Family: "app.log", Date: "20261018130534"}},
+		{"app-2026-10-15.jsonl.gz", logRotation{Family: "app.jsonl", Date: "20261015"}},
+		{"app_20261015T0930.log", logRotation{Family: "app.log", Date: "202610150930"}},
+		{"notes.txt.1", logRotation{Family: "notes.txt.1"}},
+	}
+	for _, tt := range tests {
+		if got := parseLogRotation(tt.in); got != tt.want {
+			t.Errorf("parseLogRotation(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLogSetMembers(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "logs")
+	if err := os.MkdirAll(filepath.Join(dir, "app.log.9"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{"app.log", "app.log.1", "app.log.2.gz", "app.log-20261016.gz", "app.log-20261015", "other.log", "other.log.1", "app.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(n), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type member struct {
+		Path             string
+		Size             int64
+		Compressed, Live bool
+	}
+	want := []member{
+		{"logs/app.log-20261015", 16, false, false},
+		{"logs/app.log-20261016.gz", 19, true, false},
+		{"logs/app.log.2.gz", 12, true, false},
+		{"logs/app.log.1", 9, false, false},
+		{"logs/app.log", 7, false, true},
+	}
+	tests := []struct {
+		name string
+		rel  string
+		want []member
+	}{
+		{"from the live log", "logs/app.log", want},
+		{"from a backup", "logs/app.log.2.gz", want},
+		{"another family", "logs/other.log.1", []member{{"logs/other.log.1", 11, false, false}, {"logs/other.log", 9, false, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := logSetMembers(root, tt.rel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []member
+			for _, m := range members {
+				got = append(got, member{m.Path, m.Size, m.Compressed, m.Live})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logSetMembers(%q) = %+v, want %+v", tt.rel, got, tt.want)
+			}
+		})
+	}
+	if _, err := logSetMembers(root, "../outside/app.log"); err == nil {
+		t.Error("logSetMembers accepted a path outside the root")
+	}
+}
+
+func TestLogFileCacheEvicts(t *testing.T) {
+	src := t.TempDir()
+	c := newLogFileCache(nil)
+	defer c.cleanup()
+	build := func(i int) *os.File {
+		t.Helper()
+		p := filepath.Join(src, fmt.Sprintf("app.log.%d.gz", i))
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := c.build(p, []string{p}, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "line %d\n", i)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	first := build(0)
+	defer first.Close()
+	for i := 1; i <= maxLogCacheEntries; i++ {
+		build(i).Close()
+	}
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != maxLogCacheEntries {
+		t.Errorf("cache holds %d files, want %d", len(files), maxLogCacheEntries)
+	}
+	if c.entries[filepath.Join(src, "app.log.0.gz")].path != "" {
+		t.Error("least recently used entry was kept")
+	}
+	if b, err := io.ReadAll(first); err != nil || string(b) != "line 0\n" {
+		t.Errorf("open evicted file reads %q, %v", b, err)
+	}
+	var want int64
+	for i := 1; i <= maxLogCacheEntries; i++ {
+		want += int64(len(fmt.Sprintf("line %d\n", i)))
+	}
+	if c.size != want {
+		t.Errorf("size = %d, want %d", c.size, want)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// maxEntryBytes bounds the text of one entry returned by /api/log/search;
+// longer entries (huge stack dumps) are cut.
+const maxEntryBytes = 64 << 10
+
+// entryRule decides which lines start a new log entry. The lines after a
+// start up to the next one (stack traces, wrapped messages) belong to it.
+type entryRule struct {
+	kind string // "timestamp", "indent" or "regex"
+	re   *regexp.Regexp
+	ref  time.Time // year for syslog timestamps
+}
+
+// parseEntryRule reads the entries and entryStart parameters:
+//
+//	entries=timestamp   a line carrying a timestamp starts an entry
+//	entries=indent      a line not starting with whitespace starts an entry
+//	entryStart=<regexp> a line matching the expression starts an entry
+//
+// It returns nil for entries=line or no parameters, meaning every physical
+// line is its own entry.
+func parseEntryRule(params url.Values, ref time.Time) (*entryRule, error) {
+	mode, pattern := params.Get("entries"), params.Get("entryStart")
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("invalid entryStart: " + err.Error())
+		}
+		return &entryRule{kind: "regex", re: re}, nil
+	}
+	switch mode {
+	case "", "line":
+		return nil, nil
+	case "timestamp", "indent":
+		return &entryRule{kind: mode, ref: ref}, nil
+	case "regex":
+		return nil, errors.New("entries=regex needs entryStart")
+	}
+	return nil, errors.New("invalid entries")
+}
+
+// starts reports whether line begins a new entry.
+func (r *entryRule) starts(line []byte) bool {
+	switch r.kind {
+	case "timestamp":
+		_, ok := detectLogTime(line, r.ref)
+		return ok
+	case "indent":
+		return len(line) > 0 && line[0] != ' ' && line[0] != '\t'
+	default:
+		return r.re.Match(line)
+	}
+}
+
+// entryScanner finds the lines starting entries in a log read in chunks
+// that need not end on a line boundary.
+type entryScanner struct {
+	rule    *entryRule
+	partial []byte
+	at      int64 // offset of partial
+}
+
+// feed scans data, which begins at offset, and returns the offsets of the
+// entry starts among the lines it completes. An unfinished last line is
+// kept for the next call.
+func (s *entryScanner) feed(data []byte, offset int64) []int64 {
+	starts := []int64{}
+	if len(s.partial) == 0 {
+		s.at = offset
+	}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			s.partial = append(s.partial, data...)
+			break
+		}
+		line := append(s.partial, data[:i]...)
+		if s.rule.starts(bytes.TrimSuffix(line, []byte{'\r'})) {
+			starts = append(starts, s.at)
+		}
+		s.at += int64(len(line)) + 1
+		s.partial = s.partial[:0]
+		data = data[i+1:]
+	}
+	return starts
+}
+
+// flush judges the unfinished last line as it stands.
+func (s *entryScanner) flush() []int64 {
+	starts := []int64{}
+	if len(s.partial) > 0 && s.rule.starts(s.partial) {
+		starts = append(starts, s.at)
+	}
+	s.partial = nil
+	return starts
+}
+
+// newEntryScanner returns a scanner positioned at offset of f. When offset
+// falls inside a line, the start of that line is read first so the line is
+// judged whole.
+func newEntryScanner(f logReader, rule *entryRule, offset int64) (*entryScanner, error) {
+	s := &entryScanner{rule: rule, at: offset}
+	if offset <= 0 {
+		return s, nil
+	}
+	ls, err := lineStartBefore(f, offset+1) // start of the line holding offset
+	if err != nil {
+		return nil, err
+	}
+	if ls < offset {
+		prefix, err := readLogRange(f, ls, offset)
+		if err != nil {
+			return nil, err
+		}
+		s.partial, s.at = prefix, ls
+	}
+	return s, nil
+}
+
+// logEntryStarts returns the offsets of the entry starts within content,
+// which was read from f at offset. A final line without a newline is
+// judged as it stands.
+func logEntryStarts(f logReader, rule *entryRule, offset int64, content []byte) ([]int64, error) {
+	s, err := newEntryScanner(f, rule, offset)
+	if err != nil {
+		return nil, err
+	}
+	starts := s.feed(content, offset)
+	return append(starts, s.flush()...), nil
+}
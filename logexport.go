@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// exportSampleRecords is how many records are read to discover the columns
+// of an export when the view does not list them all.
+const exportSampleRecords = 10000
+
+// logPreferredColumns come first among discovered columns, as in the log
+// table.
+var logPreferredColumns = []string{"time", "timestamp", "ts", "date", "source", "level", "lvl", "severity", "logger", "name", "msg", "message"}
+
+// logExportFormats maps the format parameter to the download's content type
+// and file extension.
+var logExportFormats = map[string]struct{ contentType, ext string }{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"tsv":    {"text/tab-separated-values; charset=utf-8", "tsv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+}
+
+// findLogView returns the saved view called name that applies to relPath.
+// As in handleLogViews, a view in a deeper directory overrides a same-named
+// one above it.
+func (a *app) findLogView(relPath, name string) (logViewEntry, bool) {
+	var found logViewEntry
+	ok := false
+	for _, relDir := range logViewDirs(relPath) {
+		dirFull := a.root
+		if relDir != "" {
+			var err error
+			if dirFull, err = secureJoin(a.root, relDir); err != nil {
+				continue
+			}
+		}
+		data, err := readMdviewerFile(dirFull)
+		if err != nil {
+			continue
+		}
+		for _, v := range data.LogViews {
+			if v.Name == name {
+				found, ok = v, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// noisyPatternRegexps mines the templates of a log like /api/log/patterns
+// and returns the matchers of the n most frequent ones, which a view's
+// hidePatterns leaves out.
+func (a *app) noisyPatternRegexps(f logReader, size int64, n int) ([]*regexp.Regexp, error) {
+	tree := newDrainTree()
+	err := scanLogLines(io.NewSectionReader(f, 0, size), 0, func(offset int64, line []byte) bool {
+		if offset >= maxLogStatsScan {
+			return false
+		}
+		line = a.redact.redact(line)
+		if len(strings.TrimSpace(string(line))) == 0 {
+			return true
+		}
+		if c := tree.add(maskLogLine(string(line))); c != nil {
+			c.count++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tree.clusters, func(i, j int) bool { return tree.clusters[i].count > tree.clusters[j].count })
+	res := make([]*regexp.Regexp, 0, min(n, len(tree.clusters)))
+	for _, c := range tree.clusters[:min(n, len(tree.clusters))] {
+		if re, err := regexp.Compile(templateRegexp(c.tokens)); err == nil {
+			res = append(res, re)
+		}
+	}
+	return res, nil
+}
+
+// exportColumns orders columns like the log table: the view's saved order
+// first, then preferred and remaining keys in the order first seen, without
+// hidden ones.
+func exportColumns(cfg logViewConfig, sample []map[string]any) []string {
+	hidden := make(map[string]bool, len(cfg.Hidden))
+	for _, k := range cfg.Hidden {
+		hidden[k] = true
+	}
+	var seen []string
+	known := make(map[string]bool)
+	for _, k := range logPreferredColumns {
+		for _, rec := range sample {
+			if _, ok := rec[k]; ok {
+				seen = append(seen, k)
+				known[k] = true
+				break
+			}
+		}
+	}
+	for _, rec := range sample {
+		keys := make([]string, 0, len(rec))
+		for k := range rec {
+			if !known[k] {
+				keys = append(keys, k)
+			}
+		}
+		// Go maps are unordered; sorting keeps the export stable.
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen = append(seen, k)
+			known[k] = true
+		}
+	}
+	var cols []string
+	placed := make(map[string]bool)
+	for _, list := range [][]string{cfg.Order, seen} {
+		for _, k := range list {
+			if known[k] && !placed[k] && !hidden[k] {
+				cols = append(cols, k)
+				placed[k] = true
+			}
+		}
+	}
+	return cols
+}
+
+// tsvEscaper escapes the characters that would break a TSV cell.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// spreadsheetCell keeps a spreadsheet from reading a cell as a formula: a
+// value starting with =, +, -, @, tab or carriage return gets a leading
+// apostrophe, which spreadsheets hide.
+func spreadsheetCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportCell formats a record value for a CSV or TSV cell. Only strings
+// are escaped with spreadsheetCell; numbers and booleans are written as
+// they are, so a negative number stays a number.
+func exportCell(v any) string {
+	if s, ok := v.(string); ok {
+		return spreadsheetCell(s)
+	}
+	return fieldString(v)
+}
+
+// handleLogExport downloads the records of a log as CSV, NDJSON or TSV,
+// applying a saved view server-side to the whole file: its global and column
+// filters, hidden noisy templates and visible columns in their saved order.
+// Lines that do not parse as records are left out, as in the table.
+func (a *app) handleLogExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	relPath, err := sanitizeRelativePath(params.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	formatName := params.Get("format")
+	if formatName == "" {
+		formatName = "csv"
+	}
+	out, ok := logExportFormats[formatName]
+	if !ok {
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	var cfg logViewConfig
+	viewName := params.Get("view")
+	if viewName != "" {
+		view, ok := a.findLogView(relPath, viewName)
+		if !ok {
+			http.Error(w, "view not found", http.StatusNotFound)
+			return
+		}
+		if cfg, err = view.config(); err != nil {
+			http.Error(w, "invalid view config", http.StatusInternalServerError)
+			return
+		}
+	}
+	if list := params.Get("columns"); list != "" {
+		cfg.Order, cfg.Hidden = nil, nil
+		for _, k := range strings.Split(list, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				cfg.Order = append(cfg.Order, k)
+			}
+		}
+	}
+
+	f, err := a.openLog(relPath, fullPath, params.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	format := cfg.Format
+	if format == "" || format == "auto" {
+		if format, err = detectLogFileFormat(f); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	parse := logRecordParser(format)
+	var noisy []*regexp.Regexp
+	if cfg.HidePatterns > 0 {
+		if noisy, err = a.noisyPatternRegexps(f, info.Size(), cfg.HidePatterns); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	global := logQuery{Text: strings.ToLower(strings.TrimSpace(cfg.GlobalFilter))}
+	filters := make(map[string]string)
+	for k, v := range cfg.Filters {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			filters[k] = v
+		}
+	}
+	ctx := r.Context()
+	// each calls fn with every record the view keeps, in file order.
+	each := func(fn func(rec map[string]any) bool) error {
+		return scanLogLines(io.NewSectionReader(f, 0, info.Size()), 0, func(_ int64, line []byte) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			// Filters see the masked line, as in the table. The record is
+			// parsed from the raw line and masked afterwards, since masks
+			// can break the line's syntax (a key block in a JSON string).
+			masked := a.redact.redact(line)
+			if !global.match(masked) {
+				return true
+			}
+			for _, re := range noisy {
+				if re.Match(masked) {
+					return true
+				}
+			}
+			rec := parse(line)
+			if rec == nil {
+				return true
+			}
+			a.redact.redactRecord(rec)
+			for k, want := range filters {
+				if !strings.Contains(strings.ToLower(fieldString(rec[k])), want) {
+					return true
+				}
+			}
+			return fn(rec)
+		})
+	}
+
+	var columns []string
+	if params.Get("columns") != "" {
+		columns = cfg.Order
+	} else {
+		var sample []map[string]any
+		if err := each(func(rec map[string]any) bool {
+			sample = append(sample, rec)
+			return len(sample) < exportSampleRecords
+		}); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		columns = exportColumns(cfg, sample)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	if viewName != "" {
+		name += "-" + strings.Map(func(r rune) rune {
+			if r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+				return r
+			}
+			return '_'
+		}, viewName)
+	}
+	w.Header().Set("Content-Type", out.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + out.ext}))
+
+	// raw=1 turns off formula escaping for tools that read the file as data.
+	header, cell := spreadsheetCell, exportCell
+	if params.Get("raw") == "1" {
+		header, cell = func(s string) string { return s }, fieldString
+	}
+	bw := bufio.NewWriterSize(w, 64<<10)
+	defer bw.Flush()
+	row := make([]string, len(columns))
+	var write func(rec map[string]any) error
+	switch formatName {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		for i, k := range columns {
+			row[i] = header(k)
+		}
+		if err := cw.Write(row); err != nil {
+			return
+		}
+		write = func(rec map[string]any) error {
+			for i, k := range columns {
+				row[i] = cell(rec[k])
+			}
+			return cw.Write(row)
+		}
+		defer cw.Flush()
+	case "tsv":
+		for i, k := range columns {
+			row[i] = tsvEscaper.Replace(header(k))
+		}
+		if _, err := bw.WriteString(strings.Join(row, "\t") + "\n"); err != nil {
+			return
+		}
+		write = func(rec map[string]any) error {
+			for i, k := range columns {
+				row[i] = tsvEscaper.Replace(cell(rec[k]))
+			}
+			_, err := bw.WriteString(strings.Join(row, "\t") + "\n")
+			return err
+		}
+	case "ndjson":
+		// Keys keep the column order, which a map would lose.
+		write = func(rec map[string]any) error {
+			bw.WriteByte('{')
+			first := true
+			for _, k := range columns {
+				v, ok := rec[k]
+				if !ok {
+					continue
+				}
+				if !first {
+					bw.WriteByte(',')
+				}
+				first = false
+				key, _ := json.Marshal(k)
+				val, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				bw.Write(key)
+				bw.WriteByte(':')
+				bw.Write(val)
+			}
+			_, err := bw.WriteString("}\n")
+			return err
+		}
+	}
+	_ = each(func(rec map[string]any) bool {
+		return write(rec) == nil
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExportColumns(t *testing.T) {
+	sample := []map[string]any{
+		{"msg": "a", "zeta": 1, "level": "info", "alpha": true},
+		{"msg": "b", "time": "t", "beta": 2},
+	}
+	tests := []struct {
+		name string
+		cfg  logViewConfig
+		want []string
+	}{
+		{"preferred then sorted", logViewConfig{}, []string{"time", "level", "msg", "alpha", "zeta", "beta"}},
+		{"saved order first", logViewConfig{Order: []string{"beta", "msg"}}, []string{"beta", "msg", "time", "level", "alpha", "zeta"}},
+		{"hidden left out", logViewConfig{Hidden: []string{"zeta", "time"}}, []string{"level", "msg", "alpha", "beta"}},
+		{"unknown ordered key dropped", logViewConfig{Order: []string{"missing", "alpha"}}, []string{"alpha", "time", "level", "msg", "zeta", "beta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportColumns(tt.cfg, sample); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exportColumns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCell(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"-5", "'-5"},
+		{"=1+1", "'=1+1"},
+		{float64(-5), "-5"},
+		{-0.25, "-0.25"},
+		{true, "true"},
+		{nil, ""},
+		{map[string]any{"a": "=x"}, `{"a":"=x"}`},
+	}
+	for _, tt := range tests {
+		if got := exportCell(tt.in); got != tt.want {
+			t.Errorf("exportCell(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSpreadsheetCell(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1", "'+1"},
+		{"-2", "'-2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetCell(tt.in); got != tt.want {
+			t.Errorf("spreadsheetCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logFormat is a structured log line format. Parse returns the fields of a
+// line, or nil when the line is not in this format.
+type logFormat struct {
+	Name  string
+	Parse func(line []byte) map[string]any
+}
+
+// logFormats is the parser registry, in detection priority order: stricter
+// formats first, logfmt (which accepts any key=value text) last.
+var logFormats = []logFormat{
+	{Name: "json", Parse: parseJSONRecord},
+	{Name: "access", Parse: parseAccessLine},
+	{Name: "golog", Parse: parseGoLogLine},
+	{Name: "logfmt", Parse: parseLogfmtLine},
+}
+
+// rawLogFormat is reported when no parser matches most lines.
+const rawLogFormat = "raw"
+
+// lookupLogFormat returns the registered format with the given name.
+func lookupLogFormat(name string) (logFormat, bool) {
+	for _, f := range logFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return logFormat{}, false
+}
+
+const (
+	// logFormatSampleBytes and logFormatSampleLines bound the head of a
+	// file examined by detectLogFormat.
+	logFormatSampleBytes = 64 << 10
+	logFormatSampleLines = 100
+)
+
+// detectLogFormat samples the first lines of r and returns the name of the
+// format that parses most of them, or rawLogFormat when none parses at
+// least half.
+func detectLogFormat(r io.Reader) (string, error) {
+	var sample [][]byte
+	err := scanLogLines(io.LimitReader(r, logFormatSampleBytes), 0, func(_ int64, line []byte) bool {
+		if len(strings.TrimSpace(string(line))) > 0 {
+			sample = append(sample, append([]byte(nil), line...))
+		}
+		return len(sample) < logFormatSampleLines
+	})
+	if err != nil {
+		return "", err
+	}
+	best, bestCount := rawLogFormat, 0
+	for _, f := range logFormats {
+		n := 0
+		for _, line := range sample {
+			if f.Parse(line) != nil {
+				n++
+			}
+		}
+		if n > bestCount {
+			best, bestCount = f.Name, n
+		}
+	}
+	if bestCount == 0 || bestCount*2 < len(sample) {
+		return rawLogFormat, nil
+	}
+	return best, nil
+}
+
+// detectLogFileFormat detects the format of an open log from its head.
+func detectLogFileFormat(f logReader) (string, error) {
+	return detectLogFormat(io.NewSectionReader(f, 0, logFormatSampleBytes))
+}
+
+// logRecordParser returns the parser for format name. JSON lines are
+// always recognised, whatever the format, since many logs mix them in.
+func logRecordParser(name string) func([]byte) map[string]any {
+	f, ok := lookupLogFormat(name)
+	if !ok || f.Name == "json" {
+		return parseJSONRecord
+	}
+	return func(line []byte) map[string]any {
+		if rec := parseJSONRecord(line); rec != nil {
+			return rec
+		}
+		return f.Parse(line)
+	}
+}
+
+// logfmtKeyRe matches a logfmt key.
+var logfmtKeyRe = regexp.MustCompile(`^[A-Za-z_@][\w.@/-]*$`)
+
+// parseLogfmtLine parses logfmt (level=info msg="hello world" dur=3ms).
+// Every token must be a key=value pair; values may be double-quoted with
+// backslash escapes. Values are kept as strings.
+func parseLogfmtLine(line []byte) map[string]any {
+	s := strings.TrimSpace(string(line))
+	if s == "" {
+		return nil
+	}
+	rec := make(map[string]any)
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil
+		}
+		key := s[:eq]
+		if !logfmtKeyRe.MatchString(key) {
+			return nil
+		}
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil // unterminated quote
+			}
+			unq, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				unq = s[1:end]
+			}
+			val, s = unq, s[end+1:]
+			if s != "" && s[0] != ' ' && s[0] != '\t' {
+				return nil
+			}
+		} else if sp := strings.IndexAny(s, " \t"); sp >= 0 {
+			val, s = s[:sp], s[sp:]
+		} else {
+			val, s = s, ""
+		}
+		rec[key] = val
+		s = strings.TrimLeft(s, " \t")
+	}
+	return rec
+}
+
+// accessLineRe matches the Apache/nginx common and combined log formats.
+var accessLineRe = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?(.*)$`)
+
+// parseAccessLine parses an Apache/nginx access log line in common or
+// combined format. The time is normalised to RFC3339 and status and bytes
+// become numbers.
+func parseAccessLine(line []byte) map[string]any {
+	m := accessLineRe.FindSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	rec := map[string]any{
+		"remote_addr": string(m[1]),
+		"time":        string(m[4]),
+		"request":     string(m[5]),
+	}
+	if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m[4])); err == nil {
+		rec["time"] = t.Format(time.RFC3339)
+	}
+	if u := string(m[3]); u != "-" {
+		rec["remote_user"] = u
+	}
+	if parts := strings.SplitN(string(m[5]), " ", 3); len(parts) == 3 {
+		rec["method"], rec["path"], rec["protocol"] = parts[0], parts[1], parts[2]
+	}
+	status, _ := strconv.Atoi(string(m[6]))
+	rec["status"] = float64(status)
+	if b, err := strconv.Atoi(string(m[7])); err == nil {
+		rec["bytes"] = float64(b)
+	}
+	if len(m[8]) > 0 && string(m[8]) != "-" {
+		rec["referer"] = string(m[8])
+	}
+	if len(m[9]) > 0 && string(m[9]) != "-" {
+		rec["user_agent"] = string(m[9])
+	}
+	if extra := strings.TrimSpace(string(m[10])); extra != "" {
+		rec["extra"] = extra
+	}
+	return rec
+}
+
+var (
+	// goLogLineRe matches the standard library log package: an optional
+	// prefix, date and time, an optional file:line, then the message.
+	goLogLineRe = regexp.MustCompile(`^(?:(\S+?):?\s+)?(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(?:([\w./-]+\.go:\d+):\s+)?(.*)$`)
+	// goLogLevelRe matches a level at the start of a message: "ERROR: ...",
+	// "[warn] ...".
+	goLogLevelRe = regexp.MustCompile(`(?i)^\[?(trace|debug|info|warn|warning|error|fatal|panic)\]?:?\s+`)
+)
+
+// parseGoLogLine parses a line written by the Go log package. A JSON object
+// at the end of the message is merged into the record, so
+// `2026/10/18 09:15:02 request {"status":500}` yields a status field.
+func parseGoLogLine(line []byte) map[string]any {
+	m := goLogLineRe.FindSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	rec := map[string]any{"time": string(m[2])}
+	if t, err := time.ParseInLocation("2006/01/02 15:04:05.999999999", string(m[2]), time.Local); err == nil {
+		rec["time"] = t.Format(time.RFC3339Nano)
+	}
+	if len(m[1]) > 0 {
+		rec["prefix"] = string(m[1])
+	}
+	if len(m[3]) > 0 {
+		rec["caller"] = string(m[3])
+	}
+	msg := string(m[4])
+	if lm := goLogLevelRe.FindStringSubmatch(msg); lm != nil {
+		rec["level"] = strings.ToLower(lm[1])
+		msg = msg[len(lm[0]):]
+	}
+	if i := strings.IndexByte(msg, '{'); i >= 0 {
+		var payload map[string]any
+		if json.Unmarshal([]byte(msg[i:]), &payload) == nil {
+			for k, v := range payload {
+				rec[k] = v
+			}
+			msg = strings.TrimSpace(msg[:i])
+			if _, ok := payload["msg"]; ok && msg != "" {
+				rec["text"] = msg
+				msg = ""
+			}
+		}
+	}
+	if msg != "" {
+		rec["msg"] = msg
+	}
+	return rec
+}
+
+// maxLogParseLines bounds the lines parsed by one /api/log/parse request.
+const maxLogParseLines = 5000
+
+// handleLogParse parses log lines into structured records for the table
+// view. The format is taken from the request, or detected from the head of
+// path when it is "auto" or empty. records[i] is null when lines[i] did not
+// parse.
+func (a *app) handleLogParse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Path   string   `json:"path"`
+		Format string   `json:"format"`
+		Lines  []string `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Lines) > maxLogParseLines {
+		http.Error(w, "too many lines", http.StatusBadRequest)
+		return
+	}
+	format := req.Format
+	if format == "" || format == "auto" {
+		var err error
+		if format, err = a.detectFormatOf(req.Path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "file not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if _, ok := lookupLogFormat(format); !ok && format != rawLogFormat {
+		http.Error(w, "unknown format", http.StatusBadRequest)
+		return
+	}
+
+	records := make([]map[string]any, len(req.Lines))
+	if format != rawLogFormat {
+		parse := logRecordParser(format)
+		for i, line := range req.Lines {
+			records[i] = parse([]byte(line))
+			a.redact.redactRecord(records[i])
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Format  string           `json:"format"`
+		Records []map[string]any `json:"records"`
+	}{Format: format, Records: records})
+}
+
+// detectFormatOf detects the format of the log at relPath.
+func (a *app) detectFormatOf(relPath string) (string, error) {
+	rel, err := sanitizeRelativePath(relPath)
+	if err != nil || !isLogFile(rel) {
+		return "", errors.New("invalid path")
+	}
+	fullPath, err := secureJoin(a.root, rel)
+	if err != nil {
+		return "", errors.New("invalid path")
+	}
+	f, err := a.openLog(rel, fullPath, false)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return detectLogFileFormat(f)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLogfmtLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{"plain", "level=info msg=started dur=3ms", map[string]any{"level": "info", "msg": "started", "dur": "3ms"}},
+		{"quoted with escapes", `msg="hello \"world\"" path=/a`, map[string]any{"msg": `hello "world"`, "path": "/a"}},
+		{"empty value", "a= b=1", map[string]any{"a": "", "b": "1"}},
+		{"dotted key", "http.status=200\t@ts=now", map[string]any{"http.status": "200", "@ts": "now"}},
+		{"surrounding space", "  k=v  ", map[string]any{"k": "v"}},
+		{"empty", "", nil},
+		{"bare word", "level=info started", nil},
+		{"unterminated quote", `msg="oops`, nil},
+		{"text after quote", `msg="a"b`, nil},
+		{"bad key", "1x=2", nil},
+		{"prose", "the value was = 3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLogfmtLine([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLogfmtLine(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAccessLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "common",
+			in:   `127.0.0.1 - frank [10/Oct/2026:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326`,
+			want: map[string]any{
+				"remote_addr": "127.0.0.1", "remote_user": "frank", "time": "2026-10-10T13:55:36-07:00",
+				"request": "GET /a.gif HTTP/1.0", "method": "GET", "path": "/a.gif", "protocol": "HTTP/1.0",
+				"status": float64(200), "bytes": float64(2326),
+			},
+		},
+		{
+			name: "combined with extra fields",
+			in:   `10.0.0.2 - - [18/Oct/2026:09:00:00 +0000] "POST /api HTTP/1.1" 502 - "https://x/" "curl/8.0" 0.012`,
+			want: map[string]any{
+				"remote_addr": "10.0.0.2", "time": "2026-10-18T09:00:00Z",
+				"request": "POST /api HTTP/1.1", "method": "POST", "path": "/api", "protocol": "HTTP/1.1",
+				"status": float64(502), "referer": "https://x/", "user_agent": "curl/8.0", "extra": "0.012",
+			},
+		},
+		{
+			name: "malformed request and bad time",
+			in:   `::1 - - [yesterday] "\x16\x03" 400 0 "-" "-"`,
+			want: map[string]any{
+				"remote_addr": "::1", "time": "yesterday", "request": `\x16\x03`,
+				"status": float64(400), "bytes": float64(0),
+			},
+		},
+		{"not an access line", "2026-10-18 INFO started", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAccessLine([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAccessLine(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGoLogLine(t *testing.T) {
+	local := func(s string) string {
+		tm, err := time.ParseInLocation("2006/01/02 15:04:05.999999999", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.Format(time.RFC3339Nano)
+	}
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{"plain", "2026/10/18 09:15:02 server started", map[string]any{"time": local("2026/10/18 09:15:02"), "msg": "server started"}},
+		{
+			name: "prefix, microseconds and caller",
+			in:   "api: 2026/10/18 09:15:02.123456 main.go:42: listening",
+			want: map[string]any{"time": local("2026/10/18 09:15:02.123456"), "prefix": "api", "caller": "main.go:42", "msg": "listening"},
+		},
+		{"level", "2026/10/18 09:15:02 [WARN] disk low", map[string]any{"time": local("2026/10/18 09:15:02"), "level": "warn", "msg": "disk low"}},
+		{"level with colon", "2026/10/18 09:15:02 ERROR: failed", map[string]any{"time": local("2026/10/18 09:15:02"), "level": "error", "msg": "failed"}},
+		{
+			name: "json payload",
+			in:   `2026/10/18 09:15:02 request {"status":500,"path":"/x"}`,
+			want: map[string]any{"time": local("2026/10/18 09:15:02"), "msg": "request", "status": float64(500), "path": "/x"},
+		},
+		{
+			name: "json payload with msg",
+			in:   `2026/10/18 09:15:02 request {"msg":"done"}`,
+			want: map[string]any{"time": local("2026/10/18 09:15:02"), "text": "request", "msg": "done"},
+		},
+		{"braces that are not json", "2026/10/18 09:15:02 map{a:1}", map[string]any{"time": local("2026/10/18 09:15:02"), "msg": "map{a:1}"}},
+		{"no timestamp", "server started", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseGoLogLine([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGoLogLine(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxHistBuckets bounds the buckets returned by /api/log/histogram.
+	maxHistBuckets = 5000
+	// autoHistBuckets is the bucket count aimed for when bucket=auto.
+	autoHistBuckets = 120
+	// maxHistTailProbe bounds the bytes read from the end of a file to find
+	// its last timestamp.
+	maxHistTailProbe = 1 << 20
+)
+
+// histBucketSizes are the widths bucket=auto chooses from.
+var histBucketSizes = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// logLevelKeys are the record fields holding a level, as in the table view.
+var logLevelKeys = []string{"level", "lvl", "severity"}
+
+// logLevelTextRe finds a level in a plain-text line: an upper-case word
+// (ERROR, WARN) or a bracketed one ([warn]). Lower-case bare words are
+// ignored since they appear in ordinary messages ("no error").
+var logLevelTextRe = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL|CRITICAL|PANIC)\b|\[(?i:(trace|debug|info|warn|warning|error|fatal|critical|panic))\]`)
+
+// normalizeLogLevel maps level spellings onto the names the viewer colours:
+// trace, debug, info, warn, error and fatal. Anything else is "other".
+func normalizeLogLevel(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return "trace"
+	case "debug", "dbug":
+		return "debug"
+	case "info", "information", "notice":
+		return "info"
+	case "warn", "warning":
+		return "warn"
+	case "error", "err", "eror":
+		return "error"
+	case "fatal", "critical", "crit", "panic", "alert", "emerg":
+		return "fatal"
+	}
+	return "other"
+}
+
+// detectLogLevel returns the normalised level of a line from its parsed
+// record, or from the text when it did not parse. It returns "" when the
+// line carries no level.
+func detectLogLevel(rec map[string]any, line []byte) string {
+	if rec != nil {
+		for _, key := range logLevelKeys {
+			if v, ok := rec[key]; ok {
+				return normalizeLogLevel(fieldString(v))
+			}
+		}
+		return ""
+	}
+	if len(line) > 256 {
+		line = line[:256]
+	}
+	if m := logLevelTextRe.FindSubmatch(line); m != nil {
+		if len(m[1]) > 0 {
+			return normalizeLogLevel(string(m[1]))
+		}
+		return normalizeLogLevel(string(m[2]))
+	}
+	return ""
+}
+
+// histBucket is the number of lines in one time bucket, by level. Lines
+// without a level are counted under "unknown".
+type histBucket struct {
+	Time   string         `json:"time"`
+	Total  int            `json:"total"`
+	Levels map[string]int `json:"levels"`
+}
+
+// lastTimestamp returns the last timestamp in the final maxHistTailProbe
+// bytes of f.
+func lastTimestamp(f logReader, size int64, ref time.Time) (time.Time, bool, error) {
+	var last time.Time
+	found := false
+	from := max(size-maxHistTailProbe, 0)
+	start, _, ok, err := nextTimestampedLine(f, from, size, ref)
+	if err != nil || !ok {
+		return last, false, err
+	}
+	err = scanLogLines(io.NewSectionReader(f, start, size-start), start, func(_ int64, line []byte) bool {
+		if t, ok := detectLogTime(line, ref); ok {
+			last, found = t, true
+		}
+		return true
+	})
+	return last, found, err
+}
+
+// truncateInZone rounds t down to a multiple of d counted in loc rather
+// than UTC, so hour and day buckets start on the local hour and at local
+// midnight, as the viewer shows them.
+func truncateInZone(t time.Time, d time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+// chooseHistBucket picks the smallest bucket width in histBucketSizes that
+// covers span in at most autoHistBuckets buckets.
+func chooseHistBucket(span time.Duration) time.Duration {
+	for _, d := range histBucketSizes {
+		if span/d < autoHistBuckets {
+			return d
+		}
+	}
+	return histBucketSizes[len(histBucketSizes)-1]
+}
+
+// handleLogHistogram counts the lines of a log per time bucket, split by
+// level, for the sparkline above the log view. bucket is a Go duration
+// ("1m", "30s") or "auto" (the default, about 120 buckets over the file).
+// from and to (any format /api/log/seek accepts) restrict the range; the
+// scan starts at the first line at or after from. Lines without a
+// timestamp (stack traces) belong to the line before them and are not
+// counted.
+func (a *app) handleLogHistogram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	relPath, err := sanitizeRelativePath(params.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	var bucket time.Duration
+	if raw := params.Get("bucket"); raw != "" && raw != "auto" {
+		bucket, err = time.ParseDuration(raw)
+		if err != nil || bucket < time.Second {
+			http.Error(w, "invalid bucket", http.StatusBadRequest)
+			return
+		}
+	}
+
+	f, err := a.openLog(relPath, fullPath, params.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	size, ref := info.Size(), info.ModTime()
+	var from, to time.Time
+	ok := true
+	if raw := params.Get("from"); raw != "" {
+		if from, ok = parseLogTimeString(raw, ref); !ok {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := params.Get("to"); raw != "" {
+		if to, ok = parseLogTimeString(raw, ref); !ok {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	format := params.Get("format")
+	if format == "" || format == "auto" {
+		if format, err = detectLogFileFormat(f); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	parse := logRecordParser(format)
+
+	// Find where to start and the range the buckets must cover.
+	start, first, ok, err := nextTimestampedLine(f, 0, size, ref)
+	if err == nil && ok && !from.IsZero() && first.Before(from) {
+		start, first, ok, err = seekLogTime(f, size, from, ref)
+	}
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	buckets := []histBucket{}
+	resp := struct {
+		Path     string       `json:"path"`
+		Format   string       `json:"format"`
+		Bucket   string       `json:"bucket"`
+		Seconds  float64      `json:"seconds"`
+		Levels   []string     `json:"levels"`
+		Buckets  []histBucket `json:"buckets"`
+		Lines    int          `json:"lines"`
+		Untimed  int          `json:"untimed"`
+		Scanned  int64        `json:"scanned"`
+		Size     int64        `json:"size"`
+		Complete bool         `json:"complete"`
+	}{Path: relPath, Format: format, Levels: []string{}, Buckets: buckets, Size: size, Complete: true}
+	if ok {
+		last := to
+		if last.IsZero() {
+			var found bool
+			if last, found, err = lastTimestamp(f, size, ref); err != nil {
+				http.Error(w, "failed to read file", http.StatusInternalServerError)
+				return
+			}
+			if !found || last.Before(first) {
+				last = first
+			}
+		}
+		if bucket == 0 {
+			bucket = chooseHistBucket(last.Sub(first))
+		}
+		base := truncateInZone(first, bucket, ref.Location())
+		n := int(last.Sub(base)/bucket) + 1
+		if n > maxHistBuckets {
+			http.Error(w, "too many buckets; use a larger bucket or a narrower range", http.StatusBadRequest)
+			return
+		}
+		for i := 0; i < max(n, 0); i++ {
+			buckets = append(buckets, histBucket{
+				Time:   base.Add(time.Duration(i) * bucket).Format(time.RFC3339),
+				Levels: map[string]int{},
+			})
+		}
+		seen := map[string]bool{}
+		ctx := r.Context()
+		err = scanLogLines(io.NewSectionReader(f, start, size-start), start, func(offset int64, line []byte) bool {
+			if offset-start >= maxLogStatsScan || ctx.Err() != nil {
+				resp.Complete = false
+				return false
+			}
+			resp.Scanned = offset + int64(len(line)) + 1 - start
+			t, ok := detectLogTime(line, ref)
+			if !ok {
+				resp.Untimed++
+				return true
+			}
+			if !to.IsZero() && t.After(to) {
+				return false
+			}
+			if t.Before(base) {
+				resp.Untimed++ // out of order, before the first bucket
+				return true
+			}
+			i := int(t.Sub(base) / bucket)
+			if i >= maxHistBuckets {
+				resp.Untimed++
+				return true
+			}
+			for len(buckets) <= i {
+				// Later than the last timestamp probed (the file grew, or
+				// lines are out of order).
+				buckets = append(buckets, histBucket{
+					Time:   base.Add(time.Duration(len(buckets)) * bucket).Format(time.RFC3339),
+					Levels: map[string]int{},
+				})
+			}
+			level := detectLogLevel(parse(line), line)
+			if level == "" {
+				level = "unknown"
+			}
+			buckets[i].Total++
+			buckets[i].Levels[level]++
+			seen[level] = true
+			resp.Lines++
+			return true
+		})
+		if err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		for l := range seen {
+			resp.Levels = append(resp.Levels, l)
+		}
+		sort.Strings(resp.Levels)
+		resp.Buckets = buckets
+	}
+	resp.Bucket = bucket.String()
+	resp.Seconds = bucket.Seconds()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// logIndexStride is the number of lines between two entries of the sparse
+	// line index. Finding any line costs at most one stride of scanning.
+	logIndexStride = 1024
+	// defaultLogPageLines and maxLogPageLines bound the lines returned by a
+	// random-access /api/log request.
+	defaultLogPageLines = 500
+	maxLogPageLines     = 10000
+)
+
+// logLineIndex is a sparse index of line start offsets for one log file.
+// marks[k] is the byte offset of line k*logIndexStride+1. The index covers
+// bytes [0, size) and is extended as the file grows; a file that shrank or
+// was replaced is indexed again from scratch.
+type logLineIndex struct {
+	mu    sync.Mutex
+	info  os.FileInfo
+	size  int64   // bytes indexed so far
+	lines int64   // newlines seen in [0, size)
+	marks []int64 // start offset of every logIndexStride-th line
+}
+
+// logIndexCache holds one line index per log file, keyed by absolute path.
+type logIndexCache struct {
+	mu      sync.Mutex
+	indexes map[string]*logLineIndex
+}
+
+func newLogIndexCache() *logIndexCache {
+	return &logIndexCache{indexes: make(map[string]*logLineIndex)}
+}
+
+// drop forgets the index for fullPath, whose file is gone.
+func (c *logIndexCache) drop(fullPath string) {
+	c.mu.Lock()
+	delete(c.indexes, fullPath)
+	c.mu.Unlock()
+}
+
+// get returns the index for fullPath brought up to date with the open file
+// f. The returned index is locked; the caller must unlock idx.mu. Archives and
+// log sets are indexed by the path of their decompressed copy.
+func (c *logIndexCache) get(fullPath string, f logReader, info os.FileInfo) (*logLineIndex, error) {
+	c.mu.Lock()
+	idx, ok := c.indexes[fullPath]
+	if !ok {
+		idx = &logLineIndex{}
+		c.indexes[fullPath] = idx
+	}
+	c.mu.Unlock()
+
+	idx.mu.Lock()
+	if err := idx.update(f, info); err != nil {
+		idx.mu.Unlock()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// update indexes the bytes appended since the last call, starting over if
+// the file was truncated or rotated.
+func (idx *logLineIndex) update(f logReader, info os.FileInfo) error {
+	if idx.info == nil || !sameLogFile(idx.info, info) || info.Size() < idx.size {
+		idx.size, idx.lines, idx.marks = 0, 0, []int64{0}
+	}
+	idx.info = info
+	if info.Size() == idx.size {
+		return nil
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(f, idx.size, info.Size()-idx.size), 64<<10)
+	buf := make([]byte, 64<<10)
+	pos := idx.size
+	for {
+		n, err := br.Read(buf)
+		chunk := buf[:n]
+		for len(chunk) > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			idx.lines++
+			if idx.lines%logIndexStride == 0 {
+				idx.marks = append(idx.marks, pos+int64(i)+1)
+			}
+			pos += int64(i) + 1
+			chunk = chunk[i+1:]
+		}
+		pos += int64(len(chunk))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	idx.size = pos
+	return nil
+}
+
+// totalLines is the number of lines in the indexed file, counting a final
+// line without a trailing newline.
+func (idx *logLineIndex) totalLines(f logReader) int64 {
+	if idx.size == 0 {
+		return 0
+	}
+	var last [1]byte
+	if _, err := f.ReadAt(last[:], idx.size-1); err == nil && last[0] != '\n' {
+		return idx.lines + 1
+	}
+	return idx.lines
+}
+
+// lineOffset returns the byte offset at which 1-based line n starts. Lines
+// past the end are clamped to the end of the file.
+func (idx *logLineIndex) lineOffset(f logReader, n int64) (int64, error) {
+	if n <= 1 {
+		return 0, nil
+	}
+	if n-1 > idx.lines {
+		return idx.size, nil
+	}
+	k := (n - 1) / logIndexStride
+	from := idx.marks[k]
+	skip := (n - 1) % logIndexStride
+	if skip == 0 {
+		return from, nil
+	}
+	offset := idx.size // line n is the empty one after a trailing newline
+	err := scanLogLines(io.NewSectionReader(f, from, idx.size-from), from, func(o int64, _ []byte) bool {
+		if skip == 0 {
+			offset = o
+			return false
+		}
+		skip--
+		return true
+	})
+	return offset, err
+}
+
+// lineNumber returns the 1-based number of the line containing offset.
+func (idx *logLineIndex) lineNumber(f logReader, offset int64) (int64, error) {
+	offset = min(offset, idx.size)
+	k := sort.Search(len(idx.marks), func(i int) bool { return idx.marks[i] > offset }) - 1
+	from := idx.marks[k]
+	n, err := countNewlines(io.NewSectionReader(f, from, offset-from))
+	return int64(k)*logIndexStride + n + 1, err
+}
+
+// countNewlines counts the '\n' bytes read from r.
+func countNewlines(r io.Reader) (int64, error) {
+	buf := make([]byte, 64<<10)
+	var n int64
+	for {
+		m, err := r.Read(buf)
+		n += int64(bytes.Count(buf[:m], []byte{'\n'}))
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// lineStartBefore returns the start of the line containing the byte just
+// before offset, i.e. the line a position at offset continues.
+func lineStartBefore(f logReader, offset int64) (int64, error) {
+	return scanLinesBackward(f, offset, 1, -1)
+}
+
+// scanLinesBackward returns where the n lines ending at offset begin. The
+// byte at offset-1, if it is a newline, terminates the last of those lines
+// rather than starting a new one. With maxBytes >= 0, fewer lines are taken
+// when n would span more than maxBytes, but always at least one.
+func scanLinesBackward(f logReader, offset int64, n int, maxBytes int64) (int64, error) {
+	if offset <= 0 || n <= 0 {
+		return 0, nil
+	}
+	const block = 64 << 10
+	buf := make([]byte, block)
+	end := offset - 1 // exclude the terminator of the last line
+	found, prev := 0, offset
+	for end > 0 {
+		start := max(end-block, 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			lineStart := start + int64(i) + 1
+			if maxBytes >= 0 && found > 0 && offset-lineStart > maxBytes {
+				return prev, nil
+			}
+			found++
+			if found == n {
+				return lineStart, nil
+			}
+			prev = lineStart
+			chunk = chunk[:i]
+		}
+		end = start
+	}
+	if maxBytes >= 0 && found > 0 && offset > maxBytes {
+		return prev, nil
+	}
+	return 0, nil
+}
+
+// readLinesForward reads up to n lines starting at offset, stopping early
+// once maxBytes have been read. It returns the bytes read and the number of
+// lines they hold.
+func readLinesForward(f logReader, offset, size int64, n int, maxBytes int64) ([]byte, int, error) {
+	if offset >= size {
+		return nil, 0, nil
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(f, offset, size-offset), 64<<10)
+	var out []byte
+	count := 0
+	for count < n && int64(len(out)) < maxBytes {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			out = append(out, line...)
+			count++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return out, count, nil
+}
+
+// logPageRequested reports whether params ask /api/log for a random-access
+// page rather than the tail.
+func logPageRequested(params url.Values) bool {
+	return params.Get("before") != "" || params.Get("line") != "" || params.Get("percent") != ""
+}
+
+// serveLogPage answers the random-access forms of /api/log:
+//
+//	before=<offset>&lines=N   the N lines ending at offset (paging backwards)
+//	line=<n>&lines=N          N lines starting at 1-based line n
+//	percent=<p>&lines=N       N lines starting at the line p% into the file
+//
+// The response has the /api/log shape plus start (offset of the first
+// returned byte), line (its line number) and totalLines. offset is the end
+// of the returned content, where a forward read would continue.
+func (a *app) serveLogPage(w http.ResponseWriter, relPath string, f logReader, info os.FileInfo, params url.Values) {
+	size := info.Size()
+	lines := defaultLogPageLines
+	if raw := params.Get("lines"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			http.Error(w, "invalid lines", http.StatusBadRequest)
+			return
+		}
+		lines = min(v, maxLogPageLines)
+	}
+	rule, err := parseEntryRule(params, info.ModTime())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idx, err := a.logIndex.get(f.Name(), f, info)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer idx.mu.Unlock()
+
+	var start, end int64
+	var content []byte
+	switch {
+	case params.Get("before") != "":
+		before, perr := strconv.ParseInt(params.Get("before"), 10, 64)
+		if perr != nil || before < 0 {
+			http.Error(w, "invalid before", http.StatusBadRequest)
+			return
+		}
+		end = min(before, size)
+		if start, err = scanLinesBackward(f, end, lines, maxLogInitialBytes); err == nil {
+			content, err = readLogRange(f, start, end)
+		}
+	case params.Get("line") != "":
+		n, perr := strconv.ParseInt(params.Get("line"), 10, 64)
+		if perr != nil || n < 1 {
+			http.Error(w, "invalid line", http.StatusBadRequest)
+			return
+		}
+		if start, err = idx.lineOffset(f, n); err == nil {
+			content, _, err = readLinesForward(f, start, size, lines, maxLogInitialBytes)
+			end = start + int64(len(content))
+		}
+	default:
+		p, perr := strconv.ParseFloat(strings.TrimSuffix(params.Get("percent"), "%"), 64)
+		if perr != nil || p < 0 || p > 100 {
+			http.Error(w, "invalid percent", http.StatusBadRequest)
+			return
+		}
+		target := int64(float64(size) * p / 100)
+		if target >= size && size > 0 {
+			target = size - 1
+		}
+		if start, err = lineStartBefore(f, target+1); err == nil {
+			content, _, err = readLinesForward(f, start, size, lines, maxLogInitialBytes)
+			end = start + int64(len(content))
+		}
+	}
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	lineNo, err := idx.lineNumber(f, start)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	format, err := detectLogFileFormat(f)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	var entries []int64
+	if rule != nil {
+		if entries, err = logEntryStarts(f, rule, start, content); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	ansiMode, _ := parseANSIMode(params) // validated by handleLogTail
+	content, ansi := applyANSIMode(ansiMode, a.redact.redact(content))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path       string     `json:"path"`
+		Format     string     `json:"format"`
+		Content    string     `json:"content"`
+		Start      int64      `json:"start"`
+		Offset     int64      `json:"offset"`
+		Size       int64      `json:"size"`
+		Line       int64      `json:"line"`
+		TotalLines int64      `json:"totalLines"`
+		Truncated  bool       `json:"truncated"`
+		Entries    []int64    `json:"entries,omitempty"`
+		ANSI       []ansiLine `json:"ansi,omitempty"`
+	}{
+		Path:       relPath,
+		Format:     format,
+		Content:    string(content),
+		Start:      start,
+		Offset:     end,
+		Size:       size,
+		Line:       lineNo,
+		TotalLines: idx.totalLines(f),
+		Truncated:  start > 0,
+		Entries:    entries,
+		ANSI:       ansi,
+	})
+}
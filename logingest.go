@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLogAppendBytes bounds the body of one /api/log/append request.
+	maxLogAppendBytes = 8 << 20 // 8 MiB
+	// teeBatchBytes is the pending size at which mdviewer tee sends early.
+	teeBatchBytes = 256 << 10
+)
+
+// logIngest guards appends made through /api/log/append so requests to the
+// same log never interleave.
+type logIngest struct {
+	token string // empty disables the endpoint
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newLogIngest(token string) *logIngest {
+	return &logIngest{token: token, locks: make(map[string]*sync.Mutex)}
+}
+
+// lock returns the append lock of a log.
+func (li *logIngest) lock(fullPath string) *sync.Mutex {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	m, ok := li.locks[fullPath]
+	if !ok {
+		m = &sync.Mutex{}
+		li.locks[fullPath] = m
+	}
+	return m
+}
+
+// authorized checks the request's token, sent as "Authorization: Bearer
+// <token>" or an X-Mdviewer-Token header.
+func (li *logIngest) authorized(r *http.Request) bool {
+	got := r.Header.Get("X-Mdviewer-Token")
+	if auth := r.Header.Get("Authorization"); got == "" && strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(li.token)) == 1
+}
+
+// isNDJSONContentType reports whether a request body is declared as
+// newline-delimited JSON.
+func isNDJSONContentType(ct string) bool {
+	mt, _, _ := mime.ParseMediaType(ct)
+	switch mt {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/json-lines":
+		return true
+	}
+	return false
+}
+
+// handleLogAppend appends the request body to a log under the root,
+// creating the log (and its directories) when missing. The body is plain
+// text, or NDJSON when the Content-Type says so, in which case every
+// non-empty line must be a JSON value. A missing final newline is added so
+// the next append starts a new line. The whole body is written with one
+// append while holding the log's lock, so live tails never see half of it.
+// The endpoint is disabled unless mdviewer runs with -ingest-token (or
+// MDVIEWER_INGEST_TOKEN).
+func (a *app) handleLogAppend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.ingest.token == "" {
+		http.Error(w, "log ingestion is disabled; start mdviewer with -ingest-token", http.StatusForbidden)
+		return
+	}
+	if !a.ingest.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	if isArchivedLog(relPath) {
+		http.Error(w, "rotated and compressed logs cannot be appended to", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogAppendBytes))
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxLogAppendBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	lines := bytes.Count(body, []byte{'\n'})
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		body = append(body, '\n')
+		lines++
+	}
+	if isNDJSONContentType(r.Header.Get("Content-Type")) {
+		for i, line := range bytes.Split(bytes.TrimSuffix(body, []byte{'\n'}), []byte{'\n'}) {
+			line = bytes.TrimSpace(line)
+			if len(line) > 0 && !json.Valid(line) {
+				http.Error(w, fmt.Sprintf("line %d is not valid JSON", i+1), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	lock := a.ingest.lock(fullPath)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		http.Error(w, "failed to create log", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		http.Error(w, "failed to open log", http.StatusInternalServerError)
+		return
+	}
+	_, werr := f.Write(body)
+	info, serr := f.Stat()
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil || serr != nil {
+		http.Error(w, "failed to append to log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"ok":    true,
+		"path":  relPath,
+		"bytes": len(body),
+		"lines": lines,
+		"size":  info.Size(),
+	})
+}
+
+// runTee implements "mdviewer tee <relpath>": it copies stdin to stdout and
+// sends the complete lines to a running mdviewer's /api/log/append in
+// batches, so a command's output can be watched live in the viewer. Failed
+// sends are reported on stderr and never interrupt the pipeline.
+func runTee(args []string) int {
+	fset := flag.NewFlagSet("tee", flag.ExitOnError)
+	serverFlag := fset.String("server", "http://localhost:8080", "URL of the running mdviewer")
+	tokenFlag := fset.String("token", os.Getenv("MDVIEWER_INGEST_TOKEN"), "Ingest token (default $MDVIEWER_INGEST_TOKEN)")
+	flushFlag := fset.Duration("flush", time.Second, "Maximum time lines are held before they are sent")
+	ndjsonFlag := fset.Bool("ndjson", false, "Send the input as NDJSON (every line must be JSON)")
+	quietFlag := fset.Bool("q", false, "Do not echo stdin to stdout")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mdviewer tee [flags] <log path relative to the server root>")
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return 2
+	}
+	relPath, err := sanitizeRelativePath(fset.Arg(0))
+	if err != nil || !isLogFile(relPath) {
+		fmt.Fprintln(os.Stderr, "tee: the log path must be relative and end in .log, .jsonl or .ndjson")
+		return 2
+	}
+	endpoint := strings.TrimSuffix(*serverFlag, "/") + "/api/log/append?path=" + url.QueryEscape(relPath)
+	contentType := "text/plain; charset=utf-8"
+	if *ndjsonFlag {
+		contentType = "application/x-ndjson"
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	failed := false
+	send := func(batch []byte) {
+		if len(batch) == 0 {
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(batch))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tee: %v\n", err)
+			return
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+*tokenFlag)
+		resp, err := client.Do(req)
+		if err == nil {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			}
+		}
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "tee: sending %d bytes to %s failed: %v\n", len(batch), relPath, err)
+		}
+	}
+
+	// A reader goroutine feeds chunks so batches can also be sent on a
+	// timer while stdin is idle.
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				if err != io.EOF {
+					fmt.Fprintf(os.Stderr, "tee: reading stdin: %v\n", err)
+				}
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(*flushFlag)
+	defer ticker.Stop()
+	var pending []byte
+	flushLines := func() {
+		// Only complete lines are sent, so a line is never split across
+		// two appends.
+		if i := bytes.LastIndexByte(pending, '\n'); i >= 0 {
+			send(pending[:i+1])
+			pending = append([]byte(nil), pending[i+1:]...)
+		}
+	}
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				flushLines()
+				send(pending)
+				if failed {
+					return 1
+				}
+				return 0
+			}
+			if !*quietFlag {
+				os.Stdout.Write(chunk)
+			}
+			pending = append(pending, chunk...)
+			if len(pending) >= teeBatchBytes {
+				flushLines()
+				if len(pending) >= 4*teeBatchBytes {
+					// A single line this long is sent in pieces.
+					send(pending)
+					pending = nil
+				}
+			}
+		case <-ticker.C:
+			flushLines()
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxMergeSources bounds the logs merged by one request.
+	maxMergeSources = 16
+	// defaultMergeLines is how many of the most recent merged lines the
+	// initial /api/log/merge response holds.
+	defaultMergeLines = 2000
+)
+
+// mergedLine is one line of a merged log view, tagged with its source.
+type mergedLine struct {
+	Source string    `json:"source"`
+	Time   string    `json:"time,omitempty"`
+	Text   string    `json:"text"`
+	at     time.Time // sort key; zero when no timestamp is known
+}
+
+// mergeSource is one log taking part in a merge, with the state needed to
+// timestamp its lines: the last time seen (inherited by continuation lines
+// such as stack traces) and any unfinished last line.
+type mergeSource struct {
+	rel     string
+	full    string
+	ref     time.Time
+	last    time.Time
+	partial []byte
+	redact  *redactor
+	carry   []byte // see redactor.redactChunk
+}
+
+// lines splits complete lines out of data, keeping an unfinished tail for
+// the next call, and timestamps them.
+func (s *mergeSource) lines(data []byte) []mergedLine {
+	data = append(s.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		s.partial = data
+		return nil
+	}
+	s.partial = append([]byte(nil), data[end+1:]...)
+	// Masks keep their length, so the masked block splits like data.
+	var masked []byte
+	masked, s.carry = s.redact.redactChunk(s.carry, data[:end+1])
+	texts := bytes.Split(masked[:end], []byte{'\n'})
+	var out []mergedLine
+	for i, raw := range bytes.Split(data[:end], []byte{'\n'}) {
+		raw = bytes.TrimSuffix(raw, []byte{'\r'})
+		if t, ok := detectLogTime(raw, s.ref); ok {
+			s.last = t
+		}
+		out = append(out, mergedLine{Source: s.rel, Text: string(bytes.TrimSuffix(texts[i], []byte{'\r'})), at: s.last})
+	}
+	// Continuation lines before the first timestamp take the first one.
+	var first time.Time
+	for _, l := range out {
+		if !l.at.IsZero() {
+			first = l.at
+			break
+		}
+	}
+	for i := range out {
+		if out[i].at.IsZero() {
+			out[i].at = first
+		}
+	}
+	return out
+}
+
+// sortMerged orders lines by time. The sort is stable, so lines with equal
+// (or unknown) times keep their per-source order.
+func sortMerged(lines []mergedLine) {
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].at.Before(lines[j].at) })
+	for i := range lines {
+		if !lines[i].at.IsZero() {
+			lines[i].Time = lines[i].at.Format(time.RFC3339Nano)
+		}
+	}
+}
+
+// parseMergeSources validates the repeated path parameters of a merge
+// request.
+func (a *app) parseMergeSources(paths []string) ([]*mergeSource, error) {
+	if len(paths) < 1 {
+		return nil, errors.New("at least one path is required")
+	}
+	if len(paths) > maxMergeSources {
+		return nil, errors.New("too many paths")
+	}
+	seen := make(map[string]bool)
+	var sources []*mergeSource
+	for _, raw := range paths {
+		rel, err := sanitizeRelativePath(raw)
+		if err != nil {
+			return nil, errors.New("invalid path")
+		}
+		if !isLogFile(rel) {
+			return nil, errors.New("only log files are supported")
+		}
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		full, err := secureJoin(a.root, rel)
+		if err != nil {
+			return nil, errors.New("invalid path")
+		}
+		sources = append(sources, &mergeSource{rel: rel, full: full, redact: a.redact})
+	}
+	return sources, nil
+}
+
+// parseMergeOffsets reads the comma-separated offsets parameter, one per
+// source; missing or invalid entries are -1 (start from the current end).
+func parseMergeOffsets(raw string, n int) []int64 {
+	offsets := make([]int64, n)
+	parts := strings.Split(raw, ",")
+	for i := range offsets {
+		offsets[i] = -1
+		if raw != "" && i < len(parts) {
+			if v, err := strconv.ParseInt(strings.TrimSpace(parts[i]), 10, 64); err == nil && v >= 0 {
+				offsets[i] = v
+			}
+		}
+	}
+	return offsets
+}
+
+// handleLogMerge returns the most recent lines of several logs interleaved
+// by timestamp, each tagged with its source file. offsets holds, per path,
+// the end of the last complete line returned; pass them to
+// /api/log/merge/stream to continue live.
+func (a *app) handleLogMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	sources, err := a.parseMergeSources(q["path"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultMergeLines
+	if raw := q.Get("lines"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			http.Error(w, "invalid lines", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxLogPageLines)
+	}
+
+	var merged []mergedLine
+	offsets := make([]int64, len(sources))
+	for i, s := range sources {
+		f, err := a.openLog(s.rel, s.full, false)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "file not found: "+s.rel, http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if info, err := os.Stat(s.full); err == nil {
+			s.ref = info.ModTime()
+		}
+		info, err := f.Stat()
+		var content []byte
+		if err == nil {
+			var start int64
+			start, err = scanLinesBackward(f, info.Size(), limit, maxLogInitialBytes)
+			if err == nil {
+				content, err = readLogRange(f, start, info.Size())
+				offsets[i] = info.Size()
+			}
+		}
+		f.Close()
+		if err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		merged = append(merged, s.lines(content)...)
+		offsets[i] -= int64(len(s.partial)) // resume at the unfinished line
+	}
+	sortMerged(merged)
+	if len(merged) > limit {
+		merged = merged[len(merged)-limit:]
+	}
+	if merged == nil {
+		merged = []mergedLine{}
+	}
+
+	paths := make([]string, len(sources))
+	for i, s := range sources {
+		paths[i] = s.rel
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Paths   []string     `json:"paths"`
+		Lines   []mergedLine `json:"lines"`
+		Offsets []int64      `json:"offsets"`
+	}{
+		Paths:   paths,
+		Lines:   merged,
+		Offsets: offsets,
+	})
+}
+
+// mergeChunk is a chunk from one source's watcher, tagged with its index.
+type mergeChunk struct {
+	src   int
+	chunk logChunk
+}
+
+// handleLogMergeStream live-tails several logs as one view. Appended lines
+// from all sources are collected for one watch interval, ordered by time
+// and sent as a "lines" event with the same shape as /api/log/merge.
+// offsets (comma-separated, one per path) resumes where a previous
+// response ended. Rotated and compressed inputs do not grow and are skipped.
+func (a *app) handleLogMergeStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	sources, err := a.parseMergeSources(q["path"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	offsets := parseMergeOffsets(q.Get("offsets"), len(sources))
+
+	ctx := r.Context()
+	in := make(chan mergeChunk, 64)
+	// dropped receives when a source's subscription ends early (it fell
+	// behind); the stream then closes so the client resumes from offsets.
+	dropped := make(chan struct{}, len(sources))
+	var catchUp []mergedLine
+	for i, s := range sources {
+		if isArchivedLog(s.rel) {
+			continue
+		}
+		sub, current, err := a.logs.subscribe(s.full)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "file not found: "+s.rel, http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer a.logs.unsubscribe(sub)
+		if info, err := os.Stat(s.full); err == nil {
+			s.ref = info.ModTime()
+		}
+		if off := offsets[i]; off >= 0 && off < current {
+			f, err := os.Open(s.full)
+			if err == nil {
+				var content []byte
+				content, err = readLogRange(f, max(off, current-maxLogInitialBytes), current)
+				f.Close()
+				catchUp = append(catchUp, s.lines(content)...)
+			}
+			if err != nil {
+				http.Error(w, "failed to read file", http.StatusInternalServerError)
+				return
+			}
+		}
+		offsets[i] = current - int64(len(s.partial))
+		go func(i int, sub *logSub) {
+			defer func() { dropped <- struct{}{} }()
+			for c := range sub.C {
+				select {
+				case in <- mergeChunk{src: i, chunk: c}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, sub)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	send := func(lines []mergedLine) error {
+		sortMerged(lines)
+		if lines == nil {
+			lines = []mergedLine{}
+		}
+		err := writeSSE(w, "lines", "", struct {
+			Lines   []mergedLine `json:"lines"`
+			Offsets []int64      `json:"offsets"`
+		}{Lines: lines, Offsets: offsets})
+		flusher.Flush()
+		return err
+	}
+	if err := send(catchUp); err != nil {
+		return
+	}
+
+	tick := time.NewTicker(logWatchInterval)
+	defer tick.Stop()
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+	var pending []mergedLine
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-dropped:
+			if len(pending) > 0 {
+				_ = send(pending)
+			}
+			return
+		case mc := <-in:
+			s := sources[mc.src]
+			if mc.chunk.Reset {
+				s.partial = nil
+			}
+			pending = append(pending, s.lines([]byte(mc.chunk.Content))...)
+			offsets[mc.src] = mc.chunk.Offset - int64(len(s.partial))
+		case <-tick.C:
+			if len(pending) == 0 {
+				continue
+			}
+			if err := send(pending); err != nil {
+				return
+			}
+			pending = nil
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
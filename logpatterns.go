@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// drainSimilarity is the fraction of tokens a line must share with a
+	// template to join it.
+	drainSimilarity = 0.5
+	// maxDrainClusters bounds the templates kept by one mining pass; lines
+	// that would start a new template after that are counted as unmatched.
+	maxDrainClusters = 5000
+	// maxDrainTokens bounds the tokens of a line considered; longer lines
+	// are grouped on their first maxDrainTokens tokens.
+	maxDrainTokens = 100
+	// maxPatternExamples bounds the example lines kept per template.
+	maxPatternExamples = 3
+	// defaultPatternLimit and maxPatternLimit bound the templates returned.
+	defaultPatternLimit = 50
+	maxPatternLimit     = 1000
+	// drainWildcard marks a token position whose values differ.
+	drainWildcard = "<*>"
+)
+
+// logMaskRules replace variable parts of a line with typed placeholders
+// before tokenising, most specific first.
+var logMaskRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?|\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`), "<TIME>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<UUID>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), "<IP>"},
+	{regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){3,7}[0-9a-f]{1,4}\b`), "<IP>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<HEX>"},
+}
+
+var (
+	// logHexRe matches hex-looking words; maskLogLine only replaces those
+	// holding both a digit and a letter, so words like "facade" and plain
+	// numbers are left alone.
+	logHexRe = regexp.MustCompile(`(?i)\b[0-9a-f]{6,}\b`)
+	logNumRe = regexp.MustCompile(`\b\d+(?:\.\d+)?`) // also the number in 12ms
+)
+
+// logPlaceholderRe matches the placeholders written by maskLogLine and
+// drainWildcard.
+var logPlaceholderRe = regexp.MustCompile(`<(?:TIME|UUID|IP|HEX|NUM|\*)>`)
+
+// maskLogLine replaces timestamps, UUIDs, IP addresses, hex strings and
+// numbers in line with placeholders and splits the result into tokens.
+func maskLogLine(line string) []string {
+	for _, rule := range logMaskRules {
+		line = rule.re.ReplaceAllString(line, rule.repl)
+	}
+	line = logHexRe.ReplaceAllStringFunc(line, func(s string) string {
+		if strings.IndexFunc(s, isDigit) < 0 || strings.IndexFunc(s, isHexLetter) < 0 {
+			return s
+		}
+		return "<HEX>"
+	})
+	line = logNumRe.ReplaceAllString(line, "<NUM>")
+	tokens := strings.Fields(line)
+	if len(tokens) > maxDrainTokens {
+		tokens = tokens[:maxDrainTokens]
+	}
+	return tokens
+}
+
+func isDigit(r rune) bool     { return r >= '0' && r <= '9' }
+func isHexLetter(r rune) bool { return r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' }
+
+// patternSeen records where a template was matched.
+type patternSeen struct {
+	Line   int64  `json:"line"`
+	Offset int64  `json:"offset"`
+	Time   string `json:"time,omitempty"`
+}
+
+// drainCluster is one template and the lines grouped under it.
+type drainCluster struct {
+	tokens   []string
+	count    int
+	first    patternSeen
+	last     patternSeen
+	examples []string
+}
+
+// drainTree groups lines into templates in the manner of Drain: candidates
+// are narrowed by token count and first token, then a line joins the most
+// similar template (merging differing tokens into wildcards) or starts a
+// new one.
+type drainTree struct {
+	groups    map[string][]*drainCluster
+	clusters  []*drainCluster
+	unmatched int
+}
+
+func newDrainTree() *drainTree {
+	return &drainTree{groups: make(map[string][]*drainCluster)}
+}
+
+// drainKey is the leaf a token list belongs to. A first token holding a
+// placeholder does not split leaves, since it varies.
+func drainKey(tokens []string) string {
+	first := ""
+	if len(tokens) > 0 {
+		first = tokens[0]
+		if logPlaceholderRe.MatchString(first) {
+			first = drainWildcard
+		}
+	}
+	return strconv.Itoa(len(tokens)) + " " + first
+}
+
+// similarity is the fraction of positions where tokens matches template;
+// wildcard positions match anything but do not count.
+func similarity(template, tokens []string) float64 {
+	if len(template) == 0 {
+		return 1
+	}
+	same := 0
+	for i, t := range template {
+		if t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template))
+}
+
+// add places a line's tokens into a cluster and returns it, or nil when
+// maxDrainClusters was reached.
+func (d *drainTree) add(tokens []string) *drainCluster {
+	key := drainKey(tokens)
+	var best *drainCluster
+	bestSim := -1.0
+	for _, c := range d.groups[key] {
+		if s := similarity(c.tokens, tokens); s > bestSim {
+			best, bestSim = c, s
+		}
+	}
+	if best != nil && bestSim >= drainSimilarity {
+		for i, t := range best.tokens {
+			if t != tokens[i] && t != drainWildcard {
+				best.tokens[i] = drainWildcard
+			}
+		}
+		return best
+	}
+	if len(d.clusters) >= maxDrainClusters {
+		d.unmatched++
+		return nil
+	}
+	c := &drainCluster{tokens: append([]string(nil), tokens...)}
+	d.groups[key] = append(d.groups[key], c)
+	d.clusters = append(d.clusters, c)
+	return c
+}
+
+// logPattern is a mined template as returned by /api/log/patterns.
+type logPattern struct {
+	Template string      `json:"template"`
+	Match    string      `json:"match"` // anchored regexp (RE2 and JavaScript) for lines of this template
+	Count    int         `json:"count"`
+	First    patternSeen `json:"first"`
+	Last     patternSeen `json:"last"`
+	Examples []string    `json:"examples"`
+}
+
+// templateRegexp builds an anchored regular expression matching the lines
+// of a template: literal text is quoted, placeholders match any text and
+// token boundaries match any whitespace.
+func templateRegexp(tokens []string) string {
+	parts := make([]string, len(tokens))
+	for i, t := range tokens {
+		var b strings.Builder
+		last := 0
+		for _, m := range logPlaceholderRe.FindAllStringIndex(t, -1) {
+			b.WriteString(regexp.QuoteMeta(t[last:m[0]]))
+			b.WriteString(`.+?`)
+			last = m[1]
+		}
+		b.WriteString(regexp.QuoteMeta(t[last:]))
+		parts[i] = b.String()
+	}
+	re := `^\s*` + strings.Join(parts, `\s+`)
+	if len(tokens) < maxDrainTokens {
+		re += `\s*$`
+	}
+	return re
+}
+
+// handleLogPatterns mines a log for message templates: variable parts
+// (numbers, UUIDs, IPs, hex, timestamps) become placeholders and lines are
+// grouped Drain-style, so a log dominated by a few messages with different
+// IDs reduces to a short list. Templates come back most frequent first with
+// counts, first and last occurrence and example lines. The
+// /api/log/search filters (q, mode, where, format) restrict the lines mined.
+func (a *app) handleLogPatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	relPath, err := sanitizeRelativePath(params.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	query, err := parseLogQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultPatternLimit
+	if raw := params.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxPatternLimit)
+	}
+
+	f, err := a.openLog(relPath, fullPath, params.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	if len(query.Fields) > 0 {
+		format := params.Get("format")
+		if format == "" || format == "auto" {
+			if format, err = detectLogFileFormat(f); err != nil {
+				http.Error(w, "failed to read file", http.StatusInternalServerError)
+				return
+			}
+		}
+		query.Parse = logRecordParser(format)
+	}
+
+	tree := newDrainTree()
+	var lineNo, lines int64
+	var scanned int64
+	complete := true
+	ref := info.ModTime()
+	ctx := r.Context()
+	err = scanLogLines(io.NewSectionReader(f, 0, info.Size()), 0, func(offset int64, line []byte) bool {
+		if offset >= maxLogStatsScan || ctx.Err() != nil {
+			complete = false
+			return false
+		}
+		lineNo++
+		scanned = offset + int64(len(line)) + 1
+		line = a.redact.redact(line)
+		if len(strings.TrimSpace(string(line))) == 0 || !query.match(line) {
+			return true
+		}
+		lines++
+		c := tree.add(maskLogLine(string(line)))
+		if c == nil {
+			return true
+		}
+		seen := patternSeen{Line: lineNo, Offset: offset}
+		if t, ok := detectLogTime(line, ref); ok {
+			seen.Time = t.Format(time.RFC3339Nano)
+		}
+		if c.count == 0 {
+			c.first = seen
+		}
+		c.last = seen
+		c.count++
+		if len(c.examples) < maxPatternExamples {
+			ex := string(line)
+			if len(ex) > 500 {
+				ex = ex[:500]
+			}
+			c.examples = append(c.examples, ex)
+		}
+		return true
+	})
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(tree.clusters, func(i, j int) bool { return tree.clusters[i].count > tree.clusters[j].count })
+	total := len(tree.clusters)
+	patterns := make([]logPattern, 0, min(total, limit))
+	for _, c := range tree.clusters[:min(total, limit)] {
+		patterns = append(patterns, logPattern{
+			Template: strings.Join(c.tokens, " "),
+			Match:    templateRegexp(c.tokens),
+			Count:    c.count,
+			First:    c.first,
+			Last:     c.last,
+			Examples: c.examples,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path      string       `json:"path"`
+		Patterns  []logPattern `json:"patterns"`
+		Templates int          `json:"templates"`
+		Lines     int64        `json:"lines"`
+		Unmatched int          `json:"unmatched"`
+		Scanned   int64        `json:"scanned"`
+		Size      int64        `json:"size"`
+		Complete  bool         `json:"complete"`
+	}{
+		Path:      relPath,
+		Patterns:  patterns,
+		Templates: total,
+		Lines:     lines,
+		Unmatched: tree.unmatched,
+		Scanned:   min(scanned, info.Size()),
+		Size:      info.Size(),
+		Complete:  complete,
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMaskLogLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"2026-10-18T09:15:02.123Z GET /users/42 took 12ms", []string{"<TIME>", "GET", "/users/<NUM>", "took", "<NUM>ms"}},
+		{"request 123e4567-e89b-12d3-a456-426614174000 from 10.0.0.1:8080", []string{"request", "<UUID>", "from", "<IP>"}},
+		{"ptr 0xdeadbeef sha 9f86d081884c ok", []string{"ptr", "<HEX>", "sha", "<HEX>", "ok"}},
+		{"facade decade", []string{"facade", "decade"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := maskLogLine(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("maskLogLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDrainTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // templates in order of appearance
+		count []int
+	}{
+		{
+			name:  "variable token becomes a wildcard",
+			lines: []string{"user alice logged in", "user bob logged in", "user carol logged in"},
+			want:  []string{"user <*> logged in"},
+			count: []int{3},
+		},
+		{
+			name:  "different lengths never merge",
+			lines: []string{"cache hit", "cache miss for key", "cache hit"},
+			want:  []string{"cache hit", "cache miss for key"},
+			count: []int{2, 1},
+		},
+		{
+			name:  "different first tokens never merge",
+			lines: []string{"GET /a ok", "PUT /a ok"},
+			want:  []string{"GET /a ok", "PUT /a ok"},
+			count: []int{1, 1},
+		},
+		{
+			name:  "too dissimilar starts a new template",
+			lines: []string{"job a b c done", "job w x y z"},
+			want:  []string{"job a b c done", "job w x y z"},
+			count: []int{1, 1},
+		},
+		{
+			name:  "placeholder first token shares a leaf",
+			lines: []string{"<NUM> items queued", "<TIME> items queued"},
+			want:  []string{"<*> items queued"},
+			count: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDrainTree()
+			for _, line := range tt.lines {
+				if c := d.add(strings.Fields(line)); c != nil {
+					c.count++
+				}
+			}
+			var got []string
+			var count []int
+			for _, c := range d.clusters {
+				got = append(got, strings.Join(c.tokens, " "))
+				count = append(count, c.count)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(count, tt.count) {
+				t.Errorf("templates = %q %v, want %q %v", got, count, tt.want, tt.count)
+			}
+		})
+	}
+}
+
+func TestTemplateRegexp(t *testing.T) {
+	tests := []struct {
+		template string
+		match    []string
+		noMatch  []string
+	}{
+		{"user <*> logged in", []string{"user alice logged in", "  user bob   logged in "}, []string{"user alice logged out", "user alice logged in twice"}},
+		{"took <NUM>ms (p99)", []string{"took 12ms (p99)"}, []string{"took 12ms p99"}},
+		{"GET /users/<NUM>", []string{"GET /users/42"}, []string{"GET /users/"}},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile(templateRegexp(strings.Fields(tt.template)))
+		for _, s := range tt.match {
+			if !re.MatchString(s) {
+				t.Errorf("templateRegexp(%q) = %s does not match %q", tt.template, re, s)
+			}
+		}
+		for _, s := range tt.noMatch {
+			if re.MatchString(s) {
+				t.Errorf("templateRegexp(%q) = %s matches %q", tt.template, re, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// logRotateInterval is how often rotation policies are checked.
+	logRotateInterval = 30 * time.Second
+	// defaultLogRotateKeep is the number of backups a policy keeps when it
+	// leaves keep empty.
+	defaultLogRotateKeep = 5
+	// logBackupLayout is the timestamp appended to backup names:
+	// app.log-20261018-130534, which the log set groups with app.log.
+	logBackupLayout = "20060102-150405"
+)
+
+// logBackupSuffixRe matches the suffix of backups written by rotateLog, so
+// retention never deletes archives made by other tools.
+var logBackupSuffixRe = regexp.MustCompile(`^-\d{8}-\d{6}(?:-\d+)?(?:\.gz)?$`)
+
+// logRotatePolicy is a size-based rotation policy stored in a .mdviewer
+// file. It applies to the live logs in that directory and its
+// subdirectories whose file name matches Files (all when empty).
+type logRotatePolicy struct {
+	Files   string `json:"files,omitempty"`
+	MaxSize string `json:"maxSize"`        // e.g. "100MB", "1GiB"
+	Keep    int    `json:"keep,omitempty"` // backups kept; default 5
+	Gzip    bool   `json:"gzip,omitempty"`
+}
+
+// parseByteSize parses a size such as "512KB", "100MB", "1GiB" or a plain
+// byte count. Decimal and binary units both count in powers of 1024, as
+// file managers commonly do.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// parseSizeLimit is parseByteSize for limits where "0" means no limit.
+func parseSizeLimit(s string) (int64, error) {
+	if strings.TrimSpace(s) == "0" {
+		return 0, nil
+	}
+	return parseByteSize(s)
+}
+
+// rotateLog copies the live log at fullPath to a timestamped backup beside
+// it (gzipped when compress is set) and truncates the log, returning the
+// backup's path, or "" for an empty log. Callers hold the log's ingest
+// lock, so mdviewer's own writers (/api/log/append, the receivers) wait for
+// the rotation. Other writers keep their file handles, as with logrotate's
+// copytruncate; lines they append between the copy and the truncate are
+// lost.
+func rotateLog(fullPath string, compress bool) (string, error) {
+	src, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil // nothing worth keeping
+	}
+
+	base := fullPath + "-" + time.Now().Format(logBackupLayout)
+	ext := ""
+	if compress {
+		ext = ".gz"
+	}
+	backup := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backup); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		backup = base + "-" + strconv.Itoa(i) + ext
+	}
+
+	// Write beside the log and rename, so a failed copy leaves no partial
+	// backup for the log set to pick up.
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".mdviewer-rotate-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(tmp)
+		zw.Name = filepath.Base(fullPath)
+		zw.ModTime = info.ModTime()
+		w = zw
+	}
+	_, err = io.Copy(w, io.NewSectionReader(src, 0, info.Size()))
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	_ = os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err := os.Rename(tmp.Name(), backup); err != nil {
+		return "", err
+	}
+	_ = os.Chtimes(backup, info.ModTime(), info.ModTime())
+	if err := os.Truncate(fullPath, 0); err != nil {
+		return backup, err
+	}
+	return backup, nil
+}
+
+// pruneLogBackups deletes the oldest backups rotateLog made of the log at
+// fullPath, keeping the newest keep.
+func pruneLogBackups(fullPath string, keep int) error {
+	dir, name := filepath.Split(fullPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		n := e.Name()
+		if !e.IsDir() && strings.HasPrefix(n, name) && logBackupSuffixRe.MatchString(n[len(name):]) {
+			backups = append(backups, n)
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+	// The timestamp layout sorts chronologically; a "-N" collision suffix
+	// sorts after its base.
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+	var errs []error
+	for _, n := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, n)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runLogRotation periodically applies the rotation policies found in
+// .mdviewer files: a live log grown past its policy's maxSize is rotated
+// and its oldest backups beyond keep are removed.
+func (a *app) runLogRotation() {
+	ticker := time.NewTicker(logRotateInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.applyLogRotation()
+	}
+}
+
+func (a *app) applyLogRotation() {
+	type scoped struct {
+		dir    string
+		policy logRotatePolicy
+		limit  int64
+	}
+	var policies []scoped
+	_ = filepath.WalkDir(a.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != mdviewerFile {
+			return nil
+		}
+		data, err := readMdviewerFile(filepath.Dir(p))
+		if err != nil || len(data.LogRotate) == 0 {
+			return nil
+		}
+		relDir, err := filepath.Rel(a.root, filepath.Dir(p))
+		if err != nil {
+			return nil
+		}
+		if relDir = filepath.ToSlash(relDir); relDir == "." {
+			relDir = ""
+		}
+		for _, pol := range data.LogRotate {
+			limit, err := parseByteSize(pol.MaxSize)
+			if err != nil {
+				log.Printf("[log-rotate] ignoring policy in %s: %v", p, err)
+				continue
+			}
+			policies = append(policies, scoped{dir: relDir, policy: pol, limit: limit})
+		}
+		return nil
+	})
+	if len(policies) == 0 {
+		return
+	}
+
+	files, err := listMarkdownFiles(a.root)
+	if err != nil {
+		return
+	}
+	for _, rel := range files {
+		if !isLogFile(rel) || isArchivedLog(rel) {
+			continue
+		}
+		// The deepest matching policy wins, like views; within one file the
+		// first listed.
+		var match *scoped
+		for i := range policies {
+			pol := &policies[i]
+			if pol.dir != "" && !strings.HasPrefix(rel, pol.dir+"/") {
+				continue
+			}
+			if pol.policy.Files != "" {
+				if ok, _ := path.Match(pol.policy.Files, path.Base(rel)); !ok {
+					continue
+				}
+			}
+			if match == nil || len(pol.dir) > len(match.dir) {
+				match = pol
+			}
+		}
+		if match == nil {
+			continue
+		}
+		full, err := secureJoin(a.root, rel)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(full)
+		if err != nil || info.Size() < match.limit {
+			continue
+		}
+		lock := a.ingest.lock(full)
+		lock.Lock()
+		backup, err := rotateLog(full, match.policy.Gzip)
+		lock.Unlock()
+		if err != nil {
+			log.Printf("[log-rotate] %s: %v", rel, err)
+			continue
+		}
+		log.Printf("[log-rotate] rotated %s (%d bytes) to %s", rel, info.Size(), filepath.Base(backup))
+		keep := match.policy.Keep
+		if keep <= 0 {
+			keep = defaultLogRotateKeep
+		}
+		if err := pruneLogBackups(full, keep); err != nil {
+			log.Printf("[log-rotate] pruning backups of %s: %v", rel, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"1024", 1024, false},
+		{"512KB", 512 << 10, false},
+		{"100mb", 100 << 20, false},
+		{"1GiB", 1 << 30, false},
+		{" 2 G ", 2 << 30, false},
+		{"1.5M", 3 << 19, false},
+		{"10B", 10, false},
+		{"1T", 1 << 40, false},
+		{"0", 0, true},
+		{"-5MB", 0, true},
+		{"MB", 0, true},
+		{"ten", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRotateLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		compress bool
+	}{
+		{"plain", "line 1\nline 2\n", false},
+		{"gzip", "line 1\nline 2\n", true},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := filepath.Join(t.TempDir(), "app.log")
+			if err := os.WriteFile(live, []byte(tt.content), 0640); err != nil {
+				t.Fatal(err)
+			}
+			backup, err := rotateLog(live, tt.compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.content == "" {
+				if backup != "" {
+					t.Errorf("rotateLog made backup %q of an empty log", backup)
+				}
+				return
+			}
+			if suffix := strings.TrimPrefix(backup, live); !logBackupSuffixRe.MatchString(suffix) || strings.HasSuffix(suffix, ".gz") != tt.compress {
+				t.Errorf("backup name %q has suffix %q", backup, suffix)
+			}
+			if rot := parseLogRotation(filepath.Base(backup)); rot.Family != "app.log" || rot.Date == "" {
+				t.Errorf("parseLogRotation(%q) = %+v, want a dated app.log rotation", filepath.Base(backup), rot)
+			}
+			if info, err := os.Stat(live); err != nil || info.Size() != 0 {
+				t.Errorf("live log not truncated: %v, %v", info, err)
+			}
+			f, err := os.Open(backup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var r io.Reader = f
+			if tt.compress {
+				zr, err := gzip.NewReader(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = zr
+			}
+			if got, err := io.ReadAll(r); err != nil || string(got) != tt.content {
+				t.Errorf("backup holds %q, %v; want %q", got, err, tt.content)
+			}
+			if info, err := f.Stat(); err != nil || info.Mode().Perm() != 0640 {
+				t.Errorf("backup mode = %v, %v; want 0640", info.Mode().Perm(), err)
+			}
+		})
+	}
+}
+
+func TestRotateLogNameCollision(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "app.log")
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(live, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		backup, err := rotateLog(live, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[backup] {
+			t.Fatalf("rotateLog reused backup name %q", backup)
+		}
+		seen[backup] = true
+	}
+}
+
+func TestPruneLogBackups(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"app.log",
+		"app.log-20261016-090000.gz",
+		"app.log-20261017-090000",
+		"app.log-20261017-090000-1",
+		"app.log-20261018-090000.gz",
+		"app.log.1",                 // made by another tool
+		"app.log-old",               // not a rotateLog backup
+		"other.log-20261015-090000", // another log
+	}
+	for _, n := range files {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pruneLogBackups(filepath.Join(dir, "app.log"), 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{"app.log", "app.log-20261017-090000-1", "app.log-20261018-090000.gz", "app.log-old", "app.log.1", "other.log-20261015-090000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after pruning: %q, want %q", got, want)
+	}
+}
+
+func TestParseSizeLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"0", 0, false},
+		{" 0 ", 0, false},
+		{"256MB", 256 << 20, false},
+		{"0MB", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSizeLimit(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseSizeLimit(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultLogSearchLimit and maxLogSearchLimit bound the matches returned
+	// by one /api/log/search request.
+	defaultLogSearchLimit = 200
+	maxLogSearchLimit     = 5000
+	// maxLogSearchScan bounds the bytes scanned by one request, so a rare
+	// match in a huge file is found over several pages instead of one very
+	// long request.
+	maxLogSearchScan = 256 << 20 // 256 MiB
+)
+
+// fieldPredicate compares one field of a structured log record, e.g.
+// "level=error", "status>=500" or "msg~timeout".
+type fieldPredicate struct {
+	Key   string // field name; dots address nested objects ("http.status")
+	Op    string // "=", "!=", "~", "!~", ">", ">=", "<" or "<="
+	Value string
+}
+
+// logQuery is a server-side filter over log lines: a case-insensitive
+// substring, a regular expression and field predicates, all of which must
+// match.
+type logQuery struct {
+	Text   string // lower-cased substring
+	Regex  *regexp.Regexp
+	Fields []fieldPredicate
+	// Parse turns a line into a record for the field predicates; nil means
+	// JSON only. See logRecordParser.
+	Parse func(line []byte) map[string]any
+}
+
+// fieldPredicateOps lists the operators in the order they are tried, so
+// two-character operators win over their one-character prefixes.
+var fieldPredicateOps = []string{"!=", ">=", "<=", "!~", "=", "~", ">", "<"}
+
+// parseFieldPredicate parses "key<op>value".
+func parseFieldPredicate(s string) (fieldPredicate, error) {
+	best, bestOp := -1, ""
+	for _, op := range fieldPredicateOps {
+		if i := strings.Index(s, op); i > 0 && (best < 0 || i < best) {
+			best, bestOp = i, op
+		}
+	}
+	if best < 0 {
+		return fieldPredicate{}, fmt.Errorf("invalid field predicate %q", s)
+	}
+	return fieldPredicate{
+		Key:   strings.TrimSpace(s[:best]),
+		Op:    bestOp,
+		Value: strings.TrimSpace(s[best+len(bestOp):]),
+	}, nil
+}
+
+// parseLogQuery builds a logQuery from request parameters: q (substring, or
+// a regular expression with mode=regex) and repeated where=<predicate>.
+func parseLogQuery(params url.Values) (logQuery, error) {
+	var lq logQuery
+	text := params.Get("q")
+	switch params.Get("mode") {
+	case "", "substring":
+		lq.Text = strings.ToLower(text)
+	case "regex":
+		if text != "" {
+			re, err := regexp.Compile(text)
+			if err != nil {
+				return lq, fmt.Errorf("invalid regex: %w", err)
+			}
+			lq.Regex = re
+		}
+	default:
+		return lq, errors.New("invalid mode")
+	}
+	for _, raw := range params["where"] {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		p, err := parseFieldPredicate(raw)
+		if err != nil {
+			return lq, err
+		}
+		lq.Fields = append(lq.Fields, p)
+	}
+	return lq, nil
+}
+
+// empty reports whether the query matches every line.
+func (q logQuery) empty() bool {
+	return q.Text == "" && q.Regex == nil && len(q.Fields) == 0
+}
+
+// match reports whether line satisfies the query.
+func (q logQuery) match(line []byte) bool {
+	return q.matchEntry(line, line)
+}
+
+// matchEntry reports whether a multi-line entry satisfies the query: text
+// and regex are matched against the whole entry without ANSI escapes, field
+// predicates against the record parsed from its first line, head.
+func (q logQuery) matchEntry(entry, head []byte) bool {
+	if (q.Text != "" || q.Regex != nil) && bytes.IndexByte(entry, 0x1b) >= 0 {
+		// Colour codes would otherwise split the words being searched for.
+		entry = stripANSI(entry)
+	}
+	if q.Text != "" && !bytes.Contains(bytes.ToLower(entry), []byte(q.Text)) {
+		return false
+	}
+	if q.Regex != nil && !q.Regex.Match(entry) {
+		return false
+	}
+	if len(q.Fields) == 0 {
+		return true
+	}
+	parse := q.Parse
+	if parse == nil {
+		parse = parseJSONRecord
+	}
+	rec := parse(head)
+	if rec == nil {
+		return false // field predicates exclude unstructured lines
+	}
+	for _, p := range q.Fields {
+		if !p.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseJSONRecord decodes a line holding a JSON object, or returns nil.
+func parseJSONRecord(line []byte) map[string]any {
+	t := bytes.TrimSpace(line)
+	if len(t) == 0 || t[0] != '{' {
+		return nil
+	}
+	var rec map[string]any
+	if json.Unmarshal(t, &rec) != nil {
+		return nil
+	}
+	return rec
+}
+
+// lookupField finds key in rec, trying the literal key first and then a
+// dotted path into nested objects.
+func lookupField(rec map[string]any, key string) (any, bool) {
+	if v, ok := rec[key]; ok {
+		return v, true
+	}
+	var cur any = rec
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// fieldString renders a record value the way the log table shows it:
+// objects and arrays as JSON, null as empty.
+func fieldString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// fieldNumber returns a record value as a number, accepting numeric strings.
+func fieldNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func (p fieldPredicate) match(rec map[string]any) bool {
+	v, ok := lookupField(rec, p.Key)
+	switch p.Op {
+	case "=":
+		return ok && strings.EqualFold(fieldString(v), p.Value)
+	case "!=":
+		return !ok || !strings.EqualFold(fieldString(v), p.Value)
+	case "~":
+		return ok && strings.Contains(strings.ToLower(fieldString(v)), strings.ToLower(p.Value))
+	case "!~":
+		return !ok || !strings.Contains(strings.ToLower(fieldString(v)), strings.ToLower(p.Value))
+	}
+	if !ok {
+		return false
+	}
+	n, ok := fieldNumber(v)
+	want, err := strconv.ParseFloat(p.Value, 64)
+	if !ok || err != nil {
+		return false
+	}
+	switch p.Op {
+	case ">":
+		return n > want
+	case ">=":
+		return n >= want
+	case "<":
+		return n < want
+	case "<=":
+		return n <= want
+	}
+	return false
+}
+
+// scanLogLines reads lines from r, which is positioned at byte offset
+// start, calling fn with each line's offset and content (without the line
+// terminator). Scanning stops when fn returns false. A final line without a
+// trailing newline is included.
+func scanLogLines(r io.Reader, start int64, fn func(offset int64, line []byte) bool) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	offset := start
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			n := int64(len(line))
+			line = bytes.TrimRight(line, "\r\n")
+			if !fn(offset, line) {
+				return nil
+			}
+			offset += n
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logMatch is one matching line, or entry, returned by /api/log/search.
+type logMatch struct {
+	Offset int64  `json:"offset"`
+	Line   int64  `json:"line"`
+	Text   string `json:"text"`
+	Lines  int    `json:"lines,omitempty"` // physical lines in a multi-line entry
+	// ANSI holds the styled spans of Text with ansi=spans, when it had
+	// escapes.
+	ANSI []ansiSpan `json:"ansi,omitempty"`
+}
+
+// parseLogCursor decodes a search cursor of the form "<offset>:<line>". An
+// empty cursor starts at the beginning of the file.
+func parseLogCursor(s string) (offset, line int64, err error) {
+	if s == "" {
+		return 0, 1, nil
+	}
+	off, ln, ok := strings.Cut(s, ":")
+	if offset, err = strconv.ParseInt(off, 10, 64); err != nil || offset < 0 {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	line = 1
+	if ok {
+		if line, err = strconv.ParseInt(ln, 10, 64); err != nil || line < 1 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+	}
+	return offset, line, nil
+}
+
+// handleLogSearch scans a whole log file server-side and returns the lines
+// matching q (substring, or regex with mode=regex) and any where=<field
+// predicate>, with their byte offsets and line numbers. Fields come from the
+// file's detected format (or format=<name>). With entries=/entryStart=
+// (see parseEntryRule) whole multi-line entries are matched and returned,
+// so a search for an exception finds its whole stack trace. Results are
+// paged: pass the returned next cursor to continue; it is empty once the
+// end of the file has been reached.
+func (a *app) handleLogSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	relPath, err := sanitizeRelativePath(params.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	query, err := parseLogQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ansiMode, err := parseANSIMode(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultLogSearchLimit
+	if raw := params.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxLogSearchLimit)
+	}
+	start, lineNo, err := parseLogCursor(params.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f, err := a.openLog(relPath, fullPath, params.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	size := info.Size()
+	format := params.Get("format")
+	if format == "" || format == "auto" {
+		if format, err = detectLogFileFormat(f); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	query.Parse = logRecordParser(format)
+	rule, err := parseEntryRule(params, info.ModTime())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if start > size {
+		start, lineNo = size, 1
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	matches := []logMatch{}
+	nextOffset := int64(-1)
+	ctx := r.Context()
+	// entry accumulates the current entry; without a rule every line is one.
+	var entry struct {
+		active bool
+		offset int64
+		line   int64
+		lines  int
+		text   []byte
+		head   []byte
+	}
+	flush := func() {
+		if !entry.active {
+			return
+		}
+		// Secrets are masked before matching, so searching for one finds
+		// nothing.
+		text := a.redact.redact(entry.text)
+		if query.matchEntry(text, text[:len(entry.head)]) {
+			m := logMatch{Offset: entry.offset, Line: entry.line, Text: string(text)}
+			if ansiMode != "" && bytes.IndexByte(text, 0x1b) >= 0 {
+				m.Text = string(stripANSI(text))
+				if ansiMode == "spans" {
+					m.ANSI = ansiSpans(text)
+				}
+			}
+			if entry.lines > 1 {
+				m.Lines = entry.lines
+			}
+			matches = append(matches, m)
+		}
+		entry.active = false
+	}
+	err = scanLogLines(io.LimitReader(f, size-start), start, func(offset int64, line []byte) bool {
+		if rule == nil || !entry.active || rule.starts(line) {
+			flush()
+			if len(matches) >= limit || offset-start >= maxLogSearchScan || ctx.Err() != nil {
+				nextOffset = offset
+				return false
+			}
+			entry.active, entry.offset, entry.line, entry.lines = true, offset, lineNo, 1
+			entry.text = append(entry.text[:0], line...)
+			entry.head = entry.text[:len(line):len(line)]
+		} else {
+			entry.lines++
+			if len(entry.text)+len(line) < maxEntryBytes {
+				entry.text = append(append(entry.text, '\n'), line...)
+			}
+		}
+		lineNo++
+		return true
+	})
+	if nextOffset < 0 {
+		flush()
+	}
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	next, scanned := "", size-start
+	if nextOffset >= 0 {
+		next = fmt.Sprintf("%d:%d", nextOffset, lineNo)
+		scanned = nextOffset - start
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path    string     `json:"path"`
+		Format  string     `json:"format"`
+		Matches []logMatch `json:"matches"`
+		Next    string     `json:"next"`
+		Scanned int64      `json:"scanned"`
+		Size    int64      `json:"size"`
+	}{
+		Path:    relPath,
+		Format:  format,
+		Matches: matches,
+		Next:    next,
+		Scanned: scanned,
+		Size:    size,
+	})
+}
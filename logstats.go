@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLogStatsScan bounds the bytes read by one /api/log/stats request.
+	maxLogStatsScan = 1 << 30 // 1 GiB
+	// maxStatsFields bounds the fields reported when none are requested.
+	maxStatsFields = 50
+	// maxStatsDistinct bounds the distinct values counted per field; values
+	// first seen after that are not counted individually.
+	maxStatsDistinct = 10000
+	// statsSampleSize is the reservoir size used for numeric percentiles;
+	// they are exact for fields with fewer values.
+	statsSampleSize = 100000
+	// defaultStatsTop is the number of top values returned per field, and
+	// maxStatsTop the most a request may ask for.
+	defaultStatsTop = 10
+	maxStatsTop     = 1000
+)
+
+// valueCount is one value of a field and the number of records holding it.
+type valueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// numericStats summarises a field whose values are all numbers.
+type numericStats struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+}
+
+// fieldStats is the facet summary of one field.
+type fieldStats struct {
+	Field    string        `json:"field"`
+	Count    int           `json:"count"`
+	Distinct int           `json:"distinct"`
+	Capped   bool          `json:"capped,omitempty"` // distinct values exceeded maxStatsDistinct
+	Top      []valueCount  `json:"top"`
+	Numeric  *numericStats `json:"numeric,omitempty"`
+}
+
+// fieldAccumulator collects the values of one field.
+type fieldAccumulator struct {
+	count   int
+	values  map[string]int
+	capped  bool
+	numeric bool // every value so far is a number
+	n       int
+	sum     float64
+	min     float64
+	max     float64
+	sample  []float64
+}
+
+func newFieldAccumulator() *fieldAccumulator {
+	return &fieldAccumulator{values: make(map[string]int), numeric: true}
+}
+
+func (acc *fieldAccumulator) add(v any) {
+	acc.count++
+	s := fieldString(v)
+	if _, ok := acc.values[s]; ok || len(acc.values) < maxStatsDistinct {
+		acc.values[s]++
+	} else {
+		acc.capped = true
+	}
+	if !acc.numeric {
+		return
+	}
+	f, ok := fieldNumber(v)
+	if !ok {
+		acc.numeric = false
+		acc.sample = nil
+		return
+	}
+	if acc.n == 0 || f < acc.min {
+		acc.min = f
+	}
+	if acc.n == 0 || f > acc.max {
+		acc.max = f
+	}
+	acc.n++
+	acc.sum += f
+	if len(acc.sample) < statsSampleSize {
+		acc.sample = append(acc.sample, f)
+	} else if i := rand.Intn(acc.n); i < statsSampleSize {
+		acc.sample[i] = f
+	}
+}
+
+// percentile returns the p-th percentile (0-100) of sorted values using the
+// nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func (acc *fieldAccumulator) result(field string, top int) fieldStats {
+	fs := fieldStats{Field: field, Count: acc.count, Distinct: len(acc.values), Capped: acc.capped, Top: []valueCount{}}
+	for v, c := range acc.values {
+		fs.Top = append(fs.Top, valueCount{Value: v, Count: c})
+	}
+	sort.Slice(fs.Top, func(i, j int) bool {
+		if fs.Top[i].Count != fs.Top[j].Count {
+			return fs.Top[i].Count > fs.Top[j].Count
+		}
+		return fs.Top[i].Value < fs.Top[j].Value
+	})
+	if len(fs.Top) > top {
+		fs.Top = fs.Top[:top]
+	}
+	if acc.numeric && acc.n > 0 {
+		sort.Float64s(acc.sample)
+		fs.Numeric = &numericStats{
+			Min:  acc.min,
+			Max:  acc.max,
+			Mean: acc.sum / float64(acc.n),
+			P50:  percentile(acc.sample, 50),
+			P90:  percentile(acc.sample, 90),
+			P95:  percentile(acc.sample, 95),
+			P99:  percentile(acc.sample, 99),
+		}
+	}
+	return fs
+}
+
+// handleLogStats computes facets over a whole structured log: for each
+// field, the top values with counts and, for numeric fields, min, max, mean
+// and percentiles. fields (comma-separated, dotted paths allowed) selects
+// the fields; without it every top-level field seen is reported. Records
+// can be filtered with the /api/log/search parameters (q, mode, where,
+// format), so a facet value can be drilled into with where=field=value.
+func (a *app) handleLogStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	relPath, err := sanitizeRelativePath(params.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	query, err := parseLogQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var fields []string
+	for _, f := range strings.Split(params.Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	top := defaultStatsTop
+	if raw := params.Get("top"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			http.Error(w, "invalid top", http.StatusBadRequest)
+			return
+		}
+		top = min(v, maxStatsTop)
+	}
+
+	f, err := a.openLog(relPath, fullPath, params.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	format := params.Get("format")
+	if format == "" || format == "auto" {
+		if format, err = detectLogFileFormat(f); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	parse := logRecordParser(format)
+	query.Parse = parse
+
+	accs := make(map[string]*fieldAccumulator)
+	order := append([]string(nil), fields...)
+	for _, name := range fields {
+		accs[name] = newFieldAccumulator()
+	}
+	var lines, records int
+	var scanned int64
+	complete := true
+	ctx := r.Context()
+	err = scanLogLines(io.NewSectionReader(f, 0, info.Size()), 0, func(offset int64, line []byte) bool {
+		if offset >= maxLogStatsScan || ctx.Err() != nil {
+			complete = false
+			return false
+		}
+		scanned = offset + int64(len(line)) + 1
+		lines++
+		if !query.match(a.redact.redact(line)) {
+			return true
+		}
+		rec := parse(line)
+		if rec == nil {
+			return true
+		}
+		a.redact.redactRecord(rec)
+		records++
+		if len(fields) > 0 {
+			for _, name := range fields {
+				if v, ok := lookupField(rec, name); ok {
+					accs[name].add(v)
+				}
+			}
+			return true
+		}
+		for k, v := range rec {
+			acc, ok := accs[k]
+			if !ok {
+				if len(accs) >= maxStatsFields {
+					continue
+				}
+				acc = newFieldAccumulator()
+				accs[k] = acc
+				order = append(order, k)
+			}
+			acc.add(v)
+		}
+		return true
+	})
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	if len(fields) == 0 {
+		// Most common fields first.
+		sort.SliceStable(order, func(i, j int) bool { return accs[order[i]].count > accs[order[j]].count })
+	}
+	stats := make([]fieldStats, 0, len(order))
+	for _, name := range order {
+		stats = append(stats, accs[name].result(name, top))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path     string       `json:"path"`
+		Format   string       `json:"format"`
+		Lines    int          `json:"lines"`
+		Records  int          `json:"records"`
+		Scanned  int64        `json:"scanned"`
+		Size     int64        `json:"size"`
+		Complete bool         `json:"complete"`
+		Fields   []fieldStats `json:"fields"`
+	}{
+		Path:     relPath,
+		Format:   format,
+		Lines:    lines,
+		Records:  records,
+		Scanned:  min(scanned, info.Size()),
+		Size:     info.Size(),
+		Complete: complete,
+		Fields:   stats,
+	})
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// logWatchInterval is how often a shared watcher checks its file for
+	// appended bytes, truncation and rotation.
+	logWatchInterval = 250 * time.Millisecond
+	// maxLogChunkBytes caps the bytes carried by a single stream event.
+	maxLogChunkBytes = 1 << 20 // 1 MiB
+	// logStreamHeartbeat keeps idle streams (and proxies) from timing out.
+	logStreamHeartbeat = 15 * time.Second
+)
+
+// logChunk is a piece of a log file pushed to stream subscribers. It has the
+// same shape as the /api/log response so clients can handle both alike.
+// Reset is set when the file was truncated or rotated and the subscriber
+// should discard what it has before appending Content.
+type logChunk struct {
+	Content   string `json:"content"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Reset     bool   `json:"reset,omitempty"`
+	// Entries holds the offsets of lines starting log entries, filled in
+	// per subscriber when entry grouping was requested.
+	Entries []int64 `json:"entries,omitempty"`
+	// ANSI holds styled spans per line, filled in per subscriber with
+	// ansi=spans.
+	ANSI []ansiLine `json:"ansi,omitempty"`
+}
+
+// logHub owns one watcher per log file, shared by every subscriber tailing
+// that file, so many open tabs cost a single stat/read loop.
+type logHub struct {
+	mu       sync.Mutex
+	watchers map[string]*logWatcher // keyed by absolute path
+	// wholeLines makes watchers deliver complete lines only, holding back
+	// an unfinished last line. Redaction needs it: a secret cut in two by
+	// a chunk boundary would match no rule.
+	wholeLines bool
+}
+
+// logWatcher polls a single file and fans appended bytes out to its
+// subscribers. It stops once the last subscriber leaves.
+type logWatcher struct {
+	hub    *logHub
+	path   string
+	subs   map[*logSub]struct{}
+	offset int64       // bytes delivered so far; guarded by hub.mu
+	info   os.FileInfo // last stat, used to detect rotation
+	stop   chan struct{}
+}
+
+// logSub is one subscriber. Chunks are delivered on C; if the subscriber
+// falls too far behind, C is closed and it must resubscribe.
+type logSub struct {
+	C chan logChunk
+	w *logWatcher
+}
+
+func newLogHub() *logHub {
+	return &logHub{watchers: make(map[string]*logWatcher)}
+}
+
+// subscribe registers a subscriber for fullPath, starting a watcher if
+// needed. It returns the offset up to which the watcher has read; chunks
+// delivered on the subscription start at that offset.
+func (h *logHub) subscribe(fullPath string) (*logSub, int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.watchers[fullPath]
+	if !ok {
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset := info.Size()
+		if h.wholeLines {
+			if offset, err = completeLinesEnd(fullPath, offset); err != nil {
+				return nil, 0, err
+			}
+		}
+		w = &logWatcher{
+			hub:    h,
+			path:   fullPath,
+			subs:   make(map[*logSub]struct{}),
+			offset: offset,
+			info:   info,
+			stop:   make(chan struct{}),
+		}
+		h.watchers[fullPath] = w
+		go w.run()
+	}
+	s := &logSub{C: make(chan logChunk, 64), w: w}
+	w.subs[s] = struct{}{}
+	return s, w.offset, nil
+}
+
+// completeLinesEnd returns where the last complete line of the first size
+// bytes of a file ends: size, unless the file ends in an unfinished line.
+func completeLinesEnd(fullPath string, size int64) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var last [1]byte
+	if _, err := f.ReadAt(last[:], size-1); err != nil {
+		return 0, err
+	}
+	if last[0] == '\n' {
+		return size, nil
+	}
+	return lineStartBefore(f, size)
+}
+
+// unsubscribe removes s, stopping its watcher when no subscribers remain.
+func (h *logHub) unsubscribe(s *logSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := s.w
+	if _, ok := w.subs[s]; !ok {
+		return
+	}
+	delete(w.subs, s)
+	close(s.C)
+	w.retireIfIdle()
+}
+
+// retireIfIdle stops the watcher once it has no subscribers. The caller
+// must hold hub.mu.
+func (w *logWatcher) retireIfIdle() {
+	if len(w.subs) == 0 && w.hub.watchers[w.path] == w {
+		close(w.stop)
+		delete(w.hub.watchers, w.path)
+	}
+}
+
+func (w *logWatcher) run() {
+	ticker := time.NewTicker(logWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll reads whatever was appended since the last poll and broadcasts it.
+// A file that shrank (cleared) or was replaced (rotated) is re-read from
+// the beginning with Reset set, as handleLogTail does for a stale offset.
+// With hub.wholeLines, an unfinished last line waits for the next poll
+// unless it alone fills a chunk.
+func (w *logWatcher) poll() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return // missing for now (mid-rotation); try again next tick
+	}
+	w.hub.mu.Lock()
+	offset := w.offset
+	prev := w.info
+	w.hub.mu.Unlock()
+
+	reset := false
+	if !os.SameFile(prev, info) || info.Size() < offset {
+		offset = 0
+		reset = true
+	}
+	size := info.Size()
+	if !reset && size == offset {
+		w.hub.mu.Lock()
+		w.info = info
+		w.hub.mu.Unlock()
+		return
+	}
+
+	f, err := os.Open(w.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for offset < size || reset {
+		n := size - offset
+		if n > maxLogChunkBytes {
+			n = maxLogChunkBytes
+		}
+		buf := make([]byte, n)
+		read, rerr := f.ReadAt(buf, offset)
+		if rerr != nil && rerr != io.EOF {
+			return
+		}
+		buf = buf[:read]
+		if w.hub.wholeLines {
+			if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+				buf = buf[:i+1]
+			} else if read < maxLogChunkBytes {
+				buf = buf[:0]
+			}
+		}
+		if len(buf) == 0 && !reset {
+			break
+		}
+		offset += int64(len(buf))
+		w.broadcast(logChunk{Content: string(buf), Offset: offset, Size: size, Truncated: reset, Reset: reset}, info)
+		reset = false
+		if len(buf) == 0 {
+			break
+		}
+	}
+}
+
+// broadcast delivers c to every subscriber and records the new offset.
+// Subscribers whose buffer is full are dropped rather than blocking the
+// watcher; they reconnect from their last offset.
+func (w *logWatcher) broadcast(c logChunk, info os.FileInfo) {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	w.offset = c.Offset
+	w.info = info
+	for s := range w.subs {
+		select {
+		case s.C <- c:
+		default:
+			delete(w.subs, s)
+			close(s.C)
+		}
+	}
+	w.retireIfIdle()
+}
+
+// readLogRange reads bytes [start, end) of an open log file.
+func readLogRange(f logReader, start, end int64) ([]byte, error) {
+	if start >= end {
+		return nil, nil
+	}
+	buf := make([]byte, end-start)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// writeSSE writes one server-sent event with a JSON payload. For a single
+// log the id is the log offset, so a reconnecting EventSource resumes where
+// it left off; an empty id is omitted.
+func writeSSE(w http.ResponseWriter, event, id string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", event, id, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	}
+	return err
+}
+
+// handleLogStream pushes a log file's appended bytes to the client as
+// server-sent "log" events, sharing one watcher per file across all
+// subscribers. Like /api/log, a missing offset starts from the tail (capped
+// to maxLogInitialBytes) and an offset past the end of a shrunken file
+// restarts from the beginning. Reconnects resume from Last-Event-ID. With
+// entries=/entryStart= (see parseEntryRule), each event lists the entry
+// starts among the lines it completes; ansi= applies per event as in
+// /api/log.
+func (a *app) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	if isArchivedLog(relPath) {
+		http.Error(w, "rotated and compressed logs cannot be tailed", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var ref time.Time
+	if info, err := os.Stat(fullPath); err == nil {
+		ref = info.ModTime()
+	}
+	rule, err := parseEntryRule(r.URL.Query(), ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ansiMode, err := parseANSIMode(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset := int64(-1)
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("offset")
+	}
+	if raw != "" {
+		if v, perr := strconv.ParseInt(raw, 10, 64); perr == nil {
+			offset = v
+		}
+	}
+
+	sub, current, err := a.logs.subscribe(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer a.logs.unsubscribe(sub)
+
+	// Catch the client up to the watcher's offset; live chunks follow.
+	first := logChunk{Offset: current, Size: current}
+	var start int64
+	switch {
+	case offset < 0:
+		if current > maxLogInitialBytes {
+			start = current - maxLogInitialBytes
+			first.Truncated = true
+		}
+		first.Reset = true
+	case offset > current:
+		first.Truncated = true
+		first.Reset = true
+	default:
+		start = offset
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	content, err := readLogRange(f, start, current)
+	if err == nil && first.Truncated && start > 0 && a.redact != nil {
+		// Start on a whole line, so no secret is cut in two.
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			start += int64(i) + 1
+			content = content[i+1:]
+		}
+	}
+	var entries *entryScanner
+	if err == nil && rule != nil {
+		if entries, err = newEntryScanner(f, rule, start); err == nil {
+			first.Entries = entries.feed(content, start)
+		}
+	}
+	f.Close()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	// carry holds an unterminated private key block for the next chunk.
+	content, carry := a.redact.redactChunk(nil, content)
+	content, first.ANSI = applyANSIMode(ansiMode, content)
+	first.Content = string(content)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := writeSSE(w, "log", strconv.FormatInt(first.Offset, 10), first); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case c, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects.
+				return
+			}
+			if entries != nil {
+				chunkStart := c.Offset - int64(len(c.Content))
+				if c.Reset {
+					entries = &entryScanner{rule: rule}
+				}
+				c.Entries = entries.feed([]byte(c.Content), chunkStart)
+			}
+			if ansiMode != "" || a.redact != nil {
+				if c.Reset {
+					carry = nil
+				}
+				var content []byte
+				content, carry = a.redact.redactChunk(carry, []byte(c.Content))
+				content, c.ANSI = applyANSIMode(ansiMode, content)
+				c.Content = string(content)
+			}
+			if err := writeSSE(w, "log", strconv.FormatInt(c.Offset, 10), c); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
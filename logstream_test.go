@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestWatcher watches path from offset 0 without starting its poll loop.
+func newTestWatcher(t *testing.T, path string, wholeLines bool) (*logWatcher, *logSub) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &logHub{watchers: make(map[string]*logWatcher), wholeLines: wholeLines}
+	w := &logWatcher{hub: h, path: path, subs: make(map[*logSub]struct{}), info: info, stop: make(chan struct{})}
+	s := &logSub{C: make(chan logChunk, 8), w: w}
+	w.subs[s] = struct{}{}
+	h.watchers[path] = w
+	return w, s
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// received drains the chunks delivered so far.
+func received(s *logSub) string {
+	var out string
+	for {
+		select {
+		case c := <-s.C:
+			out += c.Content
+		default:
+			return out
+		}
+	}
+}
+
+func TestLogWatcherWholeLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, s := newTestWatcher(t, path, true)
+
+	appendFile(t, path, "login password=hun")
+	w.poll()
+	if got := received(s); got != "" {
+		t.Fatalf("unfinished line delivered: %q", got)
+	}
+	appendFile(t, path, "ter2\nnext")
+	w.poll()
+	got := received(s)
+	if got != "login password=hunter2\n" {
+		t.Fatalf("got %q", got)
+	}
+	rd, err := newRedactor(true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if masked, _ := rd.redactChunk(nil, []byte(got)); string(masked) != "login password=*******\n" {
+		t.Errorf("masked = %q", masked)
+	}
+}
+
+func TestLogWatcherPartialLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, s := newTestWatcher(t, path, false)
+	appendFile(t, path, "progress 50%")
+	w.poll()
+	if got := received(s); got != "progress 50%" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCompleteLinesEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	tests := []struct {
+		content string
+		want    int64
+	}{
+		{"", 0},
+		{"one\n", 4},
+		{"one\ntw", 4},
+		{"partial", 0},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := completeLinesEnd(path, int64(len(tt.content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("completeLinesEnd(%q) = %d, want %d", tt.content, got, tt.want)
+		}
+	}
+}
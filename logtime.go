@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logTimeKeys are the JSON fields checked, in order, for a record's
+// timestamp. They match the time columns the log table shows first.
+var logTimeKeys = []string{"time", "timestamp", "ts", "@timestamp", "date", "datetime"}
+
+// logTimePrefixRes match a timestamp at the start of a plain-text line
+// (optionally in brackets), most specific first.
+var logTimePrefixRes = []*regexp.Regexp{
+	// RFC3339 / ISO 8601: 2026-10-18T09:15:02.123Z, 2026-10-18 09:15:02,123
+	regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:\s?(?:Z|[+-]\d{2}:?\d{2}))?)`),
+	// Go log package: 2026/10/18 09:15:02.123456
+	regexp.MustCompile(`^\[?(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)`),
+	// Syslog (RFC 3164): Oct 18 09:15:02
+	regexp.MustCompile(`^\[?((?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ \d]\d \d{2}:\d{2}:\d{2})`),
+	// Epoch seconds (with optional fraction) or milliseconds.
+	regexp.MustCompile(`^\[?(\d{10}(?:\.\d+)?|\d{13})\b`),
+}
+
+// logTimeBracketRe matches the common/combined access log timestamp, which
+// follows the client address rather than starting the line.
+var logTimeBracketRe = regexp.MustCompile(`\[(\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`)
+
+// logTimeLayouts are tried in order by parseLogTimeString. Layouts without a
+// zone are read in local time, as the Go log package writes them.
+var logTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.Stamp,
+	"2006-01-02",
+}
+
+// parseLogTimeString parses a timestamp in any of the supported formats:
+// RFC3339 and ISO 8601 variants, Go log, syslog, access log and epoch
+// seconds/milliseconds/microseconds/nanoseconds. Syslog timestamps carry no
+// year; ref supplies it (typically the file's modification time), and a
+// result later than ref is taken to be from the previous year.
+func parseLogTimeString(s string, ref time.Time) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return epochTime(f)
+	}
+	s = strings.Replace(s, ",", ".", 1) // 09:15:02,123 (log4j, Python)
+	for _, layout := range logTimeLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == time.Stamp {
+			t = time.Date(ref.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+			if t.After(ref.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// epochTime interprets a Unix timestamp, inferring seconds, milliseconds,
+// microseconds or nanoseconds from its magnitude.
+func epochTime(f float64) (time.Time, bool) {
+	if f <= 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, false
+	}
+	switch {
+	case f >= 1e17:
+		return time.Unix(0, int64(f)), true
+	case f >= 1e14:
+		return time.UnixMicro(int64(f)), true
+	case f >= 1e11:
+		return time.UnixMilli(int64(f)), true
+	default:
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+}
+
+// detectLogTime finds the timestamp of a log line: a time field of a JSON
+// record, a timestamp starting a plain-text line, or an access log
+// timestamp. ref supplies the year for syslog timestamps.
+func detectLogTime(line []byte, ref time.Time) (time.Time, bool) {
+	if rec := parseJSONRecord(line); rec != nil {
+		for _, key := range logTimeKeys {
+			switch v := rec[key].(type) {
+			case string:
+				if t, ok := parseLogTimeString(v, ref); ok {
+					return t, true
+				}
+			case float64:
+				if t, ok := epochTime(v); ok {
+					return t, true
+				}
+			}
+		}
+		return time.Time{}, false
+	}
+	for _, re := range logTimePrefixRes {
+		if m := re.FindSubmatch(line); m != nil {
+			if t, ok := parseLogTimeString(string(m[1]), ref); ok {
+				return t, true
+			}
+		}
+	}
+	if m := logTimeBracketRe.FindSubmatch(line); m != nil {
+		return parseLogTimeString(string(m[1]), ref)
+	}
+	return time.Time{}, false
+}
+
+// logSeekWindow is the span below which seekLogTime stops bisecting and
+// scans line by line.
+const logSeekWindow = 64 << 10
+
+// maxLogSeekProbe bounds the lines read after a bisection point while
+// looking for one with a timestamp.
+const maxLogSeekProbe = 1000
+
+// nextTimestampedLine returns the first line starting at or after from (and
+// before limit) that carries a timestamp, probing up to maxLogSeekProbe
+// lines.
+func nextTimestampedLine(f logReader, from, limit int64, ref time.Time) (int64, time.Time, bool, error) {
+	off, stamp, found, _, err := probeTimestampedLine(f, from, limit, ref)
+	return off, stamp, found, err
+}
+
+// probeTimestampedLine is nextTimestampedLine that also returns, when no
+// timestamp turned up, where to resume probing: limit once the range is
+// exhausted, or past the last line read when the probe budget ran out.
+func probeTimestampedLine(f logReader, from, limit int64, ref time.Time) (off int64, stamp time.Time, found bool, next int64, err error) {
+	if from > 0 {
+		// Skip the rest of the line containing from-1.
+		start, err := lineStartBefore(f, from)
+		if err != nil {
+			return 0, time.Time{}, false, limit, err
+		}
+		if start < from {
+			br := bufio.NewReader(io.NewSectionReader(f, start, limit-start))
+			line, err := br.ReadBytes('\n')
+			if err != nil {
+				return 0, time.Time{}, false, limit, nil // no line starts before limit
+			}
+			from = start + int64(len(line))
+		}
+	}
+	next = limit
+	seen := 0
+	err = scanLogLines(io.NewSectionReader(f, from, max(limit-from, 0)), from, func(o int64, line []byte) bool {
+		if t, ok := detectLogTime(line, ref); ok {
+			off, stamp, found = o, t, true
+			return false
+		}
+		if seen++; seen >= maxLogSeekProbe {
+			next = o + 1 // the line after o
+			return false
+		}
+		return true
+	})
+	return off, stamp, found, next, err
+}
+
+// seekLogTime returns the offset of the first line whose timestamp is at or
+// after target, bisecting on byte offsets. Lines without a timestamp (such
+// as stack trace continuations) are skipped. Timestamps are assumed to be
+// non-decreasing. found is false when every timestamped line is earlier.
+func seekLogTime(f logReader, size int64, target, ref time.Time) (int64, time.Time, bool, error) {
+	lo, hi := int64(0), size
+	best, bestTime, found := size, time.Time{}, false
+	for hi-lo > logSeekWindow {
+		mid := lo + (hi-lo)/2
+		off, t, ok, next, err := probeTimestampedLine(f, mid, hi, ref)
+		// A block without timestamps longer than the probe budget (a long
+		// stack trace) says nothing about the lines after it: probe on.
+		for !ok && next < hi && err == nil {
+			off, t, ok, next, err = probeTimestampedLine(f, next, hi, ref)
+		}
+		if err != nil {
+			return 0, time.Time{}, false, err
+		}
+		switch {
+		case !ok:
+			hi = mid
+		case !t.Before(target):
+			best, bestTime, found = off, t, true
+			hi = mid
+		default:
+			lo = off
+		}
+	}
+	// lo is a line start (or 0); scan line by line up to the best candidate.
+	err := scanLogLines(io.NewSectionReader(f, lo, size-lo), lo, func(o int64, line []byte) bool {
+		if o >= best {
+			return false
+		}
+		if t, ok := detectLogTime(line, ref); ok && !t.Before(target) {
+			best, bestTime, found = o, t, true
+			return false
+		}
+		return true
+	})
+	return best, bestTime, found, err
+}
+
+// handleLogSeek finds the first line of a log file at or after a time, so a
+// log can be opened at the moment something happened. time accepts the same
+// formats as log lines (RFC3339, epoch seconds or milliseconds, Go log,
+// syslog). The returned line and offset can be passed to /api/log as line=
+// or before=.
+func (a *app) handleLogSeek(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	relPath, err := sanitizeRelativePath(q.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isLogFile(relPath) {
+		http.Error(w, "only log files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if q.Get("time") == "" {
+		http.Error(w, "missing query parameter 'time'", http.StatusBadRequest)
+		return
+	}
+
+	f, err := a.openLog(relPath, fullPath, q.Get("set") == "1")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	target, ok := parseLogTimeString(q.Get("time"), info.ModTime())
+	if !ok {
+		http.Error(w, "invalid time", http.StatusBadRequest)
+		return
+	}
+
+	offset, lineTime, found, err := seekLogTime(f, info.Size(), target, info.ModTime())
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	idx, err := a.logIndex.get(f.Name(), f, info)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	lineNo, err := idx.lineNumber(f, offset)
+	idx.mu.Unlock()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Path     string `json:"path"`
+		Time     string `json:"time"`
+		Found    bool   `json:"found"`
+		Offset   int64  `json:"offset"`
+		Line     int64  `json:"line"`
+		LineTime string `json:"lineTime,omitempty"`
+		Size     int64  `json:"size"`
+	}{
+		Path:   relPath,
+		Time:   target.Format(time.RFC3339Nano),
+		Found:  found,
+		Offset: offset,
+		Line:   lineNo,
+		Size:   info.Size(),
+	}
+	if found {
+		resp.LineTime = lineTime.Format(time.RFC3339Nano)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
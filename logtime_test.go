@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingLog counts the bytes read through ReadAt.
+type countingLog struct {
+	*os.File
+	read int64
+}
+
+func (c *countingLog) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.File.ReadAt(p, off)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestSeekLogTime(t *testing.T) {
+	lines := []string{
+		"starting up\n",
+		"2026-10-18T09:00:00Z INFO a\n",
+		"\tat continuation\n",
+		"2026-10-18T09:00:05Z INFO b\n",
+		"2026-10-18T09:00:05Z INFO c\n",
+		"2026-10-18T09:00:10Z INFO d\n",
+	}
+	offsets := make([]int64, len(lines))
+	var b strings.Builder
+	for i, l := range lines {
+		offsets[i] = int64(b.Len())
+		b.WriteString(l)
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, "2026-10-18T"+s+"Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		name   string
+		target time.Time
+		line   int
+		found  bool
+	}{
+		{"before the first stamp", at("08:00:00"), 1, true},
+		{"exact stamp", at("09:00:00"), 1, true},
+		{"past a continuation", at("09:00:01"), 3, true},
+		{"first of equal stamps", at("09:00:05"), 3, true},
+		{"last line", at("09:00:10"), 5, true},
+		{"after the end", at("09:00:11"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			off, stamp, found, err := seekLogTime(f, int64(b.Len()), tt.target, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.found || (found && off != offsets[tt.line]) {
+				t.Errorf("seekLogTime(%s) = %d, %v; want %d, %v", tt.target.Format(time.TimeOnly), off, found, offsets[tt.line], tt.found)
+			}
+			if found && stamp.Before(tt.target) {
+				t.Errorf("seekLogTime(%s) returned earlier stamp %s", tt.target.Format(time.TimeOnly), stamp)
+			}
+		})
+	}
+	if _, _, found, err := seekLogTime(f, 0, at("09:00:00"), at("09:00:00")); found || err != nil {
+		t.Errorf("seekLogTime on an empty log = %v, %v; want not found", found, err)
+	}
+}
+
+func TestSeekLogTimeUntimedBlock(t *testing.T) {
+	base := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	offsets := make(map[int]int64)
+	line := func(i int) {
+		offsets[i] = int64(b.Len())
+		fmt.Fprintf(&b, "%s INFO request %d\n", base.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+	}
+	for i := 0; i < 100000; i++ {
+		line(i)
+	}
+	// A stack trace far longer than the probe budget, in the middle.
+	for j := 0; j < 20*maxLogSeekProbe; j++ {
+		fmt.Fprintf(&b, "\tat com.example.Handler.run(Handler.java:%d)\n", j)
+	}
+	for i := 100000; i < 200000; i++ {
+		line(i)
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	size := int64(b.Len())
+
+	// Targets well past the block must be found by bisecting the upper
+	// half, not by a linear scan from the block on.
+	tests := []struct {
+		name  string
+		at    int
+		want  int
+		found bool
+		cheap bool
+	}{
+		{"before the block", 1000, 1000, true, true},
+		{"right after the block", 100000, 100000, true, false},
+		{"near the end", 190000, 190000, true, true},
+		{"between seconds", 150000, 150001, true, true},
+		{"after the end", 300000, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := base.Add(time.Duration(tt.at) * time.Second)
+			if tt.name == "between seconds" {
+				target = target.Add(500 * time.Millisecond)
+			}
+			cl := &countingLog{File: f}
+			off, _, found, err := seekLogTime(cl, size, target, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.found || (found && off != offsets[tt.want]) {
+				t.Errorf("seekLogTime = %d, %v; want %d, %v", off, found, offsets[tt.want], tt.found)
+			}
+			if tt.cheap && cl.read > size/4 {
+				t.Errorf("read %d of %d bytes; the bisection gave up at the block", cl.read, size)
+			}
+		})
+	}
+}
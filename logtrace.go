@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxTraceRecords bounds the records collected for one trace.
+	maxTraceRecords = 10000
+	// maxTraceIDLength bounds the trace parameter.
+	maxTraceIDLength = 128
+)
+
+// Field names read from records, in order of preference. OpenTelemetry's
+// snake_case comes first, then common camelCase and nested spellings.
+var (
+	traceIDKeys      = []string{"trace_id", "traceId", "traceID", "trace.id", "otelTraceID"}
+	spanIDKeys       = []string{"span_id", "spanId", "spanID", "span.id", "otelSpanID"}
+	parentSpanIDKeys = []string{"parent_span_id", "parentSpanId", "parentSpanID", "parent_id", "parent.id"}
+	spanNameKeys     = []string{"span_name", "spanName", "span.name", "operation", "op"}
+	serviceKeys      = []string{"service", "service.name", "service_name", "resource.service.name"}
+	traceMsgKeys     = []string{"msg", "message", "body"}
+)
+
+// traceDurationKeys lists the duration fields and the unit of a bare
+// number in each. Strings such as "12.5ms" are parsed as Go durations.
+var traceDurationKeys = []struct {
+	key  string
+	unit time.Duration
+}{
+	{"duration", time.Millisecond},
+	{"duration_ms", time.Millisecond},
+	{"durationMs", time.Millisecond},
+	{"duration_us", time.Microsecond},
+	{"duration_ns", time.Nanosecond},
+	{"durationNano", time.Nanosecond},
+	{"elapsed", time.Millisecond},
+}
+
+// traceRecord is one log record belonging to a trace.
+type traceRecord struct {
+	Source string    `json:"source"`
+	Line   int64     `json:"line"`
+	Offset int64     `json:"offset"`
+	Time   string    `json:"time,omitempty"`
+	Level  string    `json:"level,omitempty"`
+	Msg    string    `json:"msg,omitempty"`
+	Text   string    `json:"text"`
+	at     time.Time // zero when the record has no timestamp
+}
+
+// traceSpan is one span of a trace, assembled from the records carrying its
+// span ID. Spans are returned depth-first, children ordered by start.
+type traceSpan struct {
+	ID         string        `json:"id"`
+	Parent     string        `json:"parent,omitempty"`
+	Name       string        `json:"name"`
+	Service    string        `json:"service,omitempty"`
+	Depth      int           `json:"depth"`
+	Start      string        `json:"start,omitempty"`
+	OffsetMs   float64       `json:"offsetMs"` // start relative to the trace's start
+	DurationMs float64       `json:"durationMs"`
+	Error      bool          `json:"error,omitempty"`  // has a record at error level or above
+	Orphan     bool          `json:"orphan,omitempty"` // parent not found in the logs
+	Records    []traceRecord `json:"records"`
+
+	start, end time.Time
+	declared   time.Duration // longest duration field seen
+	declaredAt time.Time     // time of the record declaring it
+	children   []*traceSpan
+}
+
+// firstField returns the first of keys present in rec as a string.
+func firstField(rec map[string]any, keys []string) string {
+	for _, key := range keys {
+		if v, ok := lookupField(rec, key); ok {
+			if s := fieldString(v); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// recordDuration reads a span duration from rec.
+func recordDuration(rec map[string]any) (time.Duration, bool) {
+	for _, k := range traceDurationKeys {
+		v, ok := rec[k.key]
+		if !ok {
+			continue
+		}
+		if s, isStr := v.(string); isStr {
+			if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil {
+				return d, true
+			}
+		}
+		if n, ok := fieldNumber(v); ok && n >= 0 {
+			return time.Duration(n * float64(k.unit)), true
+		}
+	}
+	return 0, false
+}
+
+// recordTime returns the timestamp of a parsed record, falling back to the
+// text of the line.
+func recordTime(rec map[string]any, line []byte, ref time.Time) (time.Time, bool) {
+	for _, key := range logTimeKeys {
+		switch v := rec[key].(type) {
+		case string:
+			if t, ok := parseLogTimeString(v, ref); ok {
+				return t, true
+			}
+		case float64:
+			if t, ok := epochTime(v); ok {
+				return t, true
+			}
+		}
+	}
+	return detectLogTime(line, ref)
+}
+
+// addRecord adds a record to the span, taking the span's parent, name and
+// service from the first record that has them.
+func (s *traceSpan) addRecord(rec map[string]any, tr traceRecord) {
+	if s.Parent == "" {
+		s.Parent = firstField(rec, parentSpanIDKeys)
+	}
+	if s.Name == "" {
+		s.Name = firstField(rec, spanNameKeys)
+	}
+	if s.Service == "" {
+		s.Service = firstField(rec, serviceKeys)
+	}
+	if d, ok := recordDuration(rec); ok && d > s.declared {
+		s.declared, s.declaredAt = d, tr.at
+	}
+	switch tr.Level {
+	case "error", "fatal":
+		s.Error = true
+	}
+	if !tr.at.IsZero() {
+		if s.start.IsZero() || tr.at.Before(s.start) {
+			s.start = tr.at
+		}
+		if tr.at.After(s.end) {
+			s.end = tr.at
+		}
+	}
+	s.Records = append(s.Records, tr)
+}
+
+// finish settles the span's timing. A record with a duration is taken to
+// be logged when the span ends, as request and span loggers do, so the span
+// starts that long before it.
+func (s *traceSpan) finish() {
+	if s.declared > 0 && !s.declaredAt.IsZero() {
+		if begin := s.declaredAt.Add(-s.declared); s.start.IsZero() || begin.Before(s.start) {
+			s.start = begin
+		}
+		if s.declaredAt.After(s.end) {
+			s.end = s.declaredAt
+		}
+	}
+	if s.Name == "" && len(s.Records) > 0 {
+		s.Name = s.Records[0].Msg
+	}
+	if s.Name == "" {
+		s.Name = s.ID
+	}
+	sort.SliceStable(s.Records, func(i, j int) bool { return s.Records[i].at.Before(s.Records[j].at) })
+}
+
+// buildTraceTree links spans to their parents and returns them depth-first,
+// roots and children ordered by start. Spans whose parent was not logged
+// become roots marked Orphan; a parent cycle is broken where it is found.
+func buildTraceTree(spans map[string]*traceSpan) []*traceSpan {
+	byStart := func(list []*traceSpan) {
+		sort.SliceStable(list, func(i, j int) bool {
+			if !list[i].start.Equal(list[j].start) {
+				return list[i].start.Before(list[j].start)
+			}
+			return list[i].ID < list[j].ID
+		})
+	}
+	var all []*traceSpan
+	for _, s := range spans {
+		all = append(all, s)
+	}
+	byStart(all)
+	var roots []*traceSpan
+	for _, s := range all {
+		if p, ok := spans[s.Parent]; ok && p != s {
+			p.children = append(p.children, s)
+		} else {
+			s.Orphan = s.Parent != ""
+			roots = append(roots, s)
+		}
+	}
+	var out []*traceSpan
+	seen := make(map[*traceSpan]bool)
+	var walk func(s *traceSpan, depth int)
+	walk = func(s *traceSpan, depth int) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		s.Depth = depth
+		out = append(out, s)
+		byStart(s.children)
+		for _, c := range s.children {
+			walk(c, depth+1)
+		}
+	}
+	for _, s := range roots {
+		walk(s, 0)
+	}
+	for _, s := range all {
+		if !seen[s] { // part of a parent cycle
+			s.Orphan = true
+			walk(s, 0)
+		}
+	}
+	return out
+}
+
+// traceScanWindow returns the byte range of a log of the given size that a
+// trace lookup scans: all of it when it is within maxLogStatsScan, else a
+// window of that size centred on at, or ending at the tail when at < 0,
+// where the traces linked from recent rows are.
+func traceScanWindow(size, at int64) (from, to int64) {
+	if size <= maxLogStatsScan {
+		return 0, size
+	}
+	from = size - maxLogStatsScan
+	if at >= 0 {
+		from = min(max(at-maxLogStatsScan/2, 0), size-maxLogStatsScan)
+	}
+	return from, from + maxLogStatsScan
+}
+
+// handleLogTrace collects every record of one trace across the given logs
+// and assembles its span tree:
+//
+//	GET /api/log/trace?trace=<id>&path=<a>&path=<b>…[&at=<offset>]
+//
+// Records are matched on their trace ID field (see traceIDKeys) and grouped
+// by span ID; records of the trace without a span ID are listed as
+// unassigned. Timing comes from the records' timestamps and duration
+// fields. Logs larger than maxLogStatsScan are scanned around at, the
+// offset of the row the trace was opened from (single log only), or at
+// their tail.
+func (a *app) handleLogTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	traceID := strings.TrimSpace(params.Get("trace"))
+	if traceID == "" || len(traceID) > maxTraceIDLength {
+		http.Error(w, "invalid trace", http.StatusBadRequest)
+		return
+	}
+	sources, err := a.parseMergeSources(params["path"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	at := int64(-1)
+	if raw := params.Get("at"); raw != "" {
+		if at, err = strconv.ParseInt(raw, 10, 64); err != nil || at < 0 {
+			http.Error(w, "invalid at", http.StatusBadRequest)
+			return
+		}
+		if len(sources) != 1 {
+			http.Error(w, "at needs a single path", http.StatusBadRequest)
+			return
+		}
+	}
+
+	spans := make(map[string]*traceSpan)
+	unassigned := []traceRecord{}
+	paths := make([]string, 0, len(sources))
+	records := 0
+	var scanned int64
+	complete := true
+	ctx := r.Context()
+	// IDs are hex in practice; compare them case-insensitively and use the
+	// raw bytes only as a cheap prefilter.
+	needle := []byte(strings.ToLower(traceID))
+	for _, src := range sources {
+		paths = append(paths, src.rel)
+		f, err := a.openLog(src.rel, src.full, false)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "file not found: "+src.rel, http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+		info, err := f.Stat()
+		if err == nil {
+			var format string
+			if format, err = detectLogFileFormat(f); err == nil {
+				parse := logRecordParser(format)
+				ref := info.ModTime()
+				from, to := traceScanWindow(info.Size(), at)
+				var lineNo int64
+				if from > 0 {
+					complete = false
+					if from, err = lineStartBefore(f, from); err == nil {
+						lineNo, err = a.traceLineNumber(f, info, from)
+					}
+				}
+				if to < info.Size() {
+					complete = false
+				}
+				if err == nil {
+					err = scanLogLines(io.NewSectionReader(f, from, to-from), from, func(offset int64, line []byte) bool {
+						if records >= maxTraceRecords || ctx.Err() != nil {
+							complete = false
+							return false
+						}
+						lineNo++
+						scanned += int64(len(line)) + 1
+						if !bytes.Contains(bytes.ToLower(line), needle) {
+							return true
+						}
+						rec := parse(line)
+						if rec == nil || !strings.EqualFold(firstField(rec, traceIDKeys), traceID) {
+							return true
+						}
+						records++
+						tr := traceRecord{
+							Source: src.rel,
+							Line:   lineNo,
+							Offset: offset,
+							Level:  detectLogLevel(rec, line),
+							Msg:    firstField(rec, traceMsgKeys),
+							Text:   string(a.redact.redact(line)),
+						}
+						if t, ok := recordTime(rec, line, ref); ok {
+							tr.at = t
+							tr.Time = t.Format(time.RFC3339Nano)
+						}
+						tr.Msg = a.redact.redactString(tr.Msg)
+						spanID := firstField(rec, spanIDKeys)
+						if spanID == "" {
+							unassigned = append(unassigned, tr)
+							return true
+						}
+						s, ok := spans[spanID]
+						if !ok {
+							s = &traceSpan{ID: spanID}
+							spans[spanID] = s
+						}
+						s.addRecord(rec, tr)
+						return true
+					})
+				}
+			}
+		}
+		f.Close()
+		if err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var traceStart, traceEnd time.Time
+	for _, s := range spans {
+		s.finish()
+		s.Name = a.redact.redactString(s.Name)
+		s.Service = a.redact.redactString(s.Service)
+		if !s.start.IsZero() && (traceStart.IsZero() || s.start.Before(traceStart)) {
+			traceStart = s.start
+		}
+		if s.end.After(traceEnd) {
+			traceEnd = s.end
+		}
+	}
+	for _, tr := range unassigned {
+		if !tr.at.IsZero() && (traceStart.IsZero() || tr.at.Before(traceStart)) {
+			traceStart = tr.at
+		}
+		if tr.at.After(traceEnd) {
+			traceEnd = tr.at
+		}
+	}
+	ordered := buildTraceTree(spans)
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	for _, s := range ordered {
+		if !s.start.IsZero() {
+			s.Start = s.start.Format(time.RFC3339Nano)
+			s.OffsetMs = ms(s.start.Sub(traceStart))
+			s.DurationMs = ms(s.end.Sub(s.start))
+		}
+	}
+	sort.SliceStable(unassigned, func(i, j int) bool { return unassigned[i].at.Before(unassigned[j].at) })
+
+	resp := struct {
+		Trace      string        `json:"trace"`
+		Paths      []string      `json:"paths"`
+		Start      string        `json:"start,omitempty"`
+		End        string        `json:"end,omitempty"`
+		DurationMs float64       `json:"durationMs"`
+		Spans      []*traceSpan  `json:"spans"`
+		Unassigned []traceRecord `json:"unassigned"`
+		Records    int           `json:"records"`
+		Scanned    int64         `json:"scanned"`
+		Complete   bool          `json:"complete"`
+	}{
+		Trace:      traceID,
+		Paths:      paths,
+		Spans:      ordered,
+		Unassigned: unassigned,
+		Records:    records,
+		Scanned:    scanned,
+		Complete:   complete,
+	}
+	if resp.Spans == nil {
+		resp.Spans = []*traceSpan{}
+	}
+	if !traceStart.IsZero() {
+		resp.Start = traceStart.Format(time.RFC3339Nano)
+		resp.End = traceEnd.Format(time.RFC3339Nano)
+		resp.DurationMs = ms(traceEnd.Sub(traceStart))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// traceLineNumber returns the number of lines before offset, so a scan
+// starting there numbers lines like the file.
+func (a *app) traceLineNumber(f logReader, info os.FileInfo, offset int64) (int64, error) {
+	idx, err := a.logIndex.get(f.Name(), f, info)
+	if err != nil {
+		return 0, err
+	}
+	defer idx.mu.Unlock()
+	n, err := idx.lineNumber(f, offset)
+	return n - 1, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildTraceTree(t *testing.T) {
+	base := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	// Each span is "id parent start", start in milliseconds.
+	type span struct {
+		id, parent string
+		start      int
+	}
+	tests := []struct {
+		name  string
+		spans []span
+		want  []string // "id depth", with " orphan" appended for orphans
+	}{
+		{
+			name:  "children by start",
+			spans: []span{{"root", "", 0}, {"a", "root", 20}, {"b", "root", 10}, {"c", "a", 30}},
+			want:  []string{"root 0", "b 1", "a 1", "c 2"},
+		},
+		{
+			name:  "equal starts by id",
+			spans: []span{{"r", "", 0}, {"y", "r", 5}, {"x", "r", 5}},
+			want:  []string{"r 0", "x 1", "y 1"},
+		},
+		{
+			name:  "missing parent",
+			spans: []span{{"root", "", 10}, {"lost", "gone", 0}, {"kid", "lost", 5}},
+			want:  []string{"lost 0 orphan", "kid 1", "root 0"},
+		},
+		{
+			name:  "own parent",
+			spans: []span{{"self", "self", 0}},
+			want:  []string{"self 0 orphan"},
+		},
+		{
+			name:  "parent cycle",
+			spans: []span{{"root", "", 0}, {"p", "q", 10}, {"q", "p", 20}, {"k", "q", 30}},
+			want:  []string{"root 0", "p 0 orphan", "q 1", "k 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := make(map[string]*traceSpan)
+			for _, s := range tt.spans {
+				spans[s.id] = &traceSpan{ID: s.id, Parent: s.parent, start: base.Add(time.Duration(s.start) * time.Millisecond)}
+			}
+			var got []string
+			for _, s := range buildTraceTree(spans) {
+				desc := fmt.Sprintf("%s %d", s.ID, s.Depth)
+				if s.Orphan {
+					desc += " orphan"
+				}
+				got = append(got, desc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildTraceTree = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceScanWindow(t *testing.T) {
+	const w = maxLogStatsScan
+	tests := []struct {
+		name           string
+		size, at       int64
+		wantFrom, want int64
+	}{
+		{"small file", 1000, -1, 0, 1000},
+		{"small file ignores at", 1000, 500, 0, 1000},
+		{"large file reads the tail", 3 * w, -1, 2 * w, 3 * w},
+		{"centred on at", 3 * w, w + w/2, w, 2 * w},
+		{"at near the start", 3 * w, 10, 0, w},
+		{"at near the end", 3 * w, 3*w - 10, 2 * w, 3 * w},
+	}
+	for _, tt := range tests {
+		from, to := traceScanWindow(tt.size, tt.at)
+		if from != tt.wantFrom || to != tt.want {
+			t.Errorf("%s: traceScanWindow(%d, %d) = %d, %d; want %d, %d", tt.name, tt.size, tt.at, from, to, tt.wantFrom, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	_ "embed"
 	"encoding/json"
 	"errors"
@@ -14,12 +15,14 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -79,6 +82,33 @@ type app struct {
 	root string
 	tpl  *template.Template
 
+	// editMu serializes writes of markdown files (editor saves, task
+	// toggles, section edits, link fixes) so concurrent requests cannot
+	// interleave.
+	editMu sync.Mutex
+
+	// logs shares one file watcher per tailed log across stream subscribers.
+	logs *logHub
+	// logIndex caches sparse line indexes for random access into logs.
+	logIndex *logIndexCache
+	// logFiles caches decompressed archives and concatenated log sets.
+	logFiles *logFileCache
+	// alerts evaluates log alert rules from .mdviewer files.
+	alerts *logAlerter
+	// ingest authorizes and serializes appends to /api/log/append.
+	ingest *logIngest
+	// received is the folder (full path) the syslog and OTLP receivers
+	// write to.
+	received string
+	// receivedMax caps the size of each received service log; 0 means no
+	// cap. receivedFull records the logs already reported as full.
+	receivedMax  int64
+	receivedFull sync.Map
+	// runs executes the allowlisted commands of -runs; nil when disabled.
+	runs *runManager
+	// redact masks secrets in served content; nil when disabled.
+	redact *redactor
+
 	// Podcast generation state
 	podcastMu   sync.Mutex
 	podcastJobs map[string]*podcastJob // keyed by relative md path
@@ -101,6 +131,12 @@ type mdviewerData struct {
 	Tags     map[string][]string `json:"tags"`
 	Opened   map[string]bool     `json:"opened"`
 	LogViews []logViewEntry      `json:"logViews,omitempty"`
+	// LogAlerts are alert rules evaluated in the background against the
+	// log files in this directory and its subdirectories.
+	LogAlerts []logAlertRule `json:"logAlerts,omitempty"`
+	// LogRotate are size-based rotation policies for the log files in
+	// this directory and its subdirectories.
+	LogRotate []logRotatePolicy `json:"logRotate,omitempty"`
 }
 
 // logViewEntry is a saved, Notion-like log view (filters + column config)
@@ -111,6 +147,28 @@ type logViewEntry struct {
 	Config json.RawMessage `json:"config"`
 }
 
+// logViewConfig is the part of a view's config, as saved by the log viewer,
+// that the server applies when exporting.
+type logViewConfig struct {
+	Format       string            `json:"format"`
+	GlobalFilter string            `json:"globalFilter"`
+	HidePatterns int               `json:"hidePatterns"`
+	Order        []string          `json:"order"`
+	Hidden       []string          `json:"hidden"`
+	Filters      map[string]string `json:"filters"`
+}
+
+// config decodes the view's config. Fields the server does not use, such
+// as column widths, are ignored.
+func (v logViewEntry) config() (logViewConfig, error) {
+	var cfg logViewConfig
+	if len(v.Config) == 0 || string(v.Config) == "null" {
+		return cfg, nil
+	}
+	err := json.Unmarshal(v.Config, &cfg)
+	return cfg, err
+}
+
 // mdviewerDataLegacy handles the old single-tag format for migration.
 type mdviewerDataLegacy struct {
 	Tags map[string]string `json:"tags"`
@@ -151,7 +209,7 @@ func readMdviewerFile(dirPath string) (mdviewerData, error) {
 
 func writeMdviewerFile(dirPath string, data mdviewerData) error {
 	fp := filepath.Join(dirPath, mdviewerFile)
-	if len(data.Tags) == 0 && len(data.Opened) == 0 && len(data.LogViews) == 0 {
+	if len(data.Tags) == 0 && len(data.Opened) == 0 && len(data.LogViews) == 0 && len(data.LogAlerts) == 0 && len(data.LogRotate) == 0 {
 		_ = os.Remove(fp)
 		return nil
 	}
@@ -162,6 +220,16 @@ func writeMdviewerFile(dirPath string, data mdviewerData) error {
 	return os.WriteFile(fp, content, 0644)
 }
 
+// writeFileKeepMode replaces the content of a file, keeping its permission
+// bits. A file that does not exist yet is created with 0644.
+func writeFileKeepMode(name string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return os.WriteFile(name, data, perm)
+}
+
 type allTagsResult struct {
 	Tags   map[string][]string `json:"tags"`
 	Opened map[string]bool     `json:"opened"`
@@ -215,11 +283,30 @@ func collectAllTags(root string) (allTagsResult, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-links":
+			os.Exit(runCheckLinks(os.Args[2:]))
+		case "tee":
+			os.Exit(runTee(os.Args[2:]))
+		}
+	}
+
 	rootFlag := flag.String("root", ".", "Root directory to scan for markdown files")
 	portFlag := flag.String("port", "8080", "HTTP port to listen on")
 	podcastWatchFlag := flag.String("podcast-watch", "", "Comma-separated list of directories (relative to -root) to watch for auto podcast generation")
 	versionFlag := flag.Bool("version", false, "Print version and exit")
 	updateFlag := flag.Bool("update", false, "Update mdviewer to the latest GitHub release and exit")
+	ingestTokenFlag := flag.String("ingest-token", os.Getenv("MDVIEWER_INGEST_TOKEN"), "Token enabling POST /api/log/append (default $MDVIEWER_INGEST_TOKEN)")
+	syslogAddrFlag := flag.String("syslog-addr", "", "Receive syslog (RFC 5424/3164) on this UDP and TCP address, e.g. 127.0.0.1:5514")
+	otlpAddrFlag := flag.String("otlp-addr", "", "Receive OTLP/HTTP JSON logs on this address, e.g. 127.0.0.1:4318 (requires -ingest-token when set)")
+	receiveDirFlag := flag.String("receive-dir", "received", "Folder (relative to -root) where received logs are written, one NDJSON file per service")
+	receiveMaxSizeFlag := flag.String("receive-max-size", "256MB", "Stop appending to a received service log at this size (0 for no limit)")
+	runsFlag := flag.String("runs", "", "JSON file listing the commands that may be run from the UI (enables /runs)")
+	runsDirFlag := flag.String("runs-dir", "runs", "Folder (relative to -root) where run logs are written")
+	redactFlag := flag.Bool("redact", false, "Mask secrets (JWTs, AWS keys, Authorization headers, passwords) in served logs and markdown")
+	redactRulesFlag := flag.String("redact-rules", "", "JSON file of extra redaction rules: [{\"name\": …, \"pattern\": …}]")
+	alertCommandsFlag := flag.Bool("alert-commands", false, "Allow log alert rules to run shell command hooks")
 	flag.Parse()
 
 	if *versionFlag {
@@ -251,7 +338,44 @@ func main() {
 		log.Fatalf("parse template: %v", err)
 	}
 
-	a := &app{root: absRoot, tpl: tpl, podcastJobs: make(map[string]*podcastJob)}
+	a := &app{root: absRoot, tpl: tpl, logs: newLogHub(), logIndex: newLogIndexCache(), podcastJobs: make(map[string]*podcastJob)}
+	a.logFiles = newLogFileCache(a.logIndex)
+	a.alerts = newLogAlerter(a, *alertCommandsFlag)
+	a.ingest = newLogIngest(*ingestTokenFlag)
+	if a.redact, err = newRedactor(*redactFlag, *redactRulesFlag); err != nil {
+		log.Fatalf("load redaction rules: %v", err)
+	}
+	a.logs.wholeLines = a.redact != nil
+	if *runsFlag != "" {
+		commands, err := loadRunCommands(absRoot, *runsFlag)
+		if err != nil {
+			log.Fatalf("load runs: %v", err)
+		}
+		rel, err := sanitizeRelativePath(*runsDirFlag)
+		if err != nil {
+			log.Fatalf("invalid -runs-dir: %v", err)
+		}
+		if a.runs, err = newRunManager(absRoot, rel, commands); err != nil {
+			log.Fatalf("invalid -runs-dir: %v", err)
+		}
+	}
+	if *syslogAddrFlag != "" || *otlpAddrFlag != "" {
+		rel, err := sanitizeRelativePath(*receiveDirFlag)
+		if err != nil {
+			log.Fatalf("invalid -receive-dir: %v", err)
+		}
+		if a.received, err = secureJoin(absRoot, rel); err != nil {
+			log.Fatalf("invalid -receive-dir: %v", err)
+		}
+		if a.receivedMax, err = parseSizeLimit(*receiveMaxSizeFlag); err != nil {
+			log.Fatalf("invalid -receive-max-size: %v", err)
+		}
+		if err := a.startReceivers(*syslogAddrFlag, *otlpAddrFlag); err != nil {
+			log.Fatalf("start receivers: %v", err)
+		}
+	}
+	go a.alerts.run()
+	go a.runLogRotation()
 
 	// Extract embedded podcast_gen.py to ~/.local/mdviewer/ so it's always available
 	if p := ensureEmbeddedPodcastScript(); p != "" {
@@ -263,11 +387,35 @@ func main() {
 	mux.HandleFunc("/api/files", a.handleFiles)
 	mux.HandleFunc("/api/file", a.handleFile)
 	mux.HandleFunc("/api/log", a.handleLogTail)
+	mux.HandleFunc("/api/log/stream", a.handleLogStream)
+	mux.HandleFunc("/api/log/search", a.handleLogSearch)
+	mux.HandleFunc("/api/log/seek", a.handleLogSeek)
+	mux.HandleFunc("/api/log/set", a.handleLogSet)
+	mux.HandleFunc("/api/log/merge", a.handleLogMerge)
+	mux.HandleFunc("/api/log/parse", a.handleLogParse)
+	mux.HandleFunc("/api/log/stats", a.handleLogStats)
+	mux.HandleFunc("/api/log/histogram", a.handleLogHistogram)
+	mux.HandleFunc("/api/log/patterns", a.handleLogPatterns)
+	mux.HandleFunc("/api/log/trace", a.handleLogTrace)
+	mux.HandleFunc("/api/log/export", a.handleLogExport)
+	mux.HandleFunc("/api/log/merge/stream", a.handleLogMergeStream)
 	mux.HandleFunc("/api/log/clear", a.handleLogClear)
+	mux.HandleFunc("/api/log/append", a.handleLogAppend)
 	mux.HandleFunc("/api/log/views", a.handleLogViews)
 	mux.HandleFunc("/api/log/views/save", a.handleLogViewSave)
 	mux.HandleFunc("/api/log/views/delete", a.handleLogViewDelete)
+	mux.HandleFunc("/api/log/alerts", a.handleLogAlerts)
+	mux.HandleFunc("/api/log/alerts/save", a.handleLogAlertSave)
+	mux.HandleFunc("/api/log/alerts/delete", a.handleLogAlertDelete)
+	mux.HandleFunc("/api/log/alerts/history", a.handleLogAlertHistory)
 	mux.HandleFunc("/api/search", a.handleSearch)
+	mux.HandleFunc("/api/links/check", a.handleLinksCheck)
+	mux.HandleFunc("/api/links/fix", a.handleLinksFix)
+	mux.HandleFunc("/api/graph", a.handleGraph)
+	mux.HandleFunc("/api/tasks", a.handleTasks)
+	mux.HandleFunc("/api/outline", a.handleOutline)
+	mux.HandleFunc("/api/section", a.handleSection)
+	mux.HandleFunc("/api/tasks/toggle", a.handleTaskToggle)
 	mux.HandleFunc("/api/tags", a.handleTags)
 	mux.HandleFunc("/api/tag", a.handleSetTag)
 	mux.HandleFunc("/api/opened", a.handleMarkOpened)
@@ -279,6 +427,10 @@ func main() {
 	mux.HandleFunc("/api/podcasts", a.handlePodcastList)
 	mux.HandleFunc("/api/podcasts/progress", a.handlePodcastProgress)
 	mux.HandleFunc("/api/podcasts/queue", a.handlePodcastQueue)
+	mux.HandleFunc("/runs", a.handleRunsPage)
+	mux.HandleFunc("/api/runs", a.handleRuns)
+	mux.HandleFunc("/api/runs/start", a.handleRunStart)
+	mux.HandleFunc("/api/runs/cancel", a.handleRunCancel)
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -302,9 +454,19 @@ func main() {
 		go a.startPodcastWatcher(dirs, patterns)
 	}
 
+	// Decompressed logs live in a temp directory; remove it on Ctrl-C.
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		a.logFiles.cleanup()
+		os.Exit(0)
+	}()
+
 	addr := ":" + *portFlag
 	log.Printf("Markdown viewer running on http://localhost%s (root: %s)", addr, absRoot)
 	if err := http.ListenAndServe(addr, mux); err != nil {
+		a.logFiles.cleanup()
 		log.Fatal(err)
 	}
 }
@@ -535,19 +697,26 @@ func (a *app) handleFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	redacted := a.redact.redact(content)
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Redacted bool   `json:"redacted,omitempty"`
 	}{
-		Path:    relPath,
-		Content: string(content),
+		Path:     relPath,
+		Content:  string(redacted),
+		Redacted: !bytes.Equal(redacted, content),
 	})
 }
 
 type searchResult struct {
 	Path    string `json:"path"`
 	Context string `json:"context"`
+	Line    int    `json:"line,omitempty"`
+	Heading string `json:"heading,omitempty"` // section containing the match
+	Anchor  string `json:"anchor,omitempty"`  // heading anchor, as in /api/outline
 }
 
 // maxLogInitialBytes caps the initial log payload so opening a huge log file
@@ -557,7 +726,9 @@ const maxLogInitialBytes = 2 << 20 // 2 MiB
 // handleLogTail streams new bytes from a log file. With no offset (or a
 // negative one) it returns the tail of the file (capped to maxLogInitialBytes)
 // and the current size as the next offset. With an offset it returns only the
-// bytes written since that offset, detecting truncation/rotation.
+// bytes written since that offset, detecting truncation/rotation. ansi=strip
+// removes ANSI escapes from the content and ansi=spans adds the styled spans
+// of the lines that have them (see applyANSIMode).
 func (a *app) handleLogTail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -580,7 +751,7 @@ func (a *app) handleLogTail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	f, err := os.Open(fullPath)
+	f, err := a.openLog(relPath, fullPath, r.URL.Query().Get("set") == "1")
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "file not found", http.StatusNotFound)
@@ -597,6 +768,21 @@ func (a *app) handleLogTail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	size := info.Size()
+	rule, err := parseEntryRule(r.URL.Query(), info.ModTime())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ansiMode, err := parseANSIMode(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if logPageRequested(r.URL.Query()) {
+		a.serveLogPage(w, relPath, f, info, r.URL.Query())
+		return
+	}
 
 	offset := int64(-1)
 	hasOffset := false
@@ -624,6 +810,15 @@ func (a *app) handleLogTail(w http.ResponseWriter, r *http.Request) {
 		start = offset
 	}
 
+	// The format is detected on the initial load only; polls just append.
+	format := ""
+	if !hasOffset {
+		if format, err = detectLogFileFormat(f); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	var content []byte
 	if start < size {
 		if _, err := f.Seek(start, io.SeekStart); err != nil {
@@ -638,20 +833,36 @@ func (a *app) handleLogTail(w http.ResponseWriter, r *http.Request) {
 		}
 		content = buf[:n]
 	}
+	var entries []int64
+	if rule != nil {
+		if entries, err = logEntryStarts(f, rule, start, content); err != nil {
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+	content, ansi := applyANSIMode(ansiMode, a.redact.redact(content))
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(struct {
-		Path      string `json:"path"`
-		Content   string `json:"content"`
-		Offset    int64  `json:"offset"`
-		Size      int64  `json:"size"`
-		Truncated bool   `json:"truncated"`
+		Path      string     `json:"path"`
+		Format    string     `json:"format,omitempty"`
+		Content   string     `json:"content"`
+		Start     int64      `json:"start"`
+		Offset    int64      `json:"offset"`
+		Size      int64      `json:"size"`
+		Truncated bool       `json:"truncated"`
+		Entries   []int64    `json:"entries,omitempty"`
+		ANSI      []ansiLine `json:"ansi,omitempty"`
 	}{
 		Path:      relPath,
+		Format:    format,
 		Content:   string(content),
+		Start:     start,
 		Offset:    size,
 		Size:      size,
 		Truncated: truncated,
+		Entries:   entries,
+		ANSI:      ansi,
 	})
 }
 
@@ -678,7 +889,35 @@ func (a *app) handleLogClear(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := os.Truncate(fullPath, 0); err != nil {
+	if isArchivedLog(relPath) {
+		http.Error(w, "rotated and compressed logs cannot be cleared", http.StatusBadRequest)
+		return
+	}
+
+	// backup=1 keeps the current contents in a timestamped archive beside
+	// the log (gzip=1 compresses it) before truncating.
+	resp := map[string]any{"ok": true}
+	lock := a.ingest.lock(fullPath)
+	lock.Lock()
+	defer lock.Unlock()
+	if q := r.URL.Query(); q.Get("backup") == "1" {
+		backup, err := rotateLog(fullPath, q.Get("gzip") == "1")
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "file not found", http.StatusNotFound)
+				return
+			}
+			if backup == "" {
+				http.Error(w, "failed to back up file", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "failed to clear file", http.StatusInternalServerError)
+			return
+		}
+		if backup != "" {
+			resp["backup"] = filepath.ToSlash(filepath.Join(filepath.Dir(relPath), filepath.Base(backup)))
+		}
+	} else if err := os.Truncate(fullPath, 0); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "file not found", http.StatusNotFound)
 			return
@@ -688,7 +927,7 @@ func (a *app) handleLogClear(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 // logViewResponse is a saved view returned to the client, annotated with the
@@ -767,6 +1006,17 @@ func (a *app) handleLogViews(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]any{"views": views})
 }
 
+// logDir returns the directory of a log file, relative to root and as a
+// full path, where its views and alert rules are saved.
+func (a *app) logDir(relPath string) (string, string, error) {
+	relDir := filepath.ToSlash(filepath.Dir(relPath))
+	if relDir == "." || relDir == "" {
+		return "", a.root, nil
+	}
+	dirFull, err := secureJoin(a.root, relDir)
+	return relDir, dirFull, err
+}
+
 // handleLogViewSave upserts a named view into the .mdviewer file of the log
 // file's own directory, making it available to that directory and all
 // subdirectories.
@@ -798,17 +1048,10 @@ func (a *app) handleLogViewSave(w http.ResponseWriter, r *http.Request) {
 		body.Config = json.RawMessage("{}")
 	}
 
-	relDir := filepath.ToSlash(filepath.Dir(relPath))
-	var dirFull string
-	if relDir == "." || relDir == "" {
-		relDir = ""
-		dirFull = a.root
-	} else {
-		dirFull, err = secureJoin(a.root, relDir)
-		if err != nil {
-			http.Error(w, "invalid path", http.StatusBadRequest)
-			return
-		}
+	relDir, dirFull, err := a.logDir(relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
 	}
 
 	data, err := readMdviewerFile(dirFull)
@@ -908,7 +1151,7 @@ func (a *app) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, err := searchFiles(a.root, query)
+	results, err := searchFiles(a.root, query, a.redact)
 	if err != nil {
 		http.Error(w, "search failed", http.StatusInternalServerError)
 		return
@@ -1109,6 +1352,12 @@ func (a *app) handleMedia(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "access denied", http.StatusForbidden)
 		return
 	}
+	// With redaction on, notes and logs are only served masked, through
+	// /api/file and /api/log.
+	if a.redact != nil && (isMarkdownFile(cleaned) || isLogFile(cleaned)) {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
 
 	http.ServeFile(w, r, fullPath)
 }
@@ -1513,6 +1762,10 @@ func (a *app) handleSave(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid path", http.StatusBadRequest)
 		return
 	}
+	// Task toggles and section edits rewrite the file too.
+	a.editMu.Lock()
+	defer a.editMu.Unlock()
+
 	// Verify file exists before writing
 	if _, err := os.Stat(fullPath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -1522,7 +1775,15 @@ func (a *app) handleSave(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to stat file", http.StatusInternalServerError)
 		return
 	}
-	if err := os.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
+	// The editor only saw the masked text; saving it would overwrite the
+	// secrets with asterisks.
+	if a.redact != nil {
+		if existing, err := os.ReadFile(fullPath); err == nil && a.redact.matches(existing) {
+			http.Error(w, errRedacted.Error(), http.StatusConflict)
+			return
+		}
+	}
+	if err := writeFileKeepMode(fullPath, []byte(req.Content)); err != nil {
 		http.Error(w, "failed to write file", http.StatusInternalServerError)
 		return
 	}
@@ -1587,7 +1848,7 @@ func (a *app) handleArchive(w http.ResponseWriter, r *http.Request) {
 	}{Moved: moved})
 }
 
-func searchFiles(root, query string) ([]searchResult, error) {
+func searchFiles(root, query string, rd *redactor) ([]searchResult, error) {
 	lowerQuery := strings.ToLower(query)
 	var results []searchResult
 
@@ -1604,7 +1865,8 @@ func searchFiles(root, query string) ([]searchResult, error) {
 			return nil // skip unreadable files
 		}
 
-		text := string(content)
+		// Masked secrets can neither be found nor shown in a snippet.
+		text := string(rd.redact(content))
 		lowerText := strings.ToLower(text)
 		idx := strings.Index(lowerText, lowerQuery)
 		if idx < 0 {
@@ -1640,10 +1902,19 @@ func searchFiles(root, query string) ([]searchResult, error) {
 			suffix = "…"
 		}
 
-		results = append(results, searchResult{
+		result := searchResult{
 			Path:    filepath.ToSlash(rel),
 			Context: prefix + snippet + suffix,
-		})
+			Line:    strings.Count(text[:min(idx, len(text))], "\n") + 1,
+		}
+		doc := parseMarkdown(text)
+		for _, h := range doc.Headings {
+			if h.Line > result.Line {
+				break
+			}
+			result.Heading, result.Anchor = h.Text, h.Slug
+		}
+		results = append(results, result)
 		return nil
 	})
 	if err != nil {
@@ -1707,14 +1978,11 @@ func isImageFile(path string) bool {
 	}
 }
 
-// isLogFile reports whether the file is a log file that can be live-tailed.
+// isLogFile reports whether the file is a log file, including rotated
+// (app.log.1) and compressed (app.log.2.gz) variants. Only plain logs can be
+// live-tailed; see isArchivedLog.
 func isLogFile(path string) bool {
-	switch strings.ToLower(filepath.Ext(path)) {
-	case ".log", ".jsonl", ".ndjson":
-		return true
-	default:
-		return false
-	}
+	return logNameRe.MatchString(path)
 }
 
 // isViewableFile reports whether the file can be shown in the viewer sidebar
@@ -2548,6 +2816,15 @@ const indexHTML = `<!DOCTYPE html>
       border: 1px solid var(--border); border-radius: 6px;
       background: var(--bg); color: var(--fg); font-size: 13px;
     }
+    .log-toolbar select.log-format {
+      padding: 5px 6px; border: 1px solid var(--border); border-radius: 6px;
+      background: var(--bg); color: var(--fg); font-size: 12px;
+    }
+    .log-toolbar input.log-goto {
+      width: 160px; padding: 6px 10px;
+      border: 1px solid var(--border); border-radius: 6px;
+      background: var(--bg); color: var(--fg); font-size: 13px;
+    }
     .log-toolbar .log-stat { font-size: 12px; color: var(--muted); white-space: nowrap; }
     .log-live-on { background: #238636 !important; border-color: #238636 !important; color: #fff !important; }
     .log-output {
@@ -2557,6 +2834,8 @@ const indexHTML = `<!DOCTYPE html>
       background: var(--code-bg, rgba(127,127,127,0.08)); border-radius: 6px; padding: 10px;
     }
     .log-line.log-hit { background: rgba(255, 221, 0, 0.18); }
+    .log-line.log-entry { border-left: 2px solid var(--border); padding-left: 6px; margin: 2px 0; }
+    table.log-table tr.log-cont td { font-style: normal; border-top: none; padding-left: 18px; }
     .log-table-wrap { max-height: calc(100vh - 220px); overflow: auto; border: 1px solid var(--border); border-radius: 6px; }
     table.log-table { border-collapse: collapse; width: 100%; font-size: 12.5px; table-layout: fixed; }
     table.log-table th, table.log-table td {
@@ -2588,6 +2867,37 @@ const indexHTML = `<!DOCTYPE html>
     .log-lvl-info { background: #3498db; }
     .log-lvl-debug, .log-lvl-trace { background: #7f8c8d; }
 
+    /* Volume sparkline */
+    .log-hist { margin-bottom: 8px; }
+    .log-hist-bars { display: flex; align-items: flex-end; gap: 1px; height: 48px; }
+    .log-hist-bar { flex: 1; min-width: 2px; height: 100%; display: flex; flex-direction: column; justify-content: flex-end; cursor: pointer; }
+    .log-hist-bar:hover { background: rgba(127,127,127,0.15); }
+    .log-hist-seg { width: 100%; background: #95a5a6; }
+    .log-hist-fatal, .log-hist-error { background: #e74c3c; }
+    .log-hist-warn { background: #e67e22; }
+    .log-hist-info { background: #3498db; }
+    .log-hist-debug, .log-hist-trace { background: #7f8c8d; }
+    .log-hist-axis { display: flex; justify-content: space-between; font-size: 11px; margin-top: 2px; }
+
+    /* Facet panel */
+    .log-facets { margin-bottom: 8px; padding: 8px; border: 1px solid var(--border); border-radius: 6px; font-size: 12px; }
+    .log-facets-head { margin-bottom: 6px; }
+    .log-facets-grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(220px, 1fr)); gap: 10px; }
+    .log-facet-name { font-weight: 600; margin-bottom: 4px; }
+    .log-facet-num { margin-bottom: 4px; }
+    .log-facet-val {
+      display: inline-block; margin: 0 4px 4px 0; padding: 2px 6px; font-size: 12px;
+      border: 1px solid var(--border); border-radius: 10px; background: transparent; color: var(--fg); cursor: pointer;
+      max-width: 100%; overflow: hidden; text-overflow: ellipsis; white-space: nowrap;
+    }
+    .log-facet-val:hover { background: rgba(127,127,127,0.12); }
+    .log-hide-n { width: 48px; font-size: 12px; }
+    .log-patterns-table { width: 100%; border-collapse: collapse; }
+    .log-patterns-table td { padding: 4px 6px; border-top: 1px solid var(--border); vertical-align: top; }
+    .log-patterns-table code { white-space: pre-wrap; word-break: break-all; }
+    .log-pattern-count { text-align: right; white-space: nowrap; width: 1%; }
+    .log-pattern-hidden { opacity: 0.45; }
+
     /* Dropdown menus (columns / views) */
     .log-dropdown { position: relative; display: inline-block; }
     .log-menu {
@@ -2606,10 +2916,29 @@ const indexHTML = `<!DOCTYPE html>
     .log-menu-actions { display: flex; gap: 6px; padding: 6px; border-top: 1px solid var(--border); margin-top: 4px; }
     .log-view-row { justify-content: space-between; }
     .log-view-apply { flex: 1; }
+    .log-view-export { font-size: 12px; color: var(--muted); }
     .log-view-scope { font-size: 10px; color: var(--muted); margin-left: 4px; }
     .log-view-active { background: rgba(35,134,54,0.18); }
     .log-view-del { color: #e74c3c; font-weight: 700; padding: 0 6px; }
     .log-view-del:hover { background: rgba(231,76,60,0.15); border-radius: 4px; }
+    .log-alert-menu { min-width: 320px; }
+    .log-alert-rule { font-size: 11px; color: var(--muted); font-family: monospace; }
+    .log-alert-fired { font-size: 12px; padding: 4px 6px; border-radius: 5px; }
+    .log-alert-fired .log-alert-rule { display: block; white-space: pre; overflow: hidden; text-overflow: ellipsis; max-width: 420px; }
+    .log-alert-err { color: #e74c3c; font-size: 11px; }
+    .log-trace-link { color: var(--link); cursor: pointer; text-decoration: none; }
+    .log-trace-link:hover { text-decoration: underline; }
+    .log-trace { font-size: 12px; }
+    .log-trace-row { display: grid; grid-template-columns: minmax(180px, 32%) 1fr 80px; gap: 8px; align-items: center; padding: 3px 4px; border-bottom: 1px solid var(--border); cursor: pointer; }
+    .log-trace-row:hover { background: rgba(127,127,127,0.10); }
+    .log-trace-name { white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+    .log-trace-svc { color: var(--muted); font-size: 11px; margin-left: 6px; }
+    .log-trace-lane { position: relative; height: 14px; }
+    .log-trace-bar { position: absolute; top: 2px; height: 10px; min-width: 2px; border-radius: 3px; background: #2f81f7; }
+    .log-trace-bar.log-trace-err { background: #e74c3c; }
+    .log-trace-dur { text-align: right; color: var(--muted); font-variant-numeric: tabular-nums; }
+    .log-trace-records { margin: 2px 0 6px; padding: 4px 8px; border-left: 2px solid var(--border); font-family: monospace; white-space: pre-wrap; }
+    .log-trace-records.hidden { display: none; }
   </style>
 </head>
 <body>
@@ -2696,8 +3025,11 @@ const indexHTML = `<!DOCTYPE html>
     function isPdfPath(p) { return p.toLowerCase().endsWith('.pdf'); }
     function isHtmlPath(p) { const l = p.toLowerCase(); return l.endsWith('.html') || l.endsWith('.htm'); }
     function isImagePath(p) { const l = p.toLowerCase(); return IMAGE_EXTS.some(e => l.endsWith(e)); }
-    const LOG_EXTS = ['.log', '.jsonl', '.ndjson'];
-    function isLogPath(p) { const l = p.toLowerCase(); return LOG_EXTS.some(e => l.endsWith(e)); }
+    // Matches logs plus rotated/compressed variants (app.log.1, app.log.2.gz,
+    // app.log-20261015, app-2026-10-15.jsonl.zst); mirrors logNameRe.
+    const LOG_NAME_RE = /\.(?:log|jsonl|ndjson)(?:[.-]\d[\d-]*)?(?:\.(?:gz|zst))?$/i;
+    function isLogPath(p) { return LOG_NAME_RE.test(p); }
+    function isArchivedLogPath(p) { return !/\.(?:log|jsonl|ndjson)$/i.test(p); }
     function isMarkdownPath(p) { const l = p.toLowerCase(); return l.endsWith('.md') || l.endsWith('.markdown'); }
     function mediaUrlFor(p) { return '/api/media/' + p.split('/').map(s => encodeURIComponent(s)).join('/'); }
 
@@ -3420,8 +3752,9 @@ const indexHTML = `<!DOCTYPE html>
     // --- Log viewer (live tail, clear, JSON table, column config, views) ---
     let logState = null;
 
-    const LOG_PREFERRED_COLS = ['time','timestamp','ts','date','level','lvl','severity','logger','name','msg','message'];
+    const LOG_PREFERRED_COLS = ['time','timestamp','ts','date','source','level','lvl','severity','logger','name','msg','message'];
     const LOG_LEVEL_KEYS = new Set(['level','lvl','severity']);
+    const LOG_TRACE_KEYS = new Set(['trace_id','traceId','traceID','otelTraceID']);
 
     function logColDefaultWidth(key) {
       const k = key.toLowerCase();
@@ -3436,6 +3769,10 @@ const indexHTML = `<!DOCTYPE html>
         clearInterval(logState.timer);
         logState.timer = null;
       }
+      if (logState && logState.stream) {
+        logState.stream.close();
+        logState.stream = null;
+      }
       if (logState) logState.live = false;
     }
 
@@ -3451,7 +3788,12 @@ const indexHTML = `<!DOCTYPE html>
       const c = logState.colConfig;
       return {
         jsonMode: logState.jsonMode,
+        format: logState.format,
         globalFilter: logState.globalFilter,
+        hidePatterns: logState.hidePatterns,
+        entries: logState.entries,
+        entryStart: logState.entryStart,
+        ansi: logState.ansi,
         order: c.order.slice(),
         hidden: Object.keys(c.hidden).filter(k => c.hidden[k]),
         widths: Object.assign({}, c.widths),
@@ -3462,7 +3804,13 @@ const indexHTML = `<!DOCTYPE html>
     function applyLogConfig(cfg) {
       if (!cfg) return;
       logState.jsonMode = !!cfg.jsonMode;
+      logState.format = cfg.format || 'auto';
+      logState.records = new Map();
       logState.globalFilter = cfg.globalFilter || '';
+      logState.hidePatterns = cfg.hidePatterns || 0;
+      logState.entries = cfg.entries || '';
+      logState.entryStart = cfg.entryStart || '';
+      logState.ansi = cfg.ansi || '';
       const c = logState.colConfig;
       c.order = Array.isArray(cfg.order) ? cfg.order.slice() : [];
       c.hidden = {};
@@ -3492,12 +3840,16 @@ const indexHTML = `<!DOCTYPE html>
       toggleRawBtn.classList.add('hidden');
 
       logState = {
-        path: filePath, offset: -1, buffer: '', live: false, timer: null,
+        path: filePath, offset: -1, buffer: '', live: false, timer: null, stream: null,
         jsonMode: false, globalFilter: '',
         allCols: [],
         colConfig: { order: [], hidden: {}, widths: {}, filters: {} },
         stick: true, resizing: false,
-        views: [], currentView: ''
+        views: [], currentView: '', search: null, start: 0, page: null, trace: null, set: false, setMembers: [], merge: null,
+        format: 'auto', detected: '', records: new Map(), parsePending: false,
+        patterns: null, hidePatterns: 0,
+        entries: '', entryStart: '', entryStarts: new Set(),
+        ansi: '', ansiSpans: new Map()
       };
       loadLocalLogConfig();
 
@@ -3505,17 +3857,40 @@ const indexHTML = `<!DOCTYPE html>
         '<div class="log-toolbar">' +
           '<button id="log-live-btn" class="btn" type="button" title="Continuously fetch new log lines">▶ Live Tail</button>' +
           '<button id="log-clear-btn" class="btn" type="button" title="Truncate this log file">🗑 Clear</button>' +
+          '<button id="log-set-btn" class="btn hidden" type="button" title="Show all rotated files of this log as one timeline">🗂 Log set</button>' +
+          '<button id="log-merge-btn" class="btn" type="button" title="Interleave other logs with this one by timestamp">⊕ Merge</button>' +
           '<label style="display:flex;align-items:center;gap:5px;font-size:12px;color:var(--muted);">' +
             '<input type="checkbox" id="log-json-toggle"> JSON table' +
           '</label>' +
+          '<select id="log-format" class="log-format" title="Line format used by the table view and field filters">' +
+            '<option value="auto">auto</option><option value="json">JSON</option><option value="logfmt">logfmt</option>' +
+            '<option value="access">access log</option><option value="golog">Go log</option><option value="raw">raw</option>' +
+          '</select>' +
+          '<select id="log-entries" class="log-format" title="Group stack traces and other continuation lines with the line that starts their entry">' +
+            '<option value="">lines</option><option value="timestamp">entries: timestamp</option>' +
+            '<option value="indent">entries: unindented</option><option value="regex">entries: regex…</option>' +
+          '</select>' +
+          '<select id="log-ansi" class="log-format" title="Terminal colour codes (ANSI escapes) in the log">' +
+            '<option value="">ANSI: raw</option><option value="color">ANSI: colors</option><option value="strip">ANSI: strip</option>' +
+          '</select>' +
+          '<button id="log-facets-btn" class="btn hidden" type="button" title="Top values and numeric stats over the whole file">📊 Facets</button>' +
+          '<button id="log-patterns-btn" class="btn" type="button" title="Group lines into message templates and hide the noisiest">🧩 Patterns</button>' +
           '<div class="log-dropdown"><button id="log-cols-btn" class="btn hidden" type="button">⚙ Columns</button>' +
             '<div id="log-cols-menu" class="log-menu hidden"></div></div>' +
           '<div class="log-dropdown"><button id="log-views-btn" class="btn" type="button">🔖 Views</button>' +
             '<div id="log-views-menu" class="log-menu hidden"></div></div>' +
+          '<div class="log-dropdown"><button id="log-alerts-btn" class="btn" type="button" title="Rules evaluated in the background that notify when matching lines appear">🔔 Alerts</button>' +
+            '<div id="log-alerts-menu" class="log-menu log-alert-menu hidden"></div></div>' +
           '<input type="text" id="log-filter" class="log-filter" placeholder="Filter all (substring)…">' +
+          '<button id="log-search-btn" class="btn" type="button" title="Search the whole file on the server, not just the loaded tail">🔎 Whole file</button>' +
+          '<button id="log-earlier-btn" class="btn" type="button" title="Load earlier lines before the loaded tail">⇡ Earlier</button>' +
+          '<input type="text" id="log-goto" class="log-goto" placeholder="Go to line / % / time" title="Jump to a line number (e.g. 1200), a position (e.g. 50%) or a time (e.g. 2026-10-18T09:15:00Z)">' +
           '<span id="log-view-name" class="log-stat"></span>' +
           '<span id="log-stat" class="log-stat"></span>' +
         '</div>' +
+        '<div id="log-hist" class="log-hist hidden"></div>' +
+        '<div id="log-facets" class="log-facets hidden"></div>' +
+        '<div id="log-patterns" class="log-facets hidden"></div>' +
         '<div id="log-body"></div>';
 
       const liveBtn = document.getElementById('log-live-btn');
@@ -3524,23 +3899,76 @@ const indexHTML = `<!DOCTYPE html>
       const filterInput = document.getElementById('log-filter');
       const colsBtn = document.getElementById('log-cols-btn');
       const viewsBtn = document.getElementById('log-views-btn');
+      const searchBtn = document.getElementById('log-search-btn');
+      const earlierBtn = document.getElementById('log-earlier-btn');
+      const setBtn = document.getElementById('log-set-btn');
+      const mergeBtn = document.getElementById('log-merge-btn');
+      const formatSel = document.getElementById('log-format');
+      const gotoInput = document.getElementById('log-goto');
 
       jsonToggle.checked = logState.jsonMode;
       filterInput.value = logState.globalFilter;
-      if (logState.jsonMode) colsBtn.classList.remove('hidden');
+      const facetsBtn = document.getElementById('log-facets-btn');
+      if (logState.jsonMode) { colsBtn.classList.remove('hidden'); facetsBtn.classList.remove('hidden'); }
+      facetsBtn.addEventListener('click', () => toggleLogFacets());
+      document.getElementById('log-patterns-btn').addEventListener('click', () => toggleLogPatterns());
 
       liveBtn.addEventListener('click', () => toggleLogLive());
       clearBtn.addEventListener('click', () => clearLog());
       jsonToggle.addEventListener('change', () => {
         logState.jsonMode = jsonToggle.checked;
         colsBtn.classList.toggle('hidden', !logState.jsonMode);
+        facetsBtn.classList.toggle('hidden', !logState.jsonMode);
+        if (!logState.jsonMode) document.getElementById('log-facets').classList.add('hidden');
         saveLocalLogConfig(); renderLog();
       });
       filterInput.addEventListener('input', () => {
-        logState.globalFilter = filterInput.value; saveLocalLogConfig(); renderLog();
+        logState.globalFilter = filterInput.value; logState.search = null; saveLocalLogConfig(); renderLog();
+      });
+      filterInput.addEventListener('keydown', (e) => {
+        if (e.key === 'Enter' && filterInput.value.trim()) searchLogFile(false);
+      });
+      searchBtn.addEventListener('click', () => searchLogFile(false));
+      earlierBtn.addEventListener('click', () => loadEarlierLog());
+      setBtn.addEventListener('click', () => toggleLogSet());
+      mergeBtn.addEventListener('click', () => toggleLogMerge());
+      const entriesSel = document.getElementById('log-entries');
+      entriesSel.value = logState.entries;
+      entriesSel.addEventListener('change', () => {
+        if (entriesSel.value === 'regex') {
+          const re = prompt('Regular expression matching the first line of an entry:', logState.entryStart || '^\\S');
+          if (!re) { entriesSel.value = logState.entries; return; }
+          logState.entryStart = re;
+        }
+        logState.entries = entriesSel.value;
+        saveLocalLogConfig();
+        reloadLogEntries();
+      });
+      const ansiSel = document.getElementById('log-ansi');
+      ansiSel.value = logState.ansi;
+      ansiSel.addEventListener('change', () => {
+        logState.ansi = ansiSel.value;
+        saveLocalLogConfig();
+        reloadLogEntries();
+      });
+      formatSel.value = logState.format;
+      formatSel.addEventListener('change', () => {
+        logState.format = formatSel.value;
+        logState.records = new Map();
+        logState.allCols = [];
+        saveLocalLogConfig(); renderLog();
+      });
+      if (isArchivedLogPath(filePath)) {
+        // Rotated and compressed logs are read-only snapshots.
+        liveBtn.classList.add('hidden');
+        clearBtn.classList.add('hidden');
+      }
+      gotoInput.addEventListener('keydown', (e) => {
+        if (e.key === 'Enter' && gotoInput.value.trim()) gotoLog(gotoInput.value.trim());
       });
       colsBtn.addEventListener('click', (e) => { e.stopPropagation(); toggleLogMenu('log-cols-menu', renderColumnsMenu); });
       viewsBtn.addEventListener('click', (e) => { e.stopPropagation(); toggleLogMenu('log-views-menu', renderViewsMenu); });
+      document.getElementById('log-alerts-btn').addEventListener('click', (e) => { e.stopPropagation(); toggleLogMenu('log-alerts-menu', renderAlertsMenu); });
       document.removeEventListener('click', closeLogMenus);
       document.addEventListener('click', closeLogMenus);
 
@@ -3549,17 +3977,419 @@ const indexHTML = `<!DOCTYPE html>
       renderHeaderTags();
       if (window.innerWidth <= 768 && !sidebarHidden) applySidebarVisibility(true, false);
 
+      // ?live=1 (used by the runs page) starts tailing straight away.
+      const startLive = new URLSearchParams(window.location.search).get('live') === '1';
       if (pushState) {
         const url = new URL(window.location.href);
         url.searchParams.set('file', activeFile);
         if (baseFolderPath) url.searchParams.set('baseFolderPath', baseFolderPath);
         url.searchParams.set('sidebar', sidebarHidden ? '0' : '1');
         url.searchParams.delete('fullscreen');
+        url.searchParams.delete('live');
         window.history.pushState({ file: activeFile, sidebar: !sidebarHidden }, '', url);
       }
 
       loadLogViews();
+      loadLogSet();
+      await fetchLog(true);
+      if (startLive && !isArchivedLogPath(filePath) && logState && !logState.live) toggleLogLive();
+      loadLogHistogram();
+      if (logState && logState.hidePatterns) loadLogPatterns();
+    }
+
+    // Query string selecting the open log, or its whole rotation family.
+    function logPathParams() {
+      return 'path=' + encodeURIComponent(logState.path) + (logState.set ? '&set=1' : '') + logEntryParams() + logAnsiParams();
+    }
+
+    // ANSI escapes: the server parses them into styled spans (ansi=spans)
+    // while the buffer keeps the raw bytes, so offsets still add up. Spans
+    // are cached by line; filters and highlighting use the plain text.
+    function logAnsiParams() {
+      return logState.ansi ? '&ansi=spans' : '';
+    }
+    function storeAnsiSpans(data) {
+      if (!data.ansi || !data.content) return;
+      if (logState.ansiSpans.size > 100000) logState.ansiSpans = new Map();
+      const lines = data.content.split('\n');
+      data.ansi.forEach(a => { if (lines[a.line] !== undefined) logState.ansiSpans.set(lines[a.line], a.spans); });
+    }
+    function ansiText(line) {
+      if (!logState.ansi || line.indexOf('\x1b') < 0) return line;
+      const spans = logState.ansiSpans.get(line);
+      // Lines split across stream chunks miss the cache; just strip them.
+      return spans ? spans.map(sp => sp.text).join('') :
+        line.replace(/\x1b(?:\[[0-?]*[ -\/]*[@-~]?|[\]P_^][^\x07\x1b]*(?:\x07|\x1b\\)?|[ -\/]*[0-~]?)/g, '');
+    }
+    function ansiSpanStyle(sp) {
+      let fg = sp.fg, bg = sp.bg;
+      if (sp.inverse) { fg = sp.bg || 'var(--bg)'; bg = sp.fg || 'var(--text)'; }
+      const css = [];
+      if (fg) css.push('color:' + fg);
+      if (bg) css.push('background:' + bg);
+      if (sp.bold) css.push('font-weight:600');
+      if (sp.dim) css.push('opacity:.7');
+      if (sp.italic) css.push('font-style:italic');
+      const deco = [sp.underline ? 'underline' : '', sp.strike ? 'line-through' : ''].filter(Boolean).join(' ');
+      if (deco) css.push('text-decoration:' + deco);
+      return css.join(';');
+    }
+    // Render spans, marking the first match of filter like highlightFilter.
+    function ansiSpansHtml(spans, filter) {
+      const plain = spans.map(sp => sp.text).join('');
+      const idx = filter ? plain.toLowerCase().indexOf(filter) : -1;
+      const end = idx + (filter ? filter.length : 0);
+      let pos = 0, html = '';
+      spans.forEach(sp => {
+        const a = pos, b = pos + sp.text.length;
+        let inner;
+        if (idx >= 0 && idx < b && end > a) {
+          const x = Math.max(idx, a) - a, y = Math.min(end, b) - a;
+          inner = escapeHtml(sp.text.slice(0, x)) + '<mark class="search-highlight">' + escapeHtml(sp.text.slice(x, y)) + '</mark>' + escapeHtml(sp.text.slice(y));
+        } else {
+          inner = escapeHtml(sp.text);
+        }
+        const style = ansiSpanStyle(sp);
+        html += style ? '<span style="' + style + '">' + inner + '</span>' : inner;
+        pos = b;
+      });
+      return html;
+    }
+    function logLineHtml(line, filter) {
+      const spans = logState.ansi === 'color' && line.indexOf('\x1b') >= 0 ? logState.ansiSpans.get(line) : null;
+      return spans ? ansiSpansHtml(spans, filter) : highlightFilter(ansiText(line), filter);
+    }
+    function logUnitHtml(unit, filter) {
+      if (!logState.ansi) return highlightFilter(unit.join('\n'), filter);
+      return unit.map(l => logLineHtml(l, filter)).join('\n');
+    }
+
+    // Entry grouping: the server reports the byte offsets of lines that
+    // start an entry (timestamped, unindented or matching a regex), and the
+    // lines up to the next start, such as a stack trace, belong to it.
+    function logEntryParams() {
+      if (!logState.entries) return '';
+      if (logState.entries === 'regex') return '&entryStart=' + encodeURIComponent(logState.entryStart);
+      return '&entries=' + logState.entries;
+    }
+
+    async function reloadLogEntries() {
+      const wasLive = logState.live;
+      if (wasLive) toggleLogLive();
+      logState.search = null;
+      logState.page = null;
       await fetchLog(true);
+      if (wasLive && logState) toggleLogLive();
+    }
+
+    function logEntryUnits(lines, start, starts) {
+      if (!logState.entries || logState.merge || !starts) return lines.map(l => [l]);
+      const units = [];
+      let off = start;
+      lines.forEach(l => {
+        if (!units.length || starts.has(off)) units.push([l]);
+        else units[units.length - 1].push(l);
+        off += (/[^\x00-\x7f]/.test(l) ? utf8Length(l) : l.length) + 1;
+      });
+      return units;
+    }
+
+    async function loadLogSet() {
+      const path = logState.path;
+      try {
+        const resp = await fetch('/api/log/set?path=' + encodeURIComponent(path));
+        if (!resp.ok) return;
+        const data = await resp.json();
+        if (!logState || logState.path !== path) return;
+        logState.setMembers = data.members || [];
+        const btn = document.getElementById('log-set-btn');
+        if (btn && logState.setMembers.length > 1) {
+          btn.classList.remove('hidden');
+          btn.title = 'Show ' + logState.setMembers.map(m => m.path.split('/').pop()).join(', ') + ' as one timeline';
+        }
+      } catch (e) {}
+    }
+
+    // Volume sparkline: line counts per time bucket, stacked by level.
+    // Clicking a bar opens the log at the start of that bucket.
+    const LOG_HIST_LEVELS = ['fatal', 'error', 'warn', 'info', 'debug', 'trace', 'other', 'unknown'];
+
+    async function loadLogHistogram() {
+      const el = document.getElementById('log-hist');
+      if (!el || !logState) return;
+      const state = logState;
+      const params = logPathParams() + (state.format !== 'auto' ? '&format=' + encodeURIComponent(state.format) : '');
+      try {
+        const resp = await fetch('/api/log/histogram?' + params);
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (logState !== state) return;
+        renderLogHistogram(el, data);
+      } catch (e) {
+        el.classList.add('hidden');
+      }
+    }
+
+    function renderLogHistogram(el, data) {
+      if (!data.buckets.length || data.buckets.length < 2) { el.classList.add('hidden'); return; }
+      const peak = Math.max(1, ...data.buckets.map(b => b.total));
+      let html = '<div class="log-hist-bars">';
+      data.buckets.forEach(b => {
+        const parts = LOG_HIST_LEVELS.filter(l => b.levels[l]).map(l =>
+          '<div class="log-hist-seg log-hist-' + l + '" style="height:' + (b.levels[l] / peak * 100) + '%"></div>').join('');
+        const tip = b.time + ' · ' + b.total.toLocaleString() + ' lines' +
+          LOG_HIST_LEVELS.filter(l => b.levels[l]).map(l => '\n' + l + ': ' + b.levels[l].toLocaleString()).join('');
+        html += '<div class="log-hist-bar" data-time="' + escapeHtml(b.time) + '" title="' + escapeHtml(tip) + '">' + parts + '</div>';
+      });
+      html += '</div><div class="log-hist-axis muted"><span>' + escapeHtml(data.buckets[0].time) + '</span>' +
+        '<span>' + data.bucket + ' buckets · ' + data.lines.toLocaleString() + ' lines</span>' +
+        '<span>' + escapeHtml(data.buckets[data.buckets.length - 1].time) + '</span></div>';
+      el.innerHTML = html;
+      el.classList.remove('hidden');
+      el.querySelectorAll('.log-hist-bar').forEach(bar => {
+        bar.addEventListener('click', () => gotoLog(bar.dataset.time));
+      });
+    }
+
+    // Pattern panel: lines grouped into templates server-side (numbers, IDs,
+    // IPs and hex masked). Hiding the top N templates filters their lines
+    // out of the view using each template's anchored regexp.
+    function toggleLogPatterns() {
+      const panel = document.getElementById('log-patterns');
+      if (!panel) return;
+      panel.classList.toggle('hidden');
+      if (!panel.classList.contains('hidden')) loadLogPatterns();
+    }
+
+    async function loadLogPatterns() {
+      if (!logState) return;
+      const state = logState;
+      const panel = document.getElementById('log-patterns');
+      const visible = panel && !panel.classList.contains('hidden');
+      if (visible) panel.innerHTML = '<div class="muted">Mining patterns…</div>';
+      const params = logPathParams() + (state.format !== 'auto' ? '&format=' + encodeURIComponent(state.format) : '') + '&limit=200';
+      try {
+        const resp = await fetch('/api/log/patterns?' + params);
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (logState !== state) return;
+        data.patterns.forEach(p => { try { p.re = new RegExp(p.match); } catch (e) { p.re = null; } });
+        state.patterns = data;
+        if (visible) renderLogPatterns(panel);
+        if (state.hidePatterns) renderLog();
+      } catch (e) {
+        if (visible) panel.innerHTML = '<div class="muted">Pattern mining failed: ' + escapeHtml(e.message) + '</div>';
+      }
+    }
+
+    function hiddenByPattern(line) {
+      const n = logState.hidePatterns;
+      if (!n || !logState.patterns) return false;
+      const ps = logState.patterns.patterns;
+      for (let i = 0; i < n && i < ps.length; i++) {
+        if (ps[i].re && ps[i].re.test(line)) return true;
+      }
+      return false;
+    }
+
+    function renderLogPatterns(panel) {
+      const data = logState.patterns;
+      const seen = s => 'line ' + s.line + (s.time ? ' · ' + s.time : '');
+      let html = '<div class="log-facets-head muted">' + data.templates.toLocaleString() + ' templates over ' +
+        data.lines.toLocaleString() + ' lines' + (data.complete ? '' : ' (first ' + Math.round(data.scanned / 1048576) + ' MiB)') +
+        ' · Hide top <input type="number" id="log-hide-patterns" class="log-hide-n" min="0" max="' + data.patterns.length + '" value="' + logState.hidePatterns + '"> noisy templates' +
+        ' · <a href="#" id="log-patterns-refresh">refresh</a></div>';
+      html += '<table class="log-patterns-table"><tbody>';
+      data.patterns.forEach((p, i) => {
+        const pct = data.lines ? (p.count / data.lines * 100) : 0;
+        html += '<tr class="' + (i < logState.hidePatterns ? 'log-pattern-hidden' : '') + '" title="' + escapeHtml(p.examples.join('\n')) + '">' +
+          '<td class="log-pattern-count">' + p.count.toLocaleString() + '<div class="muted">' + pct.toFixed(1) + '%</div></td>' +
+          '<td><code>' + escapeHtml(p.template) + '</code>' +
+          '<div class="muted"><a href="#" data-line="' + p.first.line + '">first ' + escapeHtml(seen(p.first)) + '</a> · ' +
+          '<a href="#" data-line="' + p.last.line + '">last ' + escapeHtml(seen(p.last)) + '</a></div></td></tr>';
+      });
+      html += '</tbody></table>';
+      panel.innerHTML = html;
+      panel.querySelector('#log-patterns-refresh').addEventListener('click', (e) => { e.preventDefault(); loadLogPatterns(); });
+      const hideInput = panel.querySelector('#log-hide-patterns');
+      hideInput.addEventListener('change', () => {
+        logState.hidePatterns = Math.max(0, parseInt(hideInput.value, 10) || 0);
+        saveLocalLogConfig(); renderLog(); renderLogPatterns(panel);
+      });
+      panel.querySelectorAll('a[data-line]').forEach(a => {
+        a.addEventListener('click', (e) => { e.preventDefault(); gotoLog('', 'line=' + a.dataset.line); });
+      });
+    }
+
+    // Facet panel: per-field top values and numeric stats computed by the
+    // server over the whole file, honouring the current filters. Clicking a
+    // value sets that column's filter.
+    function toggleLogFacets() {
+      const panel = document.getElementById('log-facets');
+      if (!panel) return;
+      panel.classList.toggle('hidden');
+      if (!panel.classList.contains('hidden')) loadLogFacets();
+    }
+
+    async function loadLogFacets() {
+      const panel = document.getElementById('log-facets');
+      if (!panel || panel.classList.contains('hidden') || !logState) return;
+      const state = logState;
+      const params = new URLSearchParams({ path: state.path, format: state.format });
+      if (state.set) params.set('set', '1');
+      const cols = visibleColumns();
+      if (cols.length) params.set('fields', cols.join(','));
+      if (state.globalFilter.trim()) params.set('q', state.globalFilter.trim());
+      Object.keys(state.colConfig.filters).forEach(k => {
+        const v = (state.colConfig.filters[k] || '').trim();
+        if (v) params.append('where', k + '~' + v);
+      });
+      panel.innerHTML = '<div class="muted">Computing facets…</div>';
+      try {
+        const resp = await fetch('/api/log/stats?' + params.toString());
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (logState !== state) return;
+        renderLogFacets(panel, data);
+      } catch (e) {
+        panel.innerHTML = '<div class="muted">Facets failed: ' + escapeHtml(e.message) + '</div>';
+      }
+    }
+
+    function renderLogFacets(panel, data) {
+      const fmt = n => (Math.round(n * 1000) / 1000).toLocaleString();
+      let html = '<div class="log-facets-head muted">' + data.records.toLocaleString() + ' records' +
+        (data.complete ? '' : ' (first ' + Math.round(data.scanned / 1048576) + ' MiB)') +
+        ' · <a href="#" id="log-facets-refresh">refresh</a></div><div class="log-facets-grid">';
+      data.fields.forEach(f => {
+        if (!f.count) return;
+        html += '<div class="log-facet"><div class="log-facet-name">' + escapeHtml(f.field) +
+          ' <span class="muted">' + f.count.toLocaleString() + (f.distinct > 1 ? ' · ' + f.distinct + (f.capped ? '+' : '') + ' values' : '') + '</span></div>';
+        if (f.numeric) {
+          const n = f.numeric;
+          html += '<div class="log-facet-num muted">min ' + fmt(n.min) + ' · p50 ' + fmt(n.p50) + ' · p95 ' + fmt(n.p95) +
+            ' · p99 ' + fmt(n.p99) + ' · max ' + fmt(n.max) + '</div>';
+        }
+        if (!f.numeric || f.distinct <= 20) {
+          f.top.forEach(v => {
+            html += '<button type="button" class="log-facet-val" data-col="' + escapeHtml(f.field) + '" data-val="' + escapeHtml(v.value) + '">' +
+              escapeHtml(v.value === '' ? '(empty)' : v.value) + ' <span class="muted">' + v.count.toLocaleString() + '</span></button>';
+          });
+        }
+        html += '</div>';
+      });
+      html += '</div>';
+      panel.innerHTML = html;
+      panel.querySelector('#log-facets-refresh').addEventListener('click', (e) => { e.preventDefault(); loadLogFacets(); });
+      panel.querySelectorAll('.log-facet-val').forEach(btn => {
+        btn.addEventListener('click', () => {
+          logState.colConfig.filters[btn.dataset.col] = btn.dataset.val;
+          if (!logState.allCols.includes(btn.dataset.col)) logState.allCols.push(btn.dataset.col);
+          saveLocalLogConfig(); renderLog(); loadLogFacets();
+        });
+      });
+    }
+
+    // Merged view: several logs interleaved by timestamp. Each line is tagged
+    // with its source — JSON records gain a "source" field (a table column),
+    // other lines a "[file]" prefix — and the result is shown like one log.
+    function decorateMergedLine(l) {
+      const name = l.source.split('/').pop();
+      const obj = tryParseJson(l.text);
+      if (obj) return JSON.stringify(Object.assign({ source: name }, obj));
+      return '[' + name + '] ' + l.text;
+    }
+
+    function mergedContent(lines) {
+      return lines.map(decorateMergedLine).map(l => l + '\n').join('');
+    }
+
+    async function toggleLogMerge() {
+      if (!logState) return;
+      const wasLive = logState.live;
+      if (logState.live) toggleLogLive();
+      const btn = document.getElementById('log-merge-btn');
+      const readOnlyBtns = ['log-earlier-btn', 'log-goto', 'log-search-btn', 'log-set-btn', 'log-clear-btn'];
+      if (logState.merge) {
+        logState.merge = null;
+        btn.textContent = '⊕ Merge';
+        btn.classList.remove('log-live-on');
+        readOnlyBtns.forEach(id => {
+          const el = document.getElementById(id);
+          if (!el) return;
+          if (id === 'log-set-btn') el.classList.toggle('hidden', logState.setMembers.length <= 1);
+          else if (id === 'log-clear-btn') el.classList.toggle('hidden', isArchivedLogPath(logState.path));
+          else el.classList.remove('hidden');
+        });
+        logState.stick = true;
+        await fetchLog(true);
+        return;
+      }
+      const dir = logState.path.includes('/') ? logState.path.slice(0, logState.path.lastIndexOf('/') + 1) : '';
+      const suggest = files.filter(f => f !== logState.path && isLogPath(f) && !isArchivedLogPath(f) &&
+        f.startsWith(dir) && !f.slice(dir.length).includes('/'));
+      const answer = prompt('Merge ' + logState.path + ' with (comma-separated log paths):', suggest.join(', '));
+      if (!answer) return;
+      const paths = [logState.path].concat(answer.split(',').map(s => s.trim()).filter(Boolean));
+      const params = new URLSearchParams();
+      paths.forEach(p => params.append('path', p));
+      try {
+        const resp = await fetch('/api/log/merge?' + params.toString());
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (!logState) return;
+        logState.set = false;
+        logState.search = null;
+        logState.page = null;
+        logState.merge = { paths: data.paths, offsets: data.offsets };
+        btn.textContent = '⊖ Unmerge (' + data.paths.length + ')';
+        btn.classList.add('log-live-on');
+        readOnlyBtns.forEach(id => { const el = document.getElementById(id); if (el) el.classList.add('hidden'); });
+        logState.stick = true;
+        applyLogChunk({ content: mergedContent(data.lines), offset: logState.offset, start: 0 }, true);
+        if (wasLive) toggleLogLive();
+      } catch (e) {
+        alert('Merge failed: ' + e.message);
+      }
+    }
+
+    function startMergeStream() {
+      const m = logState.merge;
+      const params = new URLSearchParams();
+      m.paths.forEach(p => params.append('path', p));
+      params.set('offsets', m.offsets.join(','));
+      const es = new EventSource('/api/log/merge/stream?' + params.toString());
+      es.addEventListener('lines', (ev) => {
+        if (!logState || logState.merge !== m || logState.stream !== es) { es.close(); return; }
+        const data = JSON.parse(ev.data);
+        m.offsets = data.offsets;
+        if (data.lines.length) applyLogChunk({ content: mergedContent(data.lines), offset: logState.offset }, false);
+      });
+      // Reconnect with the latest offsets rather than the original URL's.
+      es.onerror = () => {
+        es.close();
+        setTimeout(() => {
+          if (logState && logState.merge === m && logState.stream === es) startMergeStream();
+        }, 2000);
+      };
+      logState.stream = es;
+    }
+
+    // Switch between this file and its rotation family (oldest first). The
+    // set is a snapshot, so live tail is stopped while it is shown.
+    async function toggleLogSet() {
+      if (!logState) return;
+      if (logState.live) toggleLogLive();
+      logState.set = !logState.set;
+      logState.search = null;
+      logState.page = null;
+      logState.stick = true;
+      const btn = document.getElementById('log-set-btn');
+      if (btn) btn.classList.toggle('log-live-on', logState.set);
+      const liveBtn = document.getElementById('log-live-btn');
+      if (liveBtn && !isArchivedLogPath(logState.path)) liveBtn.classList.toggle('hidden', logState.set);
+      await fetchLog(true);
+      loadLogHistogram();
     }
 
     function toggleLogMenu(menuId, renderFn) {
@@ -3576,31 +4406,156 @@ const indexHTML = `<!DOCTYPE html>
     async function fetchLog(initial) {
       if (!logState) return;
       try {
-        let url = '/api/log?path=' + encodeURIComponent(logState.path);
+        let url = '/api/log?' + logPathParams();
         if (!initial) url += '&offset=' + logState.offset;
         const resp = await fetch(url);
         if (!resp.ok) throw new Error('failed');
         const data = await resp.json();
         if (!logState || logState.path !== activeFile) return;
+        applyLogChunk(data, initial || (data.truncated && data.offset <= logState.offset));
+      } catch (e) {
+        const stat = document.getElementById('log-stat');
+        if (stat) stat.textContent = 'fetch error';
+      }
+    }
 
-        if (initial || (data.truncated && data.offset <= logState.offset)) {
-          logState.buffer = data.content;
-        } else if (data.content) {
-          logState.buffer += data.content;
-        }
-        const MAX_BUF = 5 << 20;
-        if (logState.buffer.length > MAX_BUF) {
-          const cut = logState.buffer.indexOf('\n', logState.buffer.length - MAX_BUF);
-          logState.buffer = logState.buffer.slice(cut >= 0 ? cut + 1 : logState.buffer.length - MAX_BUF);
+    // Append (or, on reset, replace) the buffer with a chunk from /api/log
+    // or /api/log/stream, keeping at most MAX_BUF characters.
+    function applyLogChunk(data, reset) {
+      if (data.format) {
+        logState.detected = data.format;
+        const sel = document.getElementById('log-format');
+        if (sel && sel.options[0]) sel.options[0].textContent = 'auto (' + data.format + ')';
+      }
+      if (reset) logState.entryStarts = new Set();
+      (data.entries || []).forEach(o => logState.entryStarts.add(o));
+      storeAnsiSpans(data);
+      if (reset) {
+        logState.buffer = data.content;
+        logState.start = typeof data.start === 'number' ? data.start : data.offset - utf8Length(data.content);
+      } else if (data.content) {
+        logState.buffer += data.content;
+      }
+      const MAX_BUF = 5 << 20;
+      if (logState.buffer.length > MAX_BUF) {
+        const cut = logState.buffer.indexOf('\n', logState.buffer.length - MAX_BUF);
+        const keep = cut >= 0 ? cut + 1 : logState.buffer.length - MAX_BUF;
+        logState.start += utf8Length(logState.buffer.slice(0, keep));
+        logState.buffer = logState.buffer.slice(keep);
+      }
+      logState.offset = data.offset;
+      if (!logState.resizing) renderLog();
+    }
+
+    function utf8Length(s) {
+      return new TextEncoder().encode(s).length;
+    }
+
+    // Page backwards from the start of the loaded buffer. The server returns
+    // whole lines ending at that byte offset, completing a partial first line.
+    async function loadEarlierLog() {
+      if (!logState || logState.start <= 0) return;
+      const path = logState.path;
+      try {
+        const resp = await fetch('/api/log?' + logPathParams() + '&before=' + logState.start + '&lines=1000');
+        if (!resp.ok) throw new Error('failed');
+        const data = await resp.json();
+        if (!logState || logState.path !== path || data.offset !== logState.start) return;
+        logState.buffer = data.content + logState.buffer;
+        logState.start = data.start;
+        storeAnsiSpans(data);
+        (data.entries || []).forEach(o => logState.entryStarts.add(o));
+        logState.stick = false;
+        renderLog();
+        const scroller = document.querySelector('#log-body .log-output, #log-body .log-table-wrap');
+        if (scroller) scroller.scrollTop = 0;
+      } catch (e) {
+        const stat = document.getElementById('log-stat');
+        if (stat) stat.textContent = 'fetch error';
+      }
+    }
+
+    // Random access: show a page of lines at a line number ("1200") or a
+    // position in the file ("50%"), with paging in both directions.
+    async function gotoLog(target, params) {
+      if (!logState) return;
+      const path = logState.path;
+      let query = params;
+      try {
+        if (!query) {
+          const pct = /^(\d+(?:\.\d+)?)\s*%$/.exec(target);
+          if (pct) query = 'percent=' + pct[1];
+          else if (/^\d{1,9}$/.test(target)) query = 'line=' + target;
+          else {
+            // Anything else is a timestamp: find the first line at or after it.
+            const sr = await fetch('/api/log/seek?' + logPathParams() + '&time=' + encodeURIComponent(target));
+            if (!sr.ok) throw new Error(await sr.text());
+            query = 'line=' + (await sr.json()).line;
+          }
         }
-        logState.offset = data.offset;
-        if (!logState.resizing) renderLog();
+        const resp = await fetch('/api/log?' + logPathParams() + '&' + query + '&lines=500');
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (!logState || logState.path !== path) return;
+        logState.search = null;
+        logState.page = data;
+        storeAnsiSpans(data);
+        logState.stick = false;
+        renderLog();
       } catch (e) {
         const stat = document.getElementById('log-stat');
         if (stat) stat.textContent = 'fetch error';
       }
     }
 
+    function renderLogPage(body) {
+      const p = logState.page;
+      const lines = p.content.replace(/\n$/, '').split('\n');
+      const stat = document.getElementById('log-stat');
+      if (stat) stat.textContent = 'lines ' + p.line + '–' + (p.line + lines.length - 1) + ' of ' + p.totalLines;
+      let html = '<div style="display:flex;gap:8px;margin-bottom:8px;">' +
+        '<button id="log-page-close" class="btn" type="button">↩ Back to tail</button>' +
+        (p.start > 0 ? '<button id="log-page-prev" class="btn" type="button">⇡ Earlier</button>' : '') +
+        (p.offset < p.size ? '<button id="log-page-next" class="btn" type="button">⇣ Later</button>' : '') +
+        '</div>';
+      html += '<pre class="log-output">' + (p.content ? lines.map((l, i) =>
+        '<div class="log-line"><span class="muted">' + (p.line + i) + ':</span> ' + logLineHtml(l, '') + '</div>'
+      ).join('') : '') + '</pre>';
+      body.innerHTML = html;
+      document.getElementById('log-page-close').addEventListener('click', () => {
+        logState.page = null; logState.stick = true; renderLog();
+      });
+      const prev = document.getElementById('log-page-prev');
+      if (prev) prev.addEventListener('click', () => gotoLog('', 'before=' + p.start));
+      const next = document.getElementById('log-page-next');
+      if (next) next.addEventListener('click', () => gotoLog('', 'line=' + (p.line + lines.length)));
+    }
+
+    // Live tail over server-sent events: the server pushes appended bytes
+    // from one shared watcher per file. Falls back to polling.
+    function startLogStream() {
+      if (logState.merge) {
+        if (window.EventSource) startMergeStream();
+        return;
+      }
+      if (!window.EventSource) {
+        logState.timer = setInterval(() => fetchLog(false), 1500);
+        return;
+      }
+      const path = logState.path;
+      const es = new EventSource('/api/log/stream?path=' + encodeURIComponent(path) + '&offset=' + logState.offset + logEntryParams() + logAnsiParams());
+      es.addEventListener('log', (ev) => {
+        if (!logState || logState.path !== path || logState.stream !== es) { es.close(); return; }
+        const data = JSON.parse(ev.data);
+        applyLogChunk(data, !!data.reset);
+      });
+      es.onerror = () => {
+        const stat = document.getElementById('log-stat');
+        if (stat && es.readyState !== EventSource.OPEN) stat.textContent = 'reconnecting…';
+      };
+      logState.stream = es;
+    }
+
     function toggleLogLive() {
       if (!logState) return;
       const liveBtn = document.getElementById('log-live-btn');
@@ -3613,20 +4568,28 @@ const indexHTML = `<!DOCTYPE html>
         logState.stick = true;
         liveBtn.textContent = '⏸ Live (on)';
         liveBtn.classList.add('log-live-on');
-        logState.timer = setInterval(() => fetchLog(false), 1500);
+        startLogStream();
       }
     }
 
     async function clearLog() {
       if (!logState) return;
-      if (!confirm('Clear (truncate) this log file? This cannot be undone.')) return;
+      if (!confirm('Clear (truncate) this log file?')) return;
+      const backup = confirm('Keep a gzipped backup of the current contents beside the log first?\n\n' +
+        'OK = back up, then clear\nCancel = clear without a backup (cannot be undone)');
       try {
-        const resp = await fetch('/api/log/clear?path=' + encodeURIComponent(logState.path), { method: 'POST' });
+        const resp = await fetch('/api/log/clear?path=' + encodeURIComponent(logState.path) + (backup ? '&backup=1&gzip=1' : ''), { method: 'POST' });
         if (!resp.ok) throw new Error('failed');
+        const data = await resp.json();
         logState.buffer = '';
         logState.offset = 0;
         logState.stick = true;
         renderLog();
+        if (data.backup) {
+          const stat = document.getElementById('log-stat');
+          if (stat) stat.textContent = 'Backed up to ' + data.backup;
+          loadLogSet();
+        }
       } catch (e) {
         alert('Failed to clear log file.');
       }
@@ -3638,6 +4601,47 @@ const indexHTML = `<!DOCTYPE html>
       try { const v = JSON.parse(t); return (v && typeof v === 'object') ? v : null; } catch (e) { return null; }
     }
 
+    // Structured record for a line in the table view: JSON lines parse in the
+    // browser; other formats (logfmt, access log, Go log) are parsed by the
+    // server's parser registry and cached per line.
+    function logFormat() {
+      return logState.format !== 'auto' ? logState.format : (logState.detected || 'json');
+    }
+
+    function logRecord(line) {
+      if (logFormat() === 'raw') return null;
+      const obj = tryParseJson(line);
+      if (obj || logFormat() === 'json') return obj;
+      return logState.records.get(line) || null;
+    }
+
+    // Ask the server to parse lines not yet in the cache, then re-render.
+    async function ensureLogRecords(lines) {
+      const fmt = logFormat();
+      if (fmt === 'json' || fmt === 'raw' || logState.parsePending) return;
+      if (logState.records.size > 100000) logState.records = new Map();
+      const missing = [...new Set(lines.filter(l => !logState.records.has(l) && !tryParseJson(l)))].slice(0, 5000);
+      if (!missing.length) return;
+      logState.parsePending = true;
+      const state = logState;
+      try {
+        const resp = await fetch('/api/log/parse', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ path: state.path, format: fmt, lines: missing })
+        });
+        if (!resp.ok) throw new Error('failed');
+        const data = await resp.json();
+        if (logState !== state || logFormat() !== fmt) return;
+        missing.forEach((l, i) => state.records.set(l, data.records[i] || null));
+      } catch (e) {
+        missing.forEach(l => state.records.set(l, null));
+      } finally {
+        state.parsePending = false;
+      }
+      if (logState === state) renderLog();
+    }
+
     function logLines() {
       const lines = logState.buffer.split('\n');
       if (lines.length && lines[lines.length - 1] === '') lines.pop();
@@ -3684,6 +4688,18 @@ const indexHTML = `<!DOCTYPE html>
         focusInfo = { col: active.dataset.col, start: active.selectionStart, end: active.selectionEnd };
       }
 
+      if (logState.search) {
+        renderLogSearch(body);
+        return;
+      }
+      if (logState.page) {
+        renderLogPage(body);
+        return;
+      }
+      if (logState.trace) {
+        renderLogTrace(body);
+        return;
+      }
       if (logState.jsonMode) {
         renderLogTable(body);
       } else {
@@ -3714,7 +4730,7 @@ const indexHTML = `<!DOCTYPE html>
 
     function updateLogStat(shownCount, total) {
       const stat = document.getElementById('log-stat');
-      if (stat) stat.textContent = shownCount + (shownCount !== total ? ' / ' + total : '') + ' lines';
+      if (stat) stat.textContent = shownCount + (shownCount !== total ? ' / ' + total : '') + (logState.entries ? ' entries' : ' lines');
     }
 
     function highlightFilter(text, filter) {
@@ -3730,19 +4746,77 @@ const indexHTML = `<!DOCTYPE html>
 
     function renderLogRaw(body) {
       const filter = logState.globalFilter.trim().toLowerCase();
-      const all = logLines();
-      const shown = filter ? all.filter(l => l.toLowerCase().includes(filter)) : all;
+      const all = logEntryUnits(logLines(), logState.start, logState.entryStarts);
+      const shown = all.filter(u => (!filter || u.map(ansiText).join('\n').toLowerCase().includes(filter)) && !hiddenByPattern(u[0]));
       updateLogStat(shown.length, all.length);
       if (!shown.length) {
-        body.innerHTML = '<div class="muted" style="padding:12px;">No log lines' + (filter ? ' match the filter.' : '.') + '</div>';
+        body.innerHTML = '<div class="muted" style="padding:12px;">No log lines' + (filter || logState.hidePatterns ? ' match the filter.' : '.') + '</div>';
         return;
       }
-      const html = shown.map(l =>
-        '<div class="log-line' + (filter ? ' log-hit' : '') + '">' + highlightFilter(l, filter) + '</div>'
+      const html = shown.map(u =>
+        '<div class="log-line' + (filter ? ' log-hit' : '') + (u.length > 1 ? ' log-entry' : '') + '">' + logUnitHtml(u, filter) + '</div>'
       ).join('');
       body.innerHTML = '<pre class="log-output">' + html + '</pre>';
     }
 
+    // Whole-file search: the loaded buffer only holds the tail, so matches
+    // further back are found server-side and paged with the returned cursor.
+    async function searchLogFile(more) {
+      if (!logState) return;
+      const q = logState.globalFilter.trim();
+      if (!q) { logState.search = null; renderLog(); return; }
+      const prev = more ? logState.search : null;
+      const params = new URLSearchParams({ path: logState.path, q: q, limit: '500' });
+      if (logState.set) params.set('set', '1');
+      if (logState.ansi) params.set('ansi', 'spans');
+      if (logState.entries === 'regex') params.set('entryStart', logState.entryStart);
+      else if (logState.entries) params.set('entries', logState.entries);
+      if (prev && prev.next) params.set('cursor', prev.next);
+      try {
+        const res = await fetch('/api/log/search?' + params.toString());
+        if (!res.ok) throw new Error(await res.text());
+        const data = await res.json();
+        if (!logState || logState.globalFilter.trim() !== q) return;
+        logState.page = null;
+        logState.search = {
+          query: q,
+          matches: (prev ? prev.matches : []).concat(data.matches || []),
+          next: data.next || '',
+          size: data.size
+        };
+        logState.stick = false;
+        renderLog();
+      } catch (err) {
+        const stat = document.getElementById('log-stat');
+        if (stat) stat.textContent = 'Search failed: ' + err.message;
+      }
+    }
+
+    function renderLogSearch(body) {
+      const s = logState.search;
+      const filter = s.query.toLowerCase();
+      const stat = document.getElementById('log-stat');
+      if (stat) stat.textContent = s.matches.length + ' matches in whole file' + (s.next ? ' (more…)' : '');
+      let html = '<div style="display:flex;gap:8px;margin-bottom:8px;">' +
+        '<button id="log-search-close" class="btn" type="button">↩ Back to tail</button>' +
+        (s.next ? '<button id="log-search-more" class="btn" type="button">Load more</button>' : '') +
+        '</div>';
+      if (!s.matches.length) {
+        html += '<div class="muted" style="padding:12px;">No lines in the file match the filter.</div>';
+      } else {
+        html += '<pre class="log-output">' + s.matches.map(m =>
+          '<div class="log-line log-hit"><span class="muted">' + m.line + ':</span> ' +
+            (m.ansi && logState.ansi === 'color' ? ansiSpansHtml(m.ansi, filter) : highlightFilter(m.text, filter)) + '</div>'
+        ).join('') + '</pre>';
+      }
+      body.innerHTML = html;
+      document.getElementById('log-search-close').addEventListener('click', () => {
+        logState.search = null; logState.stick = true; renderLog();
+      });
+      const moreBtn = document.getElementById('log-search-more');
+      if (moreBtn) moreBtn.addEventListener('click', () => searchLogFile(true));
+    }
+
     function levelBadge(val) {
       const lvl = String(val).toLowerCase().trim();
       const known = ['error','fatal','critical','warn','warning','info','debug','trace'];
@@ -3761,7 +4835,9 @@ const indexHTML = `<!DOCTYPE html>
     function renderLogTable(body) {
       const globalFilter = logState.globalFilter.trim().toLowerCase();
       const all = logLines();
-      const rows = all.map(l => ({ raw: l, obj: tryParseJson(l) }));
+      ensureLogRecords(all);
+      const rows = logEntryUnits(all, logState.start, logState.entryStarts).map(u =>
+        ({ raw: u.join('\n'), head: u[0], rest: u.slice(1).join('\n'), obj: logRecord(u[0]) }));
       const parsedObjs = rows.filter(r => r.obj).map(r => r.obj);
       if (!parsedObjs.length) { renderLogRaw(body); return; }
 
@@ -3774,11 +4850,12 @@ const indexHTML = `<!DOCTYPE html>
 
       const shown = rows.filter(r => {
         if (globalFilter && !r.raw.toLowerCase().includes(globalFilter)) return false;
+        if (hiddenByPattern(r.head)) return false;
         if (!anyColFilter) return true;
         if (!r.obj) return false; // column filters exclude non-JSON lines
         return colFilters.every(k => cellString(r.obj[k]).toLowerCase().includes(c.filters[k].trim().toLowerCase()));
       });
-      updateLogStat(shown.length, all.length);
+      updateLogStat(shown.length, rows.length);
 
       let html = '<div class="log-table-wrap"><table class="log-table"><colgroup>';
       cols.forEach(k => {
@@ -3809,9 +4886,13 @@ const indexHTML = `<!DOCTYPE html>
           const v = cellString(r.obj[k]);
           const hl = (c.filters[k] || '').trim().toLowerCase() || globalFilter;
           if (LOG_LEVEL_KEYS.has(k.toLowerCase())) html += '<td>' + levelBadge(v) + '</td>';
+          else if (LOG_TRACE_KEYS.has(k) && v) html += '<td title="Show this trace"><a class="log-trace-link" data-trace="' + escapeHtml(v) + '">' + highlightFilter(v, hl) + '</a></td>';
           else html += '<td title="' + escapeHtml(v) + '">' + highlightFilter(v, hl) + '</td>';
         });
         html += '</tr>';
+        if (r.rest) {
+          html += '<tr class="log-raw-row log-cont"><td colspan="' + cols.length + '">' + highlightFilter(r.rest, globalFilter) + '</td></tr>';
+        }
       });
       html += '</tbody></table></div>';
       body.innerHTML = html;
@@ -3826,6 +4907,91 @@ const indexHTML = `<!DOCTYPE html>
       body.querySelectorAll('.log-col-resizer').forEach(rz => {
         rz.addEventListener('mousedown', startColResize);
       });
+      body.querySelectorAll('.log-trace-link').forEach(el => {
+        el.addEventListener('click', () => openLogTrace(el.dataset.trace));
+      });
+    }
+
+    // Trace view: every record of one trace across the open (or merged)
+    // logs, as a waterfall of spans. Click a span for its records.
+    async function openLogTrace(traceId) {
+      if (!logState) return;
+      const path = logState.path;
+      const paths = logState.merge ? logState.merge.paths : [logState.path];
+      const stat = document.getElementById('log-stat');
+      if (stat) stat.textContent = 'Loading trace…';
+      try {
+        const params = new URLSearchParams({ trace: traceId });
+        paths.forEach(p => params.append('path', p));
+        // Large logs are scanned around the rows on screen.
+        if (!logState.merge && typeof logState.start === 'number') params.set('at', logState.start);
+        const resp = await fetch('/api/log/trace?' + params.toString());
+        if (!resp.ok) throw new Error(await resp.text());
+        const data = await resp.json();
+        if (!logState || logState.path !== path) return;
+        logState.search = null;
+        logState.page = null;
+        logState.trace = data;
+        logState.stick = false;
+        renderLog();
+      } catch (err) {
+        if (stat) stat.textContent = 'Trace failed: ' + err.message;
+      }
+    }
+
+    function formatTraceMs(ms) {
+      if (ms >= 1000) return (ms / 1000).toFixed(ms >= 10000 ? 1 : 2) + 's';
+      if (ms >= 1) return ms.toFixed(ms >= 100 ? 0 : 1) + 'ms';
+      return ms > 0 ? (ms * 1000).toFixed(0) + 'µs' : '0';
+    }
+
+    function traceRecordsHtml(records) {
+      return records.map(r =>
+        '<div>' + escapeHtml((r.time || '').replace('T', ' ').replace(/Z$/, '')) + ' ' +
+        (r.level ? levelBadge(r.level) + ' ' : '') +
+        '<span class="muted">' + escapeHtml(r.source) + ':' + r.line + '</span> ' + escapeHtml(r.msg || r.text) + '</div>'
+      ).join('');
+    }
+
+    function renderLogTrace(body) {
+      const t = logState.trace;
+      const stat = document.getElementById('log-stat');
+      if (stat) {
+        stat.textContent = 'trace ' + t.trace + ': ' + t.spans.length + ' spans, ' + t.records + ' records, ' +
+          formatTraceMs(t.durationMs) + (t.complete ? '' : ' (incomplete)');
+      }
+      let html = '<div style="display:flex;gap:8px;margin-bottom:8px;">' +
+        '<button id="log-trace-close" class="btn" type="button">↩ Back to log</button></div>';
+      if (!t.spans.length && !t.unassigned.length) {
+        html += '<div class="muted" style="padding:12px;">No records carry this trace ID.</div>';
+      }
+      const total = t.durationMs || 1;
+      html += '<div class="log-trace">';
+      t.spans.forEach((sp, i) => {
+        const left = Math.min(100, sp.offsetMs / total * 100);
+        const width = Math.max(0.3, Math.min(100 - left, sp.durationMs / total * 100));
+        html += '<div class="log-trace-row" data-span="' + i + '" title="' + escapeHtml(sp.id + (sp.orphan ? ' (parent ' + sp.parent + ' not found)' : '')) + '">' +
+          '<div class="log-trace-name" style="padding-left:' + (sp.depth * 14) + 'px">' + (sp.orphan ? '⚠ ' : '') + escapeHtml(sp.name) +
+            (sp.service ? '<span class="log-trace-svc">' + escapeHtml(sp.service) + '</span>' : '') + '</div>' +
+          '<div class="log-trace-lane"><div class="log-trace-bar' + (sp.error ? ' log-trace-err' : '') +
+            '" style="left:' + left + '%;width:' + width + '%"></div></div>' +
+          '<div class="log-trace-dur">' + formatTraceMs(sp.durationMs) + '</div></div>' +
+          '<div class="log-trace-records hidden" id="log-trace-span-' + i + '">' + traceRecordsHtml(sp.records) + '</div>';
+      });
+      if (t.unassigned.length) {
+        html += '<div class="log-menu-title" style="margin-top:10px;">Records without a span</div>' +
+          '<div class="log-trace-records">' + traceRecordsHtml(t.unassigned) + '</div>';
+      }
+      html += '</div>';
+      body.innerHTML = html;
+      document.getElementById('log-trace-close').addEventListener('click', () => {
+        logState.trace = null; logState.stick = true; renderLog();
+      });
+      body.querySelectorAll('.log-trace-row').forEach(row => {
+        row.addEventListener('click', () => {
+          document.getElementById('log-trace-span-' + row.dataset.span).classList.toggle('hidden');
+        });
+      });
     }
 
     function startColResize(e) {
@@ -3906,6 +5072,15 @@ const indexHTML = `<!DOCTYPE html>
         '<button class="btn" id="log-view-save" type="button">💾 Save current as view…</button>' +
         (logState.currentView ? '<button class="btn" id="log-view-clear" type="button">Clear</button>' : '') +
         '</div>';
+      if (logState.currentView) {
+        // The server applies the saved view to the whole file, not just the
+        // loaded buffer.
+        const base = '/api/log/export?path=' + encodeURIComponent(logState.path) + (logState.set ? '&set=1' : '') +
+          '&view=' + encodeURIComponent(logState.currentView) + '&format=';
+        html += '<div class="log-menu-row log-view-export">⬇ Export view: ' +
+          ['csv', 'ndjson', 'tsv'].map(f => '<a href="' + escapeHtml(base + f) + '" download>' + f.toUpperCase() + '</a>').join(' · ') +
+          '</div>';
+      }
       menu.innerHTML = html;
 
       menu.querySelectorAll('.log-view-apply').forEach(el => {
@@ -3931,18 +5106,27 @@ const indexHTML = `<!DOCTYPE html>
     function applyLogView(name) {
       const v = logState.views.find(x => x.name === name);
       if (!v) return;
+      const prevEntries = logEntryParams();
       applyLogConfig(v.config || {});
       logState.currentView = name;
       const jsonToggle = document.getElementById('log-json-toggle');
       const filterInput = document.getElementById('log-filter');
       const colsBtn = document.getElementById('log-cols-btn');
+      const facetsBtn = document.getElementById('log-facets-btn');
+      const formatSel = document.getElementById('log-format');
       if (jsonToggle) jsonToggle.checked = logState.jsonMode;
       if (filterInput) filterInput.value = logState.globalFilter;
       if (colsBtn) colsBtn.classList.toggle('hidden', !logState.jsonMode);
+      if (facetsBtn) facetsBtn.classList.toggle('hidden', !logState.jsonMode);
+      const entriesSel = document.getElementById('log-entries');
+      if (formatSel) formatSel.value = logState.format;
+      if (entriesSel) entriesSel.value = logState.entries;
       saveLocalLogConfig();
       updateViewNameLabel();
       closeLogMenus();
       renderLog();
+      if (logState.hidePatterns && !logState.patterns) loadLogPatterns();
+      if (logEntryParams() !== prevEntries) reloadLogEntries();
     }
 
     async function saveLogView() {
@@ -3981,6 +5165,113 @@ const indexHTML = `<!DOCTYPE html>
       }
     }
 
+    // Alert rules live in .mdviewer files like views and are evaluated by the
+    // server in the background; the menu lists the rules covering this log
+    // and the alerts fired on it.
+    async function renderAlertsMenu() {
+      const menu = document.getElementById('log-alerts-menu');
+      if (!menu) return;
+      const path = logState.path;
+      menu.onclick = (e) => e.stopPropagation();
+      menu.innerHTML = '<div class="log-menu-empty">Loading…</div>';
+      let rules = [], fired = [], commands = false;
+      try {
+        const [r1, r2] = await Promise.all([
+          fetch('/api/log/alerts?path=' + encodeURIComponent(path)),
+          fetch('/api/log/alerts/history?limit=10&path=' + encodeURIComponent(path))
+        ]);
+        if (!r1.ok || !r2.ok) throw new Error('failed');
+        const d1 = await r1.json(), d2 = await r2.json();
+        rules = d1.rules || []; commands = d1.commands; fired = d2.alerts || [];
+      } catch (e) {
+        menu.innerHTML = '<div class="log-menu-empty">Failed to load alerts.</div>';
+        return;
+      }
+      if (!logState || logState.path !== path) return;
+
+      let html = '<div class="log-menu-title">Alert rules</div>';
+      if (!rules.length) {
+        html += '<div class="log-menu-empty">No alert rules cover this log.</div>';
+      }
+      rules.forEach(r => {
+        const scope = r.dir ? r.dir + '/' : 'root';
+        const cond = [r.pattern ? (r.regex ? '/' + r.pattern + '/' : '"' + r.pattern + '"') : '']
+          .concat(r.where || []).filter(Boolean).join(' ∧ ');
+        const actions = [r.notify ? 'notify' : '', r.webhook ? 'webhook' : '',
+          r.command ? (commands ? 'command' : 'command (disabled)') : ''].filter(Boolean).join(', ') || 'history only';
+        html += '<div class="log-menu-row log-view-row"><span class="log-view-apply">' +
+          (r.disabled ? '⏸ ' : '') + escapeHtml(r.name) + ' <span class="log-view-scope">' + escapeHtml(scope) + '</span>' +
+          '<br><span class="log-alert-rule">' + escapeHtml(cond) + ' · ' + (r.threshold || 1) + ' in ' + escapeHtml(r.window || '1m') +
+          ' · ' + escapeHtml(actions) + '</span>' +
+          (r.error ? '<br><span class="log-alert-err">' + escapeHtml(r.error) + '</span>' : '') + '</span>' +
+          '<span class="log-view-del" data-name="' + escapeHtml(r.name) + '" title="Delete rule">×</span></div>';
+      });
+      html += '<div class="log-menu-title">Recently fired</div>';
+      if (!fired.length) html += '<div class="log-menu-empty">Nothing fired on this log since the server started.</div>';
+      fired.forEach(a => {
+        const last = (a.lines || [])[a.lines.length - 1] || '';
+        html += '<div class="log-alert-fired">' + escapeHtml(new Date(a.time).toLocaleString()) + ' · <b>' + escapeHtml(a.rule) + '</b> · ' +
+          a.count + ' in ' + escapeHtml(a.window) +
+          '<span class="log-alert-rule">' + escapeHtml(last) + '</span>' +
+          (a.errors || []).map(e => '<span class="log-alert-err">' + escapeHtml(e) + '</span><br>').join('') + '</div>';
+      });
+      html += '<div class="log-menu-actions"><button class="btn" id="log-alert-save" type="button">＋ Alert on current filter…</button></div>';
+      menu.innerHTML = html;
+      menu.querySelectorAll('.log-view-del').forEach(el => {
+        el.addEventListener('click', () => deleteLogAlert(el.dataset.name));
+      });
+      menu.querySelector('#log-alert-save').addEventListener('click', saveLogAlert);
+    }
+
+    // saveLogAlert turns the filter box (substring) and, in the table view,
+    // the column filters (field~value) into an alert rule.
+    async function saveLogAlert() {
+      const rule = { pattern: logState.globalFilter.trim(), where: [], notify: true };
+      if (logState.jsonMode) {
+        const f = logState.colConfig.filters;
+        Object.keys(f).forEach(k => { if ((f[k] || '').trim()) rule.where.push(k + '~' + f[k].trim()); });
+      }
+      if (!rule.pattern && !rule.where.length) {
+        alert('Type a filter first (e.g. panic: or a level column filter); the alert fires on lines matching it.');
+        return;
+      }
+      const name = prompt('Alert name (applies to logs in this folder and subfolders):', rule.pattern || rule.where.join(' '));
+      if (!name || !name.trim()) return;
+      rule.name = name.trim();
+      const cond = prompt('Fire when this many lines match within the window (count in window):', '1 in 1m');
+      if (cond === null) return;
+      const m = cond.trim().match(/^(\d+)\s*(?:in|\/)\s*(\S+)$/);
+      if (!m) { alert('Expected e.g. "5 in 1m".'); return; }
+      rule.threshold = parseInt(m[1], 10);
+      rule.window = m[2];
+      try {
+        const resp = await fetch('/api/log/alerts/save?path=' + encodeURIComponent(logState.path), {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify(rule)
+        });
+        if (!resp.ok) throw new Error(await resp.text());
+        renderAlertsMenu();
+      } catch (e) {
+        alert('Failed to save alert: ' + e.message);
+      }
+    }
+
+    async function deleteLogAlert(name) {
+      if (!confirm('Delete alert "' + name + '"?')) return;
+      try {
+        const resp = await fetch('/api/log/alerts/delete?path=' + encodeURIComponent(logState.path), {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ name: name })
+        });
+        if (!resp.ok) throw new Error('failed');
+        renderAlertsMenu();
+      } catch (e) {
+        alert('Failed to delete alert.');
+      }
+    }
+
     function renderMarkdown(markdown) {
       // Custom renderer to rewrite relative image paths
       const renderer = new marked.Renderer();
@@ -3996,12 +5287,17 @@ const indexHTML = `<!DOCTYPE html>
         return '<img src="' + href + '" alt="' + (text || '') + '"' + titleAttr + ' />';
       };
 
-      // Generate heading IDs for TOC anchor links
+      // Generate heading IDs for TOC anchor links. Repeated headings get
+      // -1, -2, … suffixes, matching the anchors from /api/outline.
       const origHeading = renderer.heading.bind(renderer);
+      const slugCounts = {};
       renderer.heading = function({ text, depth }) {
         // Strip HTML tags to get raw text for slug
         const raw = text.replace(/<[^>]*>/g, '');
-        const slug = raw.toLowerCase().replace(/[^\w\s-]/g, '').replace(/\s+/g, '-').replace(/-+/g, '-').replace(/^-|-$/g, '');
+        const base = raw.toLowerCase().replace(/[^\w\s-]/g, '').replace(/\s+/g, '-').replace(/-+/g, '-').replace(/^-|-$/g, '');
+        const n = slugCounts[base] || 0;
+        slugCounts[base] = n + 1;
+        const slug = n ? base + '-' + n : base;
         return '<h' + depth + ' id="' + slug + '"><a class="anchor" href="#' + slug + '"></a>' + text + '</h' + depth + '>\n';
       };
 
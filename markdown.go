@@ -0,0 +1,290 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mdHeading is an ATX (# ...) or setext (underlined) heading.
+type mdHeading struct {
+	Level int
+	Text  string // heading text with inline markup stripped
+	Slug  string // anchor id, matching the ids the browser renderer assigns
+	Line  int    // 1-based line number
+}
+
+// mdLink is a link-like reference found in a markdown document. Start and
+// End are byte offsets of Target within the document so callers can rewrite
+// the destination in place.
+type mdLink struct {
+	Kind   string // "link", "image", "reference", "wikilink", "embed" or "html"
+	Target string // destination as written; for wikilinks the note name
+	Anchor string // wikilink heading fragment (without '#'); empty otherwise
+	Line   int    // 1-based line number
+	Start  int
+	End    int
+}
+
+// mdTask is a GFM task list item ("- [ ] ..." or "- [x] ...").
+type mdTask struct {
+	Line    int    // 1-based line number
+	Text    string // item text after the checkbox
+	Checked bool
+	Heading int // index into mdDocument.Headings of the enclosing heading, or -1
+	Box     int // byte offset of the checkbox state character within the document
+}
+
+// mdDocument is the result of scanning a markdown file.
+type mdDocument struct {
+	Headings []mdHeading
+	Links    []mdLink
+	Tasks    []mdTask
+}
+
+var (
+	atxHeadingRe    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextH1Re      = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2Re      = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	fenceRe         = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	listOrQuoteRe   = regexp.MustCompile(`^ {0,3}([-*+>]|\d+[.)])(\s|$)`)
+	taskItemRe      = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+)\[([ xX])\](?:\s+(.*?))?\s*$`)
+	inlineLinkRe    = regexp.MustCompile(`(!?)\[((?:[^\[\]\\]|\\.|\[[^\[\]]*\])*)\]\(\s*(<[^<>\n]*>|(?:[^\s()\\]|\\.|\([^\s()]*\))+)(?:\s+(?:"[^"]*"|'[^']*'|\([^()]*\)))?\s*\)`)
+	refDefRe        = regexp.MustCompile(`^ {0,3}\[([^\]^][^\]]*)\]:[ \t]*(<[^<>\n]*>|\S+)`)
+	wikiLinkRe      = regexp.MustCompile(`(!?)\[\[([^\[\]|#\n]*)(#[^\[\]|\n]*)?(?:\|[^\[\]\n]*)?\]\]`)
+	htmlLinkRe      = regexp.MustCompile(`(?i)<(?:img|a)\b[^>]*?\s(?:src|href)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	htmlTagRe       = regexp.MustCompile(`<[^>]*>`)
+	slugStripRe     = regexp.MustCompile(`[^\w\s-]`)
+	slugSpaceRe     = regexp.MustCompile(`\s+`)
+	slugDashRe      = regexp.MustCompile(`-+`)
+	inlineMarkupRe  = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	inlineWikiRe    = regexp.MustCompile(`\[\[(?:[^\]|]*\|)?([^\]]*)\]\]`)
+	inlineEmphasisR = strings.NewReplacer("**", "", "__", "", "~~", "", "`", "", "*", "")
+)
+
+// parseMarkdown scans a markdown document for headings, links and task
+// items. Front matter and fenced code blocks are skipped, and inline code
+// spans are ignored when looking for links.
+func parseMarkdown(content string) mdDocument {
+	var doc mdDocument
+	lines := strings.SplitAfter(content, "\n")
+
+	offset := 0
+	inFront := false
+	fence := ""
+	prevText := "" // previous line if it could be a setext heading's text
+	prevLine := 0
+	for i, raw := range lines {
+		lineNo := i + 1
+		lineStart := offset
+		offset += len(raw)
+		line := strings.TrimRight(raw, "\r\n")
+
+		if i == 0 && strings.TrimSpace(line) == "---" {
+			inFront = true
+			continue
+		}
+		if inFront {
+			if t := strings.TrimSpace(line); t == "---" || t == "..." {
+				inFront = false
+			}
+			continue
+		}
+
+		if fence != "" {
+			if m := fenceRe.FindStringSubmatch(line); m != nil && m[1][0] == fence[0] && len(m[1]) >= len(fence) && strings.TrimSpace(line[len(m[0]):]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			prevText = ""
+			continue
+		}
+
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil {
+			doc.Headings = append(doc.Headings, newHeading(len(m[1]), m[2], lineNo))
+			prevText = ""
+		} else if prevText != "" && (setextH1Re.MatchString(line) || setextH2Re.MatchString(line)) {
+			level := 2
+			if setextH1Re.MatchString(line) {
+				level = 1
+			}
+			doc.Headings = append(doc.Headings, newHeading(level, prevText, prevLine))
+			prevText = ""
+			continue
+		} else if strings.TrimSpace(line) == "" || listOrQuoteRe.MatchString(line) || strings.HasPrefix(strings.TrimSpace(line), "|") {
+			prevText = ""
+		} else {
+			prevText = strings.TrimSpace(line)
+			prevLine = lineNo
+		}
+
+		if m := taskItemRe.FindStringSubmatchIndex(line); m != nil {
+			text := ""
+			if m[6] >= 0 {
+				text = line[m[6]:m[7]]
+			}
+			doc.Tasks = append(doc.Tasks, mdTask{
+				Line:    lineNo,
+				Text:    text,
+				Checked: line[m[4]] != ' ',
+				Heading: len(doc.Headings) - 1,
+				Box:     lineStart + m[4],
+			})
+		}
+		doc.Links = append(doc.Links, scanLineLinks(maskCodeSpans(line), lineNo, lineStart)...)
+	}
+
+	// Repeated headings get -1, -2, … suffixes so every anchor is unique.
+	seen := make(map[string]int)
+	for i := range doc.Headings {
+		base := doc.Headings[i].Slug
+		if n := seen[base]; n > 0 {
+			doc.Headings[i].Slug = base + "-" + strconv.Itoa(n)
+		}
+		seen[base]++
+	}
+	return doc
+}
+
+func newHeading(level int, raw string, line int) mdHeading {
+	return mdHeading{Level: level, Text: mdInlineText(raw), Slug: headingSlug(raw), Line: line}
+}
+
+// scanLineLinks extracts the links on a single line. base is the byte offset
+// of the line within the document.
+func scanLineLinks(line string, lineNo, base int) []mdLink {
+	var links []mdLink
+	for _, m := range wikiLinkRe.FindAllStringSubmatchIndex(line, -1) {
+		kind := "wikilink"
+		if m[3] > m[2] {
+			kind = "embed"
+		}
+		anchor := ""
+		if m[6] >= 0 {
+			anchor = line[m[6]+1 : m[7]]
+		}
+		links = append(links, mdLink{
+			Kind: kind, Target: strings.TrimSpace(line[m[4]:m[5]]), Anchor: anchor,
+			Line: lineNo, Start: base + m[4], End: base + m[5],
+		})
+	}
+	for _, m := range inlineLinkRe.FindAllStringSubmatchIndex(line, -1) {
+		kind := "link"
+		if m[3] > m[2] {
+			kind = "image"
+		}
+		links = append(links, mdLink{Kind: kind, Target: line[m[6]:m[7]], Line: lineNo, Start: base + m[6], End: base + m[7]})
+	}
+	if m := refDefRe.FindStringSubmatchIndex(line); m != nil {
+		links = append(links, mdLink{Kind: "reference", Target: line[m[4]:m[5]], Line: lineNo, Start: base + m[4], End: base + m[5]})
+	}
+	for _, m := range htmlLinkRe.FindAllStringSubmatchIndex(line, -1) {
+		s, e := m[2], m[3]
+		if s < 0 {
+			s, e = m[4], m[5]
+		}
+		links = append(links, mdLink{Kind: "html", Target: line[s:e], Line: lineNo, Start: base + s, End: base + e})
+	}
+	return links
+}
+
+// maskCodeSpans replaces the contents of inline code spans with spaces so
+// that link-like text inside them is ignored. Byte offsets are preserved.
+func maskCodeSpans(line string) string {
+	if !strings.Contains(line, "`") {
+		return line
+	}
+	b := []byte(line)
+	for i := 0; i < len(b); {
+		if b[i] != '`' {
+			i++
+			continue
+		}
+		n := 0
+		for i+n < len(b) && b[i+n] == '`' {
+			n++
+		}
+		closeAt := -1
+		for j := i + n; j < len(b); {
+			if b[j] != '`' {
+				j++
+				continue
+			}
+			m := 0
+			for j+m < len(b) && b[j+m] == '`' {
+				m++
+			}
+			if m == n {
+				closeAt = j
+				break
+			}
+			j += m
+		}
+		if closeAt < 0 {
+			i += n
+			continue
+		}
+		for k := i; k < closeAt+n; k++ {
+			b[k] = ' '
+		}
+		i = closeAt + n
+	}
+	return string(b)
+}
+
+// headingSlug derives the anchor id for a heading from its raw markdown
+// text. It mirrors the heading renderer in indexHTML so that anchors
+// computed on the server agree with the ids in the rendered page; the
+// renderer also applies the same -1, -2 suffixes to repeated headings.
+func headingSlug(raw string) string {
+	s := htmlTagRe.ReplaceAllString(raw, "")
+	s = strings.ToLower(s)
+	s = slugStripRe.ReplaceAllString(s, "")
+	s = slugSpaceRe.ReplaceAllString(s, "-")
+	s = slugDashRe.ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
+
+// mdInlineText strips common inline markup (links, emphasis, code, HTML)
+// from a line of markdown, leaving readable text.
+func mdInlineText(raw string) string {
+	s := inlineMarkupRe.ReplaceAllString(raw, "$1")
+	s = inlineWikiRe.ReplaceAllString(s, "$1")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	s = inlineEmphasisR.Replace(s)
+	return strings.TrimSpace(s)
+}
+
+// walkMarkdownFiles calls fn for every markdown file under root with its
+// slash-separated path relative to root. Unreadable entries are skipped.
+func walkMarkdownFiles(root string, fn func(rel, fullPath string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() || !isMarkdownFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		return fn(filepath.ToSlash(rel), path)
+	})
+}
+
+// readMarkdownDocument reads and parses a markdown file.
+func readMarkdownDocument(fullPath string) (string, mdDocument, error) {
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", mdDocument{}, err
+	}
+	text := string(content)
+	return text, parseMarkdown(text), nil
+}
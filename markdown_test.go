@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHeadingSlug(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Getting Started", "getting-started"},
+		{"  API  v2 -- notes ", "api-v2-notes"},
+		{"What's new?", "whats-new"},
+		{"<code>run</code> options", "run-options"},
+		{"snake_case stays", "snake_case-stays"},
+		{"Ünïcode Wörds", "ncode-wrds"}, // \w is ASCII-only, as in the renderer
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := headingSlug(tt.in); got != tt.want {
+			t.Errorf("headingSlug(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMarkdownHeadings(t *testing.T) {
+	content := "---\ntitle: x\n---\n# Intro\n\n```\n# not a heading\n```\nSetup\n-----\n## Intro\n### Intro ###\n"
+	var got []mdHeading
+	for _, h := range parseMarkdown(content).Headings {
+		got = append(got, mdHeading{Level: h.Level, Text: h.Text, Slug: h.Slug, Line: h.Line})
+	}
+	want := []mdHeading{
+		{Level: 1, Text: "Intro", Slug: "intro", Line: 4},
+		{Level: 2, Text: "Setup", Slug: "setup", Line: 9},
+		{Level: 2, Text: "Intro", Slug: "intro-1", Line: 11},
+		{Level: 3, Text: "Intro", Slug: "intro-2", Line: 12},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headings = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMarkdownLinkOffsets(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		kind   string
+		target string
+		anchor string
+		line   int
+	}{
+		{"inline", "see [docs](guide.md) here", "link", "guide.md", "", 1},
+		{"image", "![logo](img/logo.png \"Logo\")", "image", "img/logo.png", "", 1},
+		{"angle brackets", "[a](<my file.md>)", "link", "<my file.md>", "", 1},
+		{"reference", "intro\n\n[ref]: ../other.md#top", "reference", "../other.md#top", "", 3},
+		{"wikilink with anchor", "x [[Some Note#Part|alias]]", "wikilink", "Some Note", "Part", 1},
+		{"embed", "![[diagram.png]]", "embed", "diagram.png", "", 1},
+		{"html", `<img alt="" src='pic.jpg'>`, "html", "pic.jpg", "", 1},
+		{"after multibyte text", "héllo wörld [x](ä.md)", "link", "ä.md", "", 1},
+		{"after front matter", "---\nk: v\n---\n[x](a.md)", "link", "a.md", "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := parseMarkdown(tt.in).Links
+			if len(links) != 1 {
+				t.Fatalf("parseMarkdown(%q) found %d links, want 1", tt.in, len(links))
+			}
+			l := links[0]
+			if l.Kind != tt.kind || l.Target != tt.target || l.Anchor != tt.anchor || l.Line != tt.line {
+				t.Errorf("link = %+v, want kind %q target %q anchor %q line %d", l, tt.kind, tt.target, tt.anchor, tt.line)
+			}
+			if got := tt.in[l.Start:l.End]; got != tt.target {
+				t.Errorf("content[%d:%d] = %q, want %q", l.Start, l.End, got, tt.target)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownSkipsCode(t *testing.T) {
+	content := "`[a](x.md)` and [b](y.md)\n```\n[c](z.md)\n```\n    "
+	links := parseMarkdown(content).Links
+	if len(links) != 1 || links[0].Target != "y.md" {
+		t.Errorf("links = %+v, want only y.md", links)
+	}
+}
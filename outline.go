@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// outlineNode is a heading and the section it introduces. A section runs
+// from the heading line to the line before the next heading of the same or
+// a higher level. Words counts the section's own text; TotalWords includes
+// its subsections.
+type outlineNode struct {
+	ID         string         `json:"id"`
+	Text       string         `json:"text"`
+	Level      int            `json:"level"`
+	Line       int            `json:"line"`
+	EndLine    int            `json:"endLine"`
+	Words      int            `json:"words"`
+	TotalWords int            `json:"totalWords"`
+	Children   []*outlineNode `json:"children"`
+}
+
+// sectionEnd returns the last line (1-based, inclusive) of the section
+// introduced by doc.Headings[i] in a document of totalLines lines.
+func sectionEnd(doc mdDocument, i, totalLines int) int {
+	for _, h := range doc.Headings[i+1:] {
+		if h.Level <= doc.Headings[i].Level {
+			return h.Line - 1
+		}
+	}
+	return totalLines
+}
+
+// findHeading returns the index of the heading with the given anchor id, or
+// -1 if the document has no such heading.
+func findHeading(doc mdDocument, anchor string) int {
+	anchor = strings.TrimPrefix(anchor, "#")
+	for i, h := range doc.Headings {
+		if h.Slug == anchor {
+			return i
+		}
+	}
+	return -1
+}
+
+// countWords counts whitespace-separated words that contain at least one
+// letter or digit, so markup such as "---" or "|" is not counted.
+func countWords(s string) int {
+	n := 0
+	for _, f := range strings.Fields(s) {
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// markdownLines splits content into lines without their terminators. A
+// trailing newline does not produce an extra empty line.
+func markdownLines(content string) []string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// buildOutline turns the headings of a document into a tree with section
+// ranges and word counts. It also returns the number of words before the
+// first heading.
+func buildOutline(content string, doc mdDocument) ([]*outlineNode, int) {
+	lines := markdownLines(content)
+	// Words on each line, with heading lines zeroed. Setext underlines have
+	// no words to count.
+	words := make([]int, len(lines)+1)
+	for i, l := range lines {
+		words[i+1] = countWords(l)
+	}
+	for _, h := range doc.Headings {
+		words[h.Line] = 0
+	}
+	sum := func(from, to int) int {
+		n := 0
+		for l := from; l <= to && l < len(words); l++ {
+			n += words[l]
+		}
+		return n
+	}
+
+	roots := []*outlineNode{}
+	var stack []*outlineNode
+	for i, h := range doc.Headings {
+		end := sectionEnd(doc, i, len(lines))
+		ownEnd := end
+		if i+1 < len(doc.Headings) && doc.Headings[i+1].Line-1 < ownEnd {
+			ownEnd = doc.Headings[i+1].Line - 1
+		}
+		node := &outlineNode{
+			ID:         h.Slug,
+			Text:       h.Text,
+			Level:      h.Level,
+			Line:       h.Line,
+			EndLine:    end,
+			Words:      sum(h.Line+1, ownEnd),
+			TotalWords: sum(h.Line+1, end),
+			Children:   []*outlineNode{},
+		}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, node)
+	}
+
+	preamble := len(lines)
+	if len(doc.Headings) > 0 {
+		preamble = doc.Headings[0].Line - 1
+	}
+	return roots, sum(1, preamble)
+}
+
+// handleOutline returns the heading tree of a markdown file. Heading ids are
+// the same anchors used by the rendered page, /api/search and the link
+// checker.
+func (a *app) handleOutline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	relPath, err := sanitizeRelativePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isMarkdownFile(relPath) {
+		http.Error(w, "only markdown files are supported", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	content, doc, err := readMarkdownDocument(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	headings, preamble := buildOutline(content, a.redact.redactHeadings(content, doc))
+	words := preamble
+	for _, h := range headings {
+		words += h.TotalWords
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path          string         `json:"path"`
+		Lines         int            `json:"lines"`
+		Words         int            `json:"words"`
+		PreambleWords int            `json:"preambleWords"`
+		Headings      []*outlineNode `json:"headings"`
+	}{
+		Path:          relPath,
+		Lines:         len(markdownLines(content)),
+		Words:         words,
+		PreambleWords: preamble,
+		Headings:      headings,
+	})
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSyslogMessage bounds one syslog message; longer ones are cut.
+	maxSyslogMessage = 64 << 10
+	// maxOTLPBody bounds one OTLP/HTTP export request (after decompression).
+	maxOTLPBody = 16 << 20
+	// maxReceivedServices bounds the service logs in the receive folder;
+	// records of further services go to unknown.jsonl.
+	maxReceivedServices = 200
+)
+
+// receivedRecord is one record written by the receivers as a line of
+// NDJSON. The common keys come first, in the same order for every source,
+// so the JSON table shows time, level, service and message up front; the
+// source-specific fields follow in key order.
+type receivedRecord struct {
+	Time    string         `json:"time"`
+	Level   string         `json:"level,omitempty"`
+	Service string         `json:"service"`
+	Host    string         `json:"host,omitempty"`
+	Msg     string         `json:"msg"`
+	Fields  map[string]any `json:"-"`
+}
+
+func (r receivedRecord) MarshalJSON() ([]byte, error) {
+	type base receivedRecord
+	b, err := json.Marshal(base(r))
+	if err != nil || len(r.Fields) == 0 {
+		return b, err
+	}
+	keys := make([]string, 0, len(r.Fields))
+	for k := range r.Fields {
+		switch k {
+		case "time", "level", "service", "host", "msg":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBuffer(b[:len(b)-1])
+	for _, k := range keys {
+		kb, _ := json.Marshal(k)
+		vb, err := json.Marshal(r.Fields[k])
+		if err != nil {
+			continue
+		}
+		buf.WriteByte(',')
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// serviceFileRe matches the characters kept in a service's file name.
+var serviceFileRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// serviceLogName turns a service name into the file receiving its records.
+func serviceLogName(service string) string {
+	name := strings.TrimLeft(serviceFileRe.ReplaceAllString(service, "_"), "._")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return name + ".jsonl"
+}
+
+// receivedServices counts the service logs in the receive folder.
+func (a *app) receivedServices() int {
+	entries, _ := os.ReadDir(a.received)
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+			n++
+		}
+	}
+	return n
+}
+
+// writeReceived appends records to the NDJSON file of each record's service
+// in the receive folder, one append per file. It shares the per-log locks
+// of /api/log/append. Senders are not trusted to stay small: past
+// maxReceivedServices new services share unknown.jsonl, and a log that
+// reached -receive-max-size drops further records until it is rotated.
+func (a *app) writeReceived(recs []receivedRecord) error {
+	byFile := make(map[string][]byte)
+	var order []string
+	services := -1 // counted on the first new service
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		name := serviceLogName(rec.Service)
+		if _, ok := byFile[name]; !ok {
+			if _, err := os.Stat(filepath.Join(a.received, name)); errors.Is(err, os.ErrNotExist) {
+				if services < 0 {
+					services = a.receivedServices()
+				}
+				if services >= maxReceivedServices {
+					name = serviceLogName("")
+				} else {
+					services++
+				}
+			}
+		}
+		if _, ok := byFile[name]; !ok {
+			order = append(order, name)
+		}
+		byFile[name] = append(append(byFile[name], line...), '\n')
+	}
+	if err := os.MkdirAll(a.received, 0755); err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range order {
+		full := filepath.Join(a.received, name)
+		lock := a.ingest.lock(full)
+		lock.Lock()
+		if a.receivedMax > 0 {
+			if info, err := os.Stat(full); err == nil && info.Size()+int64(len(byFile[name])) > a.receivedMax {
+				lock.Unlock()
+				if _, reported := a.receivedFull.LoadOrStore(full, true); !reported {
+					log.Printf("[receive] %s reached -receive-max-size; dropping records until it is rotated", name)
+				}
+				continue
+			}
+			a.receivedFull.Delete(full)
+		}
+		f, err := os.OpenFile(full, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err == nil {
+			_, err = f.Write(byFile[name])
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		lock.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// --- Syslog ---
+
+var (
+	syslogFacilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+	syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+	// syslogSDParamRe matches a param of an RFC 5424 structured data element.
+	syslogSDParamRe = regexp.MustCompile(`([^\s=\]"]+)="((?:[^"\\]|\\.)*)"`)
+	// syslogTagRe splits an RFC 3164 message into tag, optional pid and text.
+	syslogTagRe = regexp.MustCompile(`^([^\s:\[]{1,48})(?:\[([^\]]*)\])?:\s?`)
+)
+
+// syslogNil returns "" for the RFC 5424 nil value "-".
+func syslogNil(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// parseSyslog parses an RFC 5424 or RFC 3164 message. Messages in neither
+// format are kept whole as the message text. from is the sender's address,
+// used as the host when the message names none.
+func parseSyslog(msg []byte, from string, now time.Time) receivedRecord {
+	s := strings.TrimRight(string(msg), "\r\n\x00")
+	rec := receivedRecord{Fields: map[string]any{"source": "syslog"}}
+	if i := strings.IndexByte(s, '>'); strings.HasPrefix(s, "<") && i > 1 && i <= 4 {
+		if pri, err := strconv.Atoi(s[1:i]); err == nil && pri < len(syslogFacilities)*8 {
+			sev := syslogSeverities[pri%8]
+			rec.Level = normalizeLogLevel(sev)
+			rec.Fields["severity"] = sev
+			rec.Fields["facility"] = syslogFacilities[pri/8]
+			s = s[i+1:]
+		}
+	}
+
+	if strings.HasPrefix(s, "1 ") {
+		// RFC 5424: VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+		parts := strings.SplitN(s, " ", 7)
+		if len(parts) == 7 {
+			if t, err := time.Parse(time.RFC3339Nano, parts[1]); err == nil {
+				rec.Time = t.Format(time.RFC3339Nano)
+			}
+			rec.Host = syslogNil(parts[2])
+			rec.Service = syslogNil(parts[3])
+			if pid := syslogNil(parts[4]); pid != "" {
+				rec.Fields["pid"] = pid
+			}
+			if id := syslogNil(parts[5]); id != "" {
+				rec.Fields["msgid"] = id
+			}
+			rest := parts[6]
+			if strings.HasPrefix(rest, "-") {
+				rest = rest[1:]
+			} else {
+				sd := map[string]map[string]string{}
+				for strings.HasPrefix(rest, "[") {
+					end := sdElementEnd(rest)
+					elem := rest[1:end]
+					id, params, _ := strings.Cut(elem, " ")
+					kv := map[string]string{}
+					for _, m := range syslogSDParamRe.FindAllStringSubmatch(params, -1) {
+						kv[m[1]] = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`).Replace(m[2])
+					}
+					sd[id] = kv
+					rest = rest[min(end+1, len(rest)):]
+				}
+				if len(sd) > 0 {
+					rec.Fields["sd"] = sd
+				}
+			}
+			rec.Msg = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+		} else {
+			rec.Msg = s
+		}
+	} else {
+		// RFC 3164: Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+		if len(s) >= 16 && s[15] == ' ' {
+			if t, err := time.ParseInLocation(time.Stamp, s[:15], now.Location()); err == nil {
+				t = t.AddDate(now.Year(), 0, 0)
+				if t.After(now.Add(24 * time.Hour)) {
+					t = t.AddDate(-1, 0, 0) // December's messages read in January
+				}
+				rec.Time = t.Format(time.RFC3339Nano)
+				s = s[16:]
+				if host, rest, ok := strings.Cut(s, " "); ok {
+					rec.Host, s = host, rest
+				}
+			}
+		}
+		if m := syslogTagRe.FindStringSubmatch(s); m != nil {
+			rec.Service = m[1]
+			if m[2] != "" {
+				rec.Fields["pid"] = m[2]
+			}
+			s = s[len(m[0]):]
+		}
+		rec.Msg = s
+	}
+
+	if rec.Time == "" {
+		rec.Time = now.Format(time.RFC3339Nano)
+	}
+	if rec.Host == "" {
+		rec.Host = from
+	}
+	if rec.Service == "" {
+		rec.Service = "syslog"
+	}
+	return rec
+}
+
+// sdElementEnd returns the index of the "]" closing the structured data
+// element at the start of s, skipping escaped brackets inside values.
+func sdElementEnd(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case ']':
+			if !inQuote {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// senderHost returns the host part of a network address.
+func senderHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// serveSyslogUDP receives one syslog message per datagram.
+func (a *app) serveSyslogUDP(pc net.PacketConn) {
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[syslog] udp: %v", err)
+			continue
+		}
+		rec := parseSyslog(buf[:n], senderHost(from), time.Now())
+		if err := a.writeReceived([]receivedRecord{rec}); err != nil {
+			log.Printf("[syslog] write: %v", err)
+		}
+	}
+}
+
+// serveSyslogTCP accepts syslog connections, framed by octet counting
+// (RFC 6587) or by newlines.
+func (a *app) serveSyslogTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[syslog] tcp: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go a.handleSyslogConn(conn)
+	}
+}
+
+func (a *app) handleSyslogConn(conn net.Conn) {
+	defer conn.Close()
+	from := senderHost(conn.RemoteAddr())
+	r := bufio.NewReaderSize(conn, maxSyslogMessage)
+	for {
+		msg, err := readSyslogFrame(r)
+		if len(bytes.TrimSpace(msg)) > 0 {
+			if werr := a.writeReceived([]receivedRecord{parseSyslog(msg, from, time.Now())}); werr != nil {
+				log.Printf("[syslog] write: %v", werr)
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[syslog] %s: %v", from, err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads one message from a TCP stream. A frame starting
+// with a digit is octet-counted ("<len> <msg>"); otherwise it runs to the
+// next newline.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '0' && first[0] <= '9' {
+		head, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(head))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid frame length %q", head)
+		}
+		msg := make([]byte, min(n, maxSyslogMessage))
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return nil, err
+		}
+		if n > len(msg) {
+			if _, err := r.Discard(n - len(msg)); err != nil {
+				return msg, err
+			}
+		}
+		return msg, nil
+	}
+	var msg []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		if len(msg) < maxSyslogMessage {
+			msg = append(msg, part[:min(len(part), maxSyslogMessage-len(msg))]...)
+		}
+		if err != bufio.ErrBufferFull {
+			return msg, err
+		}
+	}
+}
+
+// --- OTLP/HTTP JSON logs ---
+
+// otlpInt is an OTLP JSON integer, which encoders send as a number or, for
+// 64-bit values, a decimal string.
+type otlpInt int64
+
+func (n *otlpInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = otlpInt(v)
+	return nil
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	IntValue    *otlpInt `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+	BytesValue  *string  `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []otlpAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// value converts an OTLP AnyValue to its plain JSON counterpart.
+func (v otlpAnyValue) value() any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		out := make([]any, len(v.ArrayValue.Values))
+		for i, e := range v.ArrayValue.Values {
+			out[i] = e.value()
+		}
+		return out
+	case v.KvlistValue != nil:
+		return otlpAttributes(v.KvlistValue.Values)
+	}
+	return nil
+}
+
+func otlpAttributes(kvs []otlpKeyValue) map[string]any {
+	out := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		out[kv.Key] = kv.Value.value()
+	}
+	return out
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano         otlpInt        `json:"timeUnixNano"`
+				ObservedTimeUnixNano otlpInt        `json:"observedTimeUnixNano"`
+				SeverityNumber       int            `json:"severityNumber"`
+				SeverityText         string         `json:"severityText"`
+				Body                 otlpAnyValue   `json:"body"`
+				Attributes           []otlpKeyValue `json:"attributes"`
+				TraceID              string         `json:"traceId"`
+				SpanID               string         `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+// otlpSeverityLevel maps an OTLP severity number onto the viewer's levels.
+func otlpSeverityLevel(n int) string {
+	switch {
+	case n <= 0:
+		return ""
+	case n <= 4:
+		return "trace"
+	case n <= 8:
+		return "debug"
+	case n <= 12:
+		return "info"
+	case n <= 16:
+		return "warn"
+	case n <= 20:
+		return "error"
+	}
+	return "fatal"
+}
+
+// otlpRecords flattens an export request into records. The service comes
+// from the service.name resource attribute; log attributes become top-level
+// fields (prefixed with "attr." when they clash with the common keys) and
+// the remaining resource attributes are kept under "resource".
+func otlpRecords(req otlpLogsRequest, now time.Time) []receivedRecord {
+	var recs []receivedRecord
+	for _, rl := range req.ResourceLogs {
+		resource := otlpAttributes(rl.Resource.Attributes)
+		service, _ := resource["service.name"].(string)
+		host, _ := resource["host.name"].(string)
+		delete(resource, "service.name")
+		delete(resource, "host.name")
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				rec := receivedRecord{Service: service, Host: host, Fields: map[string]any{"source": "otlp"}}
+				ts := lr.TimeUnixNano
+				if ts == 0 {
+					ts = lr.ObservedTimeUnixNano
+				}
+				if ts > 0 {
+					rec.Time = time.Unix(0, int64(ts)).UTC().Format(time.RFC3339Nano)
+				} else {
+					rec.Time = now.UTC().Format(time.RFC3339Nano)
+				}
+				rec.Level = otlpSeverityLevel(lr.SeverityNumber)
+				if lr.SeverityText != "" {
+					if rec.Level == "" {
+						if rec.Level = normalizeLogLevel(lr.SeverityText); rec.Level == "other" {
+							rec.Level = strings.ToLower(lr.SeverityText)
+						}
+					}
+					rec.Fields["severity"] = lr.SeverityText
+				}
+				switch body := lr.Body.value().(type) {
+				case nil:
+				case string:
+					rec.Msg = body
+				default:
+					b, _ := json.Marshal(body)
+					rec.Msg = string(b)
+				}
+				for k, v := range otlpAttributes(lr.Attributes) {
+					switch k {
+					case "time", "level", "service", "host", "msg", "source", "severity", "resource", "scope", "trace_id", "span_id":
+						k = "attr." + k
+					}
+					rec.Fields[k] = v
+				}
+				if lr.TraceID != "" {
+					rec.Fields["trace_id"] = strings.ToLower(lr.TraceID)
+				}
+				if lr.SpanID != "" {
+					rec.Fields["span_id"] = strings.ToLower(lr.SpanID)
+				}
+				if sl.Scope.Name != "" {
+					rec.Fields["scope"] = sl.Scope.Name
+				}
+				if len(resource) > 0 {
+					rec.Fields["resource"] = resource
+				}
+				if rec.Service == "" {
+					rec.Service = "otlp"
+				}
+				recs = append(recs, rec)
+			}
+		}
+	}
+	return recs
+}
+
+// handleOTLPLogs implements the OTLP/HTTP logs endpoint (POST /v1/logs)
+// for the JSON encoding, optionally gzip-compressed. Protobuf payloads are
+// refused; configure exporters with the http/json protocol. With
+// -ingest-token, exporters must send it like /api/log/append clients.
+func (a *app) handleOTLPLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.ingest.token != "" && !a.ingest.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		http.Error(w, "only OTLP/HTTP JSON (application/json) is supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxOTLPBody)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, maxOTLPBody)
+	}
+	var req otlpLogsRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := a.writeReceived(otlpRecords(req, time.Now())); err != nil {
+		log.Printf("[otlp] write: %v", err)
+		http.Error(w, "failed to write logs", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+// startReceivers binds the configured receivers and serves them in the
+// background. Binding errors are returned so mdviewer fails at startup
+// rather than silently dropping logs.
+func (a *app) startReceivers(syslogAddr, otlpAddr string) error {
+	if syslogAddr != "" {
+		pc, err := net.ListenPacket("udp", syslogAddr)
+		if err != nil {
+			return fmt.Errorf("syslog udp: %w", err)
+		}
+		ln, err := net.Listen("tcp", syslogAddr)
+		if err != nil {
+			pc.Close()
+			return fmt.Errorf("syslog tcp: %w", err)
+		}
+		go a.serveSyslogUDP(pc)
+		go a.serveSyslogTCP(ln)
+		log.Printf("[syslog] receiving on udp and tcp %s into %s", syslogAddr, a.received)
+	}
+	if otlpAddr != "" {
+		ln, err := net.Listen("tcp", otlpAddr)
+		if err != nil {
+			return fmt.Errorf("otlp: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/logs", a.handleOTLPLogs)
+		go func() {
+			if err := http.Serve(ln, mux); err != nil {
+				log.Printf("[otlp] %v", err)
+			}
+		}()
+		log.Printf("[otlp] receiving OTLP/HTTP JSON logs on http://%s/v1/logs into %s", otlpAddr, a.received)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		in     string
+		want   receivedRecord
+		fields map[string]any
+	}{
+		{
+			name: "rfc 5424 with structured data",
+			in:   `<165>1 2003-10-11T22:14:15.003Z mymachine evntslog 42 ID47 [exampleSDID@32473 iut="3" eventSource="App\]x"] An application event` + "\n",
+			want: receivedRecord{Time: "2003-10-11T22:14:15.003Z", Level: "info", Service: "evntslog", Host: "mymachine", Msg: "An application event"},
+			fields: map[string]any{
+				"source": "syslog", "severity": "notice", "facility": "local4", "pid": "42", "msgid": "ID47",
+				"sd": map[string]map[string]string{"exampleSDID@32473": {"iut": "3", "eventSource": "App]x"}},
+			},
+		},
+		{
+			name:   "rfc 5424 nil values",
+			in:     "<11>1 - - - - - - disk full",
+			want:   receivedRecord{Time: now.Format(time.RFC3339Nano), Level: "error", Service: "syslog", Host: "10.0.0.1", Msg: "disk full"},
+			fields: map[string]any{"source": "syslog", "severity": "err", "facility": "user"},
+		},
+		{
+			name:   "rfc 3164",
+			in:     "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+			want:   receivedRecord{Time: "2026-10-11T22:14:15Z", Level: "fatal", Service: "su", Host: "mymachine", Msg: "'su root' failed"},
+			fields: map[string]any{"source": "syslog", "severity": "crit", "facility": "auth", "pid": "123"},
+		},
+		{
+			name:   "rfc 3164 from last year",
+			in:     "<13>Dec 31 23:59:59 host cron: tick",
+			want:   receivedRecord{Time: "2025-12-31T23:59:59Z", Level: "info", Service: "cron", Host: "host", Msg: "tick"},
+			fields: map[string]any{"source": "syslog", "severity": "notice", "facility": "user"},
+		},
+		{
+			name:   "unstructured",
+			in:     "just text\r\n",
+			want:   receivedRecord{Time: now.Format(time.RFC3339Nano), Service: "syslog", Host: "10.0.0.1", Msg: "just text"},
+			fields: map[string]any{"source": "syslog"},
+		},
+		{
+			name:   "priority out of range",
+			in:     "<999>hello",
+			want:   receivedRecord{Time: now.Format(time.RFC3339Nano), Service: "syslog", Host: "10.0.0.1", Msg: "<999>hello"},
+			fields: map[string]any{"source": "syslog"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSyslog([]byte(tt.in), "10.0.0.1", now)
+			fields := got.Fields
+			got.Fields = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSyslog(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	long := strings.Repeat("x", maxSyslogMessage+10)
+	tests := []struct {
+		name string
+		in   string
+		want []string
+		err  bool // whether the stream ends with an error other than io.EOF
+	}{
+		{"newline delimited", "<13>one\n<13>two\n", []string{"<13>one\n", "<13>two\n"}, false},
+		{"octet counted", "7 <13>one8 <13>two\n", []string{"<13>one", "<13>two\n"}, false},
+		{"mixed", "4 abcd<13>tail\n", []string{"abcd", "<13>tail\n"}, false},
+		{"last line without newline", "<13>one", []string{"<13>one"}, false},
+		{"long line is cut", long + "\nnext\n", []string{long[:maxSyslogMessage], "next\n"}, false},
+		{"long frame is cut", "65546 " + long + "next\n", []string{long[:maxSyslogMessage], "next\n"}, false},
+		{"bad length", "12x abc", nil, true},
+		{"short frame", "10 abc", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.in), 4096)
+			var got []string
+			var err error
+			for {
+				var msg []byte
+				msg, err = readSyslogFrame(r)
+				if len(msg) > 0 {
+					got = append(got, string(msg))
+				}
+				if err != nil {
+					break
+				}
+			}
+			if (err != io.EOF) != tt.err {
+				t.Errorf("error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTLPRecords(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	body := `{"resourceLogs":[{
+		"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"checkout"}},
+			{"key":"host.name","value":{"stringValue":"web-1"}},
+			{"key":"deployment.environment","value":{"stringValue":"prod"}}]},
+		"scopeLogs":[{"scope":{"name":"app.http"},"logRecords":[
+			{"timeUnixNano":"1700000000000000000","severityNumber":17,"severityText":"ERROR",
+			 "body":{"stringValue":"payment failed"},
+			 "attributes":[
+				{"key":"order","value":{"intValue":"42"}},
+				{"key":"level","value":{"stringValue":"shadowed"}},
+				{"key":"tags","value":{"arrayValue":{"values":[{"stringValue":"a"},{"boolValue":true}]}}}],
+			 "traceId":"ABCDEF","spanId":"0123"},
+			{"observedTimeUnixNano":1700000001000000000,"severityText":"Notice",
+			 "body":{"kvlistValue":{"values":[{"key":"k","value":{"doubleValue":1.5}}]}}}]}]},
+		{"scopeLogs":[{"logRecords":[{"severityText":"Verbose"}]}]}]}`
+	var req otlpLogsRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	recs := otlpRecords(req, now)
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	resource := map[string]any{"deployment.environment": "prod"}
+	tests := []struct {
+		want   receivedRecord
+		fields map[string]any
+	}{
+		{
+			receivedRecord{Time: "2023-11-14T22:13:20Z", Level: "error", Service: "checkout", Host: "web-1", Msg: "payment failed"},
+			map[string]any{
+				"source": "otlp", "severity": "ERROR", "order": int64(42), "attr.level": "shadowed",
+				"tags": []any{"a", true}, "trace_id": "abcdef", "span_id": "0123", "scope": "app.http", "resource": resource,
+			},
+		},
+		{
+			receivedRecord{Time: "2023-11-14T22:13:21Z", Level: "info", Service: "checkout", Host: "web-1", Msg: `{"k":1.5}`},
+			map[string]any{"source": "otlp", "severity": "Notice", "scope": "app.http", "resource": resource},
+		},
+		{
+			receivedRecord{Time: now.Format(time.RFC3339Nano), Level: "verbose", Service: "otlp"},
+			map[string]any{"source": "otlp", "severity": "Verbose"},
+		},
+	}
+	for i, tt := range tests {
+		got := recs[i]
+		fields := got.Fields
+		got.Fields = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("record %d = %+v, want %+v", i, got, tt.want)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("record %d fields = %v, want %v", i, fields, tt.fields)
+		}
+	}
+}
+
+func TestReceivedRecordJSON(t *testing.T) {
+	rec := receivedRecord{Time: "t", Service: "s", Msg: "m", Fields: map[string]any{"z": 1, "a": "x", "msg": "dup"}}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"time":"t","service":"s","msg":"m","a":"x","z":1}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
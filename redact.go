@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// redactRule masks the matches of a regular expression in served content.
+// When the expression has a group named "secret", only that group is
+// masked, so "password=hunter2" keeps its key.
+type redactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+	group   int // index of the "secret" group; 0 masks the whole match
+}
+
+// builtinRedactRules are the detectors enabled by -redact.
+var builtinRedactRules = []redactRule{
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{4,}\.eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{4,}`},
+	{Name: "aws-access-key", Pattern: `\b(?:AKIA|ASIA|AIDA|AROA|AGPA|ANPA)[A-Z0-9]{16}\b`},
+	{Name: "aws-secret-key", Pattern: `(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`},
+	{Name: "authorization", Pattern: `(?i)\b(?:proxy-)?authorization["']?\s*[:=]\s*["']?(?:(?:bearer|basic|digest|token|apikey)\s+)?(?P<secret>[^\s"',;]+)`},
+	{Name: "bearer", Pattern: `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/=-]{8,})`},
+	{Name: "password", Pattern: `(?i)\b(?:password|passwd|pwd|client_?secret|api_?key|access_?token)["']?\s*[:=]\s*["']?(?P<secret>[^\s"'&,;]+)`},
+	{Name: "url-credentials", Pattern: `\b[a-z][a-z0-9+.-]*://[^/\s:@"']+:(?P<secret>[^/\s@"']+)@`},
+	// An unterminated key is masked to the end, as its END line may follow
+	// in the next chunk of a stream.
+	{Name: "private-key", Pattern: `(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(?:-----END [A-Z ]*PRIVATE KEY-----|\z)`},
+}
+
+// maxRedactCarry bounds the private key block carried from one stream chunk
+// to the next.
+const maxRedactCarry = 64 << 10
+
+var (
+	pemKeyBeginRe = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	pemKeyEndRe   = regexp.MustCompile(`-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// redactor masks secrets in log and markdown content before it is served.
+// Masks have the length of what they hide, so byte offsets and line numbers
+// in responses still match the file. A nil redactor leaves content alone.
+type redactor struct {
+	rules []redactRule
+}
+
+// newRedactor compiles the built-in rules (when builtins is set) and those
+// of rulesFile, a JSON array of {name, pattern}. It returns nil when no
+// rule applies.
+func newRedactor(builtins bool, rulesFile string) (*redactor, error) {
+	var rules []redactRule
+	if builtins {
+		rules = append(rules, builtinRedactRules...)
+	}
+	if rulesFile != "" {
+		content, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		var custom []redactRule
+		if err := json.Unmarshal(content, &custom); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", rulesFile, err)
+		}
+		rules = append(rules, custom...)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %d: pattern is empty", i+1)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %q: %w", rule.Name, err)
+		}
+		rule.re = re
+		if g := re.SubexpIndex("secret"); g > 0 {
+			rule.group = g
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return &redactor{rules: rules}, nil
+}
+
+// errRedacted rejects writes of content that was served masked.
+var errRedacted = errors.New("the file contains redacted secrets; edit it outside mdviewer")
+
+// redact returns text with every match masked by '*'. Line breaks inside a
+// match are kept. text itself is never modified, and is returned as is
+// when nothing matched.
+//
+// Text with ANSI escapes is matched twice: once without the escapes, so
+// colour codes inside a secret ("Bearer \x1b[1mtoken") cannot hide it,
+// then as is. Only visible bytes are masked; escape sequences are kept so
+// the text still renders and strips the same way.
+func (rd *redactor) redact(text []byte) []byte {
+	if rd == nil || len(text) == 0 {
+		return text
+	}
+	out, copied := text, false
+	mask := func(i int) {
+		if out[i] == '\n' || out[i] == '\r' || out[i] == '*' {
+			return
+		}
+		if !copied {
+			out, copied = append([]byte(nil), text...), true
+		}
+		out[i] = '*'
+	}
+	if bytes.IndexByte(text, 0x1b) < 0 {
+		rd.apply(text, func(start, end int) {
+			for i := start; i < end; i++ {
+				mask(i)
+			}
+		})
+		return out
+	}
+
+	// pos maps each byte of the text without escapes to its index in out.
+	plain := make([]byte, 0, len(text))
+	pos := make([]int, 0, len(text))
+	visible := make([]bool, len(text))
+	for i := 0; i < len(text); {
+		if text[i] == 0x1b {
+			n, _, _ := ansiSequence(text[i:])
+			i += n
+			continue
+		}
+		plain = append(plain, text[i])
+		pos = append(pos, i)
+		visible[i] = true
+		i++
+	}
+	rd.apply(plain, func(start, end int) {
+		for j := start; j < end; j++ {
+			mask(pos[j])
+		}
+	})
+	rd.apply(text, func(start, end int) {
+		for i := start; i < end; i++ {
+			if visible[i] {
+				mask(i)
+			}
+		}
+	})
+	return out
+}
+
+// apply calls mask with the byte range to hide of every rule match in
+// text. Every rule sees the text unmasked.
+func (rd *redactor) apply(text []byte, mask func(start, end int)) {
+	for _, rule := range rd.rules {
+		for _, m := range rule.re.FindAllSubmatchIndex(text, -1) {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			if start < 0 || start == end {
+				continue
+			}
+			mask(start, end)
+		}
+	}
+}
+
+// redactChunk redacts the next chunk of a stream cut at line ends. carry is
+// what the previous call returned: a private key block still missing its
+// END line, matched again together with chunk so the key's remaining lines
+// are masked too.
+func (rd *redactor) redactChunk(carry, chunk []byte) (out, next []byte) {
+	if rd == nil {
+		return chunk, nil
+	}
+	text := chunk
+	if len(carry) > 0 {
+		text = append(append([]byte(nil), carry...), chunk...)
+	}
+	out = rd.redact(text)[len(carry):]
+	if locs := pemKeyBeginRe.FindAllIndex(text, -1); len(locs) > 0 {
+		begin := locs[len(locs)-1][0]
+		if !pemKeyEndRe.Match(text[begin:]) && len(text)-begin <= maxRedactCarry {
+			next = append([]byte(nil), text[begin:]...)
+		}
+	}
+	return out, next
+}
+
+// redactField masks secrets in the value of a field. The value is matched
+// as "key=value", so rules keyed on the field name (password,
+// authorization) apply as they do to the raw line.
+func (rd *redactor) redactField(key, value string) string {
+	if rd == nil || value == "" {
+		return value
+	}
+	return string(rd.redact([]byte(key + "=" + value))[len(key)+1:])
+}
+
+// redactRecord masks secrets in the string values of a parsed log record,
+// nested ones included, in place.
+func (rd *redactor) redactRecord(rec map[string]any) {
+	if rd == nil {
+		return
+	}
+	for k, v := range rec {
+		rec[k] = rd.redactValue(k, v)
+	}
+}
+
+func (rd *redactor) redactValue(key string, v any) any {
+	switch t := v.(type) {
+	case string:
+		return rd.redactField(key, t)
+	case map[string]any:
+		rd.redactRecord(t)
+	case []any:
+		for i, x := range t {
+			t[i] = rd.redactValue(key, x)
+		}
+	}
+	return v
+}
+
+// redactHeadings returns doc with its headings as the rendered page shows
+// them when content is masked: masked text, and anchors derived from the
+// masked heading lines with the usual suffixes for repeats, so an anchor
+// does not spell out a secret. Masks keep every line in place, so headings
+// are matched by line.
+func (rd *redactor) redactHeadings(content string, doc mdDocument) mdDocument {
+	if rd == nil {
+		return doc
+	}
+	masked := rd.redactString(content)
+	if masked == content {
+		return doc
+	}
+	slugs := make(map[int]string)
+	for _, h := range parseMarkdown(masked).Headings {
+		slugs[h.Line] = h.Slug
+	}
+	headings := make([]mdHeading, len(doc.Headings))
+	for i, h := range doc.Headings {
+		h.Text = rd.redactString(h.Text)
+		if s, ok := slugs[h.Line]; ok {
+			h.Slug = s
+		}
+		headings[i] = h
+	}
+	doc.Headings = headings
+	return doc
+}
+
+// redactString is redact for strings.
+func (rd *redactor) redactString(s string) string {
+	if rd == nil || s == "" {
+		return s
+	}
+	return string(rd.redact([]byte(s)))
+}
+
+// matches reports whether any rule would mask part of text.
+func (rd *redactor) matches(text []byte) bool {
+	return rd != nil && !bytes.Equal(rd.redact(text), text)
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRunHistory bounds the finished runs remembered in .runs.json.
+	maxRunHistory = 200
+	// runHistoryFile holds the run history inside the runs folder.
+	runHistoryFile = ".runs.json"
+	// runStopGrace is how long a cancelled run may take to exit after
+	// SIGTERM before it is killed.
+	runStopGrace = 10 * time.Second
+)
+
+// runNameRe restricts command names, which become part of log file names.
+var runNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// runCommand is an allowlisted command from the -runs file. Only these can
+// be started from the UI or API; the browser never supplies a command line.
+type runCommand struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Dir     string `json:"dir,omitempty"`     // working directory relative to -root
+	Timeout string `json:"timeout,omitempty"` // Go duration; none when empty
+	timeout time.Duration
+}
+
+// runRecord is one execution of a command.
+type runRecord struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	Log        string `json:"log"`    // path relative to root
+	Status     string `json:"status"` // running, ok, failed, canceled, timeout, interrupted
+	Started    string `json:"started"`
+	Finished   string `json:"finished,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	ExitCode   *int   `json:"exitCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// activeRun is a run whose process has not exited yet.
+type activeRun struct {
+	rec      *runRecord
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// runManager starts allowlisted commands, streams their output into log
+// files under the runs folder and keeps the run history.
+type runManager struct {
+	root     string
+	commands []runCommand
+	dir      string // runs folder, full path
+	relDir   string // runs folder, relative to root
+
+	mu      sync.Mutex
+	history []*runRecord // oldest first
+	active  map[int64]*activeRun
+	nextID  int64
+}
+
+// loadRunCommands reads the -runs file: a JSON array of commands.
+func loadRunCommands(root, file string) ([]runCommand, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cmds []runCommand
+	if err := json.Unmarshal(content, &cmds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	seen := make(map[string]bool)
+	for i := range cmds {
+		c := &cmds[i]
+		if !runNameRe.MatchString(c.Name) || seen[c.Name] {
+			return nil, fmt.Errorf("command %d: name must be unique and use only letters, digits, '.', '_' and '-'", i+1)
+		}
+		seen[c.Name] = true
+		if c.Command == "" {
+			return nil, fmt.Errorf("command %q: command is empty", c.Name)
+		}
+		if c.Dir != "" {
+			rel, err := sanitizeRelativePath(c.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("command %q: invalid dir", c.Name)
+			}
+			if _, err := secureJoin(root, rel); err != nil {
+				return nil, fmt.Errorf("command %q: invalid dir", c.Name)
+			}
+			c.Dir = rel
+		}
+		if c.Timeout != "" {
+			if c.timeout, err = time.ParseDuration(c.Timeout); err != nil || c.timeout <= 0 {
+				return nil, fmt.Errorf("command %q: invalid timeout", c.Name)
+			}
+		}
+	}
+	return cmds, nil
+}
+
+// newRunManager prepares the runs folder and loads the history. Runs left
+// "running" by a previous process are marked interrupted.
+func newRunManager(root, relDir string, commands []runCommand) (*runManager, error) {
+	dir, err := secureJoin(root, relDir)
+	if err != nil {
+		return nil, err
+	}
+	m := &runManager{root: root, commands: commands, dir: dir, relDir: relDir, active: make(map[int64]*activeRun)}
+	if content, err := os.ReadFile(filepath.Join(dir, runHistoryFile)); err == nil {
+		_ = json.Unmarshal(content, &m.history)
+	}
+	for _, rec := range m.history {
+		if rec.Status == "running" {
+			rec.Status = "interrupted"
+		}
+		m.nextID = max(m.nextID, rec.ID)
+	}
+	return m, nil
+}
+
+// saveHistory writes the history; the caller holds m.mu.
+func (m *runManager) saveHistory() {
+	if len(m.history) > maxRunHistory {
+		m.history = m.history[len(m.history)-maxRunHistory:]
+	}
+	content, err := json.MarshalIndent(m.history, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(m.dir, runHistoryFile), content, 0644)
+	}
+	if err != nil {
+		log.Printf("[runs] saving history: %v", err)
+	}
+}
+
+var errRunActive = errors.New("command is already running")
+
+// start launches the named command. Its stdout and stderr go to a new log
+// named after the command and start time, framed by a header and a footer
+// line carrying the exit status and duration.
+func (m *runManager) start(name string) (runRecord, error) {
+	var cmdDef *runCommand
+	for i := range m.commands {
+		if m.commands[i].Name == name {
+			cmdDef = &m.commands[i]
+		}
+	}
+	if cmdDef == nil {
+		return runRecord{}, os.ErrNotExist
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ar := range m.active {
+		if ar.rec.Name == name {
+			return runRecord{}, errRunActive
+		}
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return runRecord{}, err
+	}
+	now := time.Now()
+	base := name + "-" + now.Format(logBackupLayout)
+	logName := base + ".log"
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(m.dir, logName)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		logName = base + "-" + strconv.Itoa(i) + ".log"
+	}
+	f, err := os.OpenFile(filepath.Join(m.dir, logName), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return runRecord{}, err
+	}
+
+	m.nextID++
+	rec := &runRecord{
+		ID:      m.nextID,
+		Name:    name,
+		Command: cmdDef.Command,
+		Log:     filepath.ToSlash(filepath.Join(m.relDir, logName)),
+		Status:  "running",
+		Started: now.Format(time.RFC3339),
+	}
+	workDir := m.root
+	if cmdDef.Dir != "" {
+		workDir = filepath.Join(m.root, filepath.FromSlash(cmdDef.Dir))
+	}
+	fmt.Fprintf(f, "=== run #%d %s: %s (in %s, started %s)\n", rec.ID, name, cmdDef.Command, displayDir(cmdDef.Dir), rec.Started)
+
+	var ctx context.Context
+	var stop context.CancelFunc
+	if cmdDef.timeout > 0 {
+		ctx, stop = context.WithTimeout(context.Background(), cmdDef.timeout)
+	} else {
+		ctx, stop = context.WithCancel(context.Background())
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", cmdDef.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", cmdDef.Command)
+	}
+	cmd.Dir = workDir
+	cmd.Stdout, cmd.Stderr = f, f
+	cmd.Env = append(os.Environ(), "MDVIEWER_RUN_ID="+strconv.FormatInt(rec.ID, 10), "MDVIEWER_RUN_LOG="+filepath.Join(m.dir, logName))
+	cmd.WaitDelay = runStopGrace
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		stop()
+		fmt.Fprintf(f, "=== failed to start: %v\n", err)
+		f.Close()
+		rec.Status, rec.Error, rec.Finished = "failed", err.Error(), time.Now().Format(time.RFC3339)
+		m.history = append(m.history, rec)
+		m.saveHistory()
+		return *rec, nil
+	}
+	ar := &activeRun{rec: rec, cancel: stop}
+	m.active[rec.ID] = ar
+	m.history = append(m.history, rec)
+	m.saveHistory()
+	log.Printf("[runs] #%d %s started: %s", rec.ID, name, cmdDef.Command)
+
+	go func() {
+		err := cmd.Wait()
+		elapsed := time.Since(now)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		stop()
+		delete(m.active, rec.ID)
+		rec.Finished = time.Now().Format(time.RFC3339)
+		rec.DurationMs = elapsed.Milliseconds()
+		if cmd.ProcessState != nil {
+			code := cmd.ProcessState.ExitCode()
+			rec.ExitCode = &code
+		}
+		switch {
+		case ar.canceled:
+			rec.Status = "canceled"
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			rec.Status = "timeout"
+		case err == nil:
+			rec.Status = "ok"
+		default:
+			rec.Status = "failed"
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				rec.Error = err.Error()
+			}
+		}
+		code := "-"
+		if rec.ExitCode != nil {
+			code = strconv.Itoa(*rec.ExitCode)
+		}
+		fmt.Fprintf(f, "=== %s (exit code %s) after %s\n", rec.Status, code, elapsed.Round(time.Millisecond))
+		f.Close()
+		m.saveHistory()
+		log.Printf("[runs] #%d %s %s (exit code %s) after %s", rec.ID, rec.Name, rec.Status, code, elapsed.Round(time.Millisecond))
+	}()
+	return *rec, nil
+}
+
+// displayDir names a working directory for the log header.
+func displayDir(rel string) string {
+	if rel == "" {
+		return "root"
+	}
+	return rel
+}
+
+// cancel stops a running run.
+func (m *runManager) cancel(id int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ar, ok := m.active[id]
+	if !ok {
+		return false
+	}
+	ar.canceled = true
+	ar.cancel()
+	return true
+}
+
+// runsResponse lists the configured commands and the history, newest first.
+type runsResponse struct {
+	Enabled  bool         `json:"enabled"`
+	Dir      string       `json:"dir"`
+	Commands []runCommand `json:"commands"`
+	Runs     []runRecord  `json:"runs"`
+}
+
+func (a *app) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := runsResponse{Commands: []runCommand{}, Runs: []runRecord{}}
+	if m := a.runs; m != nil {
+		resp.Enabled, resp.Dir, resp.Commands = true, m.relDir, m.commands
+		name := r.URL.Query().Get("name")
+		m.mu.Lock()
+		for i := len(m.history) - 1; i >= 0; i-- {
+			if name == "" || m.history[i].Name == name {
+				resp.Runs = append(resp.Runs, *m.history[i])
+			}
+		}
+		m.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// sameOrigin reports whether a request comes from mdviewer's own pages or
+// from a client that is not a browser. Browsers mark cross-site requests
+// with Sec-Fetch-Site or, in older versions, a foreign Origin, so another
+// page cannot start commands through a cross-origin POST.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func (a *app) handleRunStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	if a.runs == nil {
+		http.Error(w, "runs are disabled; start mdviewer with -runs", http.StatusForbidden)
+		return
+	}
+	rec, err := a.runs.start(r.URL.Query().Get("name"))
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			http.Error(w, "unknown command", http.StatusNotFound)
+		case errors.Is(err, errRunActive):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "failed to start run", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(rec)
+}
+
+func (a *app) handleRunCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	if a.runs == nil {
+		http.Error(w, "runs are disabled; start mdviewer with -runs", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if !a.runs.cancel(id) {
+		http.Error(w, "run is not active", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+func (a *app) handleRunsPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, runsHTML)
+}
+
+const runsHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8"/>
+<meta name="viewport" content="width=device-width,initial-scale=1"/>
+<title>Runs – Markdown Viewer</title>
+<style>
+:root{--bg:#0d1117;--panel:#161b22;--border:#30363d;--text:#c9d1d9;--muted:#8b949e;--link:#58a6ff;--button-bg:#21262d;--button-hover:#30363d;--card-bg:#161b22;--card-border:#21262d;--success:#3fb950;--warn:#d29922;--danger:#f85149}
+@media(prefers-color-scheme:light){:root{--bg:#f6f8fa;--panel:#ffffff;--border:#d0d7de;--text:#1f2328;--muted:#656d76;--link:#0969da;--button-bg:#e8e8e8;--button-hover:#d0d7de;--card-bg:#ffffff;--card-border:#d0d7de;--success:#1a7f37;--warn:#9a6700;--danger:#cf222e}}
+*{box-sizing:border-box;margin:0;padding:0}
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;background:var(--bg);color:var(--text);min-height:100vh}
+.header{padding:16px;display:flex;align-items:center;gap:12px;border-bottom:1px solid var(--border);background:var(--panel);position:sticky;top:0;z-index:10}
+.header h1{font-size:1.2em;flex:1}
+.header a{color:var(--link);text-decoration:none;font-size:0.9em}
+.content{padding:8px 16px;max-width:1100px}
+.section-header{font-size:0.85em;font-weight:600;color:var(--muted);padding:16px 0 8px;text-transform:uppercase;letter-spacing:0.5px}
+.card{display:flex;align-items:center;gap:12px;padding:10px 12px;margin:6px 0;border-radius:10px;background:var(--card-bg);border:1px solid var(--card-border)}
+.card .info{flex:1;min-width:0}
+.card .name{font-weight:600}
+.card .cmd{font-family:ui-monospace,SFMono-Regular,Menlo,monospace;font-size:0.8em;color:var(--muted);white-space:nowrap;overflow:hidden;text-overflow:ellipsis}
+.btn{padding:6px 12px;border:1px solid var(--border);background:var(--button-bg);color:var(--text);border-radius:6px;cursor:pointer;font-size:0.85em;text-decoration:none;white-space:nowrap}
+.btn:hover{background:var(--button-hover)}
+.btn.primary{background:#238636;border-color:#238636;color:#fff}
+.btn:disabled{opacity:0.5;cursor:default}
+table{width:100%;border-collapse:collapse;font-size:0.85em}
+th,td{text-align:left;padding:6px 8px;border-bottom:1px solid var(--border);white-space:nowrap}
+th{color:var(--muted);font-weight:600}
+td.actions{display:flex;gap:6px}
+.status{font-weight:600}
+.status.running{color:var(--link)}
+.status.ok{color:var(--success)}
+.status.failed,.status.timeout{color:var(--danger)}
+.status.canceled,.status.interrupted{color:var(--warn)}
+.empty{color:var(--muted);padding:12px 0;font-size:0.9em}
+.error{color:var(--danger);font-size:0.85em;padding:8px 0}
+</style>
+</head>
+<body>
+<div class="header">
+  <h1>▶ Runs</h1>
+  <a href="/">← Back</a>
+</div>
+<div class="content">
+  <div id="error" class="error"></div>
+  <div class="section-header">Commands</div>
+  <div id="commands"><div class="empty">Loading…</div></div>
+  <div class="section-header">History</div>
+  <div id="history"></div>
+</div>
+<script>
+(function(){
+  let data={enabled:false,commands:[],runs:[]};
+  let timer=null;
+
+  function esc(s){return String(s==null?'':s).replace(/[&<>"']/g,c=>({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]));}
+  function dur(ms){
+    if(ms<1000)return ms+'ms';
+    const s=ms/1000;
+    if(s<60)return s.toFixed(1)+'s';
+    const m=Math.floor(s/60);
+    return m+'m '+Math.round(s%60)+'s';
+  }
+  function logLink(run){
+    return '/?file='+encodeURIComponent(run.log)+(run.status==='running'?'&live=1':'');
+  }
+
+  async function load(){
+    try{
+      const r=await fetch('/api/runs');
+      if(!r.ok)throw new Error(await r.text());
+      data=await r.json();
+      document.getElementById('error').textContent='';
+    }catch(e){
+      document.getElementById('error').textContent='Failed to load runs: '+e.message;
+    }
+    render();
+    clearTimeout(timer);
+    timer=setTimeout(load,data.runs.some(r=>r.status==='running')?1500:10000);
+  }
+
+  function render(){
+    const cmdsEl=document.getElementById('commands');
+    const histEl=document.getElementById('history');
+    if(!data.enabled){
+      cmdsEl.innerHTML='<div class="empty">Runs are disabled. Start mdviewer with <code>-runs runs.json</code>, a JSON list of allowed commands such as <code>[{"name":"test","command":"make test"}]</code>.</div>';
+      histEl.innerHTML='';
+      return;
+    }
+    const running={};
+    data.runs.forEach(r=>{if(r.status==='running'&&!running[r.name])running[r.name]=r;});
+    cmdsEl.innerHTML=data.commands.length?data.commands.map(c=>{
+      const r=running[c.name];
+      return '<div class="card"><div class="info"><div class="name">'+esc(c.name)+'</div>'+
+        '<div class="cmd">$ '+esc(c.command)+(c.dir?' &nbsp;(in '+esc(c.dir)+')':'')+'</div></div>'+
+        (r?'<a class="btn" href="'+logLink(r)+'">Watch</a><button class="btn" data-cancel="'+r.id+'">■ Cancel</button>'
+          :'<button class="btn primary" data-run="'+esc(c.name)+'">▶ Run</button>')+'</div>';
+    }).join(''):'<div class="empty">No commands configured.</div>';
+
+    if(!data.runs.length){histEl.innerHTML='<div class="empty">No runs yet.</div>';return;}
+    let html='<table><tr><th>#</th><th>Command</th><th>Status</th><th>Exit</th><th>Started</th><th>Duration</th><th></th></tr>';
+    data.runs.forEach(r=>{
+      const ms=r.status==='running'?Date.now()-new Date(r.started).getTime():r.durationMs;
+      html+='<tr><td>'+r.id+'</td><td>'+esc(r.name)+'</td>'+
+        '<td class="status '+esc(r.status)+'" title="'+esc(r.error||'')+'">'+esc(r.status)+'</td>'+
+        '<td>'+(r.exitCode==null?'':r.exitCode)+'</td>'+
+        '<td>'+esc(new Date(r.started).toLocaleString())+'</td><td>'+dur(Math.max(ms,0))+'</td>'+
+        '<td class="actions"><a class="btn" href="'+logLink(r)+'">Open log</a>'+
+        (r.status==='running'?'<button class="btn" data-cancel="'+r.id+'">■ Cancel</button>'
+          :(data.commands.some(c=>c.name===r.name)&&!running[r.name]?'<button class="btn" data-run="'+esc(r.name)+'">↻ Re-run</button>':''))+
+        '</td></tr>';
+    });
+    histEl.innerHTML=html+'</table>';
+  }
+
+  document.addEventListener('click',async e=>{
+    const run=e.target.closest('[data-run]');
+    const cancel=e.target.closest('[data-cancel]');
+    if(!run&&!cancel)return;
+    e.target.disabled=true;
+    try{
+      const url=run?'/api/runs/start?name='+encodeURIComponent(run.dataset.run):'/api/runs/cancel?id='+cancel.dataset.cancel;
+      const r=await fetch(url,{method:'POST'});
+      if(!r.ok)throw new Error(await r.text());
+      if(run){
+        const rec=await r.json();
+        window.location.href=logLink(rec);
+        return;
+      }
+    }catch(err){
+      document.getElementById('error').textContent=err.message;
+    }
+    load();
+  });
+
+  load();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// setProcessGroup keeps exec's default cancellation, which kills the
+// process.
+func setProcessGroup(cmd *exec.Cmd) {}
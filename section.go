@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// mdSection is the byte range of one heading's section within a document,
+// from the start of the heading line up to the next heading of the same or a
+// higher level.
+type mdSection struct {
+	Heading mdHeading
+	EndLine int
+	Start   int
+	End     int
+}
+
+// findSection locates the section for anchor in content. ok is false when
+// the document has no heading with that anchor.
+func findSection(content string, doc mdDocument, anchor string) (mdSection, bool) {
+	i := findHeading(doc, anchor)
+	if i < 0 {
+		return mdSection{}, false
+	}
+	lines := strings.SplitAfter(content, "\n")
+	end := sectionEnd(doc, i, len(markdownLines(content)))
+	// lineStart(n) is the byte offset at which 1-based line n starts.
+	lineStart := func(n int) int {
+		off := 0
+		for _, l := range lines[:min(n-1, len(lines))] {
+			off += len(l)
+		}
+		return off
+	}
+	return mdSection{
+		Heading: doc.Headings[i],
+		EndLine: end,
+		Start:   lineStart(doc.Headings[i].Line),
+		End:     lineStart(end + 1),
+	}, true
+}
+
+// sectionHash identifies a version of a section's text.
+func sectionHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleSection reads (GET) or replaces (PUT) a single heading's section of
+// a markdown file. The section is addressed by its anchor, as returned by
+// /api/outline. PUT must send the hash from the GET; if the section has
+// changed since, nothing is written and 409 Conflict is returned.
+func (a *app) handleSection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	relPath, err := sanitizeRelativePath(q.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isMarkdownFile(relPath) {
+		http.Error(w, "only markdown files are supported", http.StatusBadRequest)
+		return
+	}
+	anchor := strings.TrimPrefix(strings.TrimSpace(q.Get("anchor")), "#")
+	if anchor == "" {
+		http.Error(w, "missing query parameter 'anchor'", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Hash    string `json:"hash"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Hash == "" {
+			http.Error(w, "hash is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.editMu.Lock()
+	defer a.editMu.Unlock()
+
+	content, doc, err := readMarkdownDocument(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	// Under -redact clients see the anchors of masked headings.
+	if i := findHeading(a.redact.redactHeadings(content, doc), anchor); i >= 0 {
+		anchor = doc.Headings[i].Slug
+	}
+	sec, ok := findSection(content, doc, anchor)
+	if !ok {
+		http.Error(w, "section not found", http.StatusNotFound)
+		return
+	}
+	text := content[sec.Start:sec.End]
+
+	if r.Method == http.MethodPut {
+		if req.Hash != sectionHash(text) {
+			http.Error(w, "section has changed since it was read", http.StatusConflict)
+			return
+		}
+		if a.redact.matches([]byte(text)) {
+			http.Error(w, errRedacted.Error(), http.StatusConflict)
+			return
+		}
+		text = req.Content
+		if sec.End < len(content) && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		content = content[:sec.Start] + text + content[sec.End:]
+		if err := writeFileKeepMode(fullPath, []byte(content)); err != nil {
+			http.Error(w, "failed to write file", http.StatusInternalServerError)
+			return
+		}
+		sec.EndLine = sec.Heading.Line + len(markdownLines(text)) - 1
+	}
+	// The new text may have renamed the heading; report it as written, and
+	// as masked.
+	for _, h := range a.redact.redactHeadings(content, parseMarkdown(content)).Headings {
+		if h.Line == sec.Heading.Line {
+			sec.Heading = h
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Path    string `json:"path"`
+		Anchor  string `json:"anchor"`
+		Heading string `json:"heading"`
+		Level   int    `json:"level"`
+		Line    int    `json:"line"`
+		EndLine int    `json:"endLine"`
+		Content string `json:"content"`
+		Hash    string `json:"hash"`
+	}{
+		Path:    relPath,
+		Anchor:  sec.Heading.Slug,
+		Heading: sec.Heading.Text,
+		Level:   sec.Heading.Level,
+		Line:    sec.Heading.Line,
+		EndLine: sec.EndLine,
+		Content: a.redact.redactString(text),
+		Hash:    sectionHash(text),
+	})
+}
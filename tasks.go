@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// taskItem is a GFM task list item found in a markdown file, with the
+// heading it appears under and any inline metadata.
+type taskItem struct {
+	File    string            `json:"file"`
+	Line    int               `json:"line"`
+	Text    string            `json:"text"`
+	Checked bool              `json:"checked"`
+	Heading string            `json:"heading,omitempty"`
+	Anchor  string            `json:"anchor,omitempty"`
+	Due     string            `json:"due,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+var (
+	// taskMetaRe matches inline metadata such as @due(2026-10-20) or @owner(ana).
+	taskMetaRe = regexp.MustCompile(`@([A-Za-z][\w-]*)\(([^()]*)\)`)
+	// taskTagRe matches #tags; a tag must start with a letter so issue
+	// references like #123 are not treated as tags.
+	taskTagRe = regexp.MustCompile(`(?:^|\s)#(\p{L}[\p{L}\p{N}_/-]*)`)
+)
+
+// newTaskItem builds a taskItem for a task found in the markdown file rel.
+func newTaskItem(rel string, doc mdDocument, t mdTask) taskItem {
+	item := taskItem{File: rel, Line: t.Line, Text: t.Text, Checked: t.Checked}
+	if t.Heading >= 0 {
+		item.Heading = doc.Headings[t.Heading].Text
+		item.Anchor = doc.Headings[t.Heading].Slug
+	}
+	for _, m := range taskMetaRe.FindAllStringSubmatch(maskCodeSpans(t.Text), -1) {
+		key, val := strings.ToLower(m[1]), strings.TrimSpace(m[2])
+		if item.Meta == nil {
+			item.Meta = make(map[string]string)
+		}
+		item.Meta[key] = val
+		if key == "due" {
+			item.Due = val
+		}
+	}
+	for _, m := range taskTagRe.FindAllStringSubmatch(maskCodeSpans(t.Text), -1) {
+		item.Tags = append(item.Tags, m[1])
+	}
+	return item
+}
+
+// redacted returns the task with secrets in its text and metadata masked.
+// Headings are masked by building the item from rd.redactHeadings.
+func (t taskItem) redacted(rd *redactor) taskItem {
+	if rd == nil {
+		return t
+	}
+	t.Text = rd.redactString(t.Text)
+	if t.Meta != nil {
+		meta := make(map[string]string, len(t.Meta))
+		for k, v := range t.Meta {
+			meta[k] = rd.redactField(k, v)
+		}
+		t.Meta = meta
+	}
+	return t
+}
+
+// collectTasks returns every task item in the markdown files under root,
+// restricted to the file or folder only when it is non-empty. Items are
+// masked with rd.
+func collectTasks(root, only string, rd *redactor) ([]taskItem, error) {
+	tasks := []taskItem{}
+	err := walkMarkdownFiles(root, func(rel, fullPath string) error {
+		if only != "" && rel != only && !strings.HasPrefix(rel, only+"/") {
+			return nil
+		}
+		content, doc, err := readMarkdownDocument(fullPath)
+		if err != nil {
+			return nil
+		}
+		if len(doc.Tasks) > 0 {
+			doc = rd.redactHeadings(content, doc)
+		}
+		for _, t := range doc.Tasks {
+			tasks = append(tasks, newTaskItem(rel, doc, t).redacted(rd))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].File != tasks[j].File {
+			return tasks[i].File < tasks[j].File
+		}
+		return tasks[i].Line < tasks[j].Line
+	})
+	return tasks, nil
+}
+
+// handleTasks lists task items across all notes. Optional query parameters:
+// path (file or folder), status ("open" or "done") and tag.
+func (a *app) handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	only := ""
+	if raw := q.Get("path"); raw != "" {
+		relPath, err := sanitizeRelativePath(raw)
+		if err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		only = relPath
+	}
+	status := q.Get("status")
+	if status != "" && status != "open" && status != "done" {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(q.Get("tag")), "#")
+
+	all, err := collectTasks(a.root, only, a.redact)
+	if err != nil {
+		http.Error(w, "failed to collect tasks", http.StatusInternalServerError)
+		return
+	}
+	tasks := make([]taskItem, 0, len(all))
+	for _, t := range all {
+		if (status == "open" && t.Checked) || (status == "done" && !t.Checked) {
+			continue
+		}
+		if tag != "" {
+			found := false
+			for _, tt := range t.Tags {
+				if strings.EqualFold(tt, tag) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		tasks = append(tasks, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		Tasks []taskItem `json:"tasks"`
+	}{Tasks: tasks})
+}
+
+// handleTaskToggle sets or flips the checkbox of one task item in place.
+// The request names the task by line number and must also send the task's
+// text as last read; if the line is no longer that task the file is left
+// untouched and 409 Conflict is returned.
+func (a *app) handleTaskToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Path    string `json:"path"`
+		Line    int    `json:"line"`
+		Text    string `json:"text"`
+		Checked *bool  `json:"checked"` // desired state; omitted flips it
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	relPath, err := sanitizeRelativePath(req.Path)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	if !isMarkdownFile(relPath) {
+		http.Error(w, "only markdown files are supported", http.StatusBadRequest)
+		return
+	}
+	if req.Line < 1 {
+		http.Error(w, "invalid line", http.StatusBadRequest)
+		return
+	}
+	fullPath, err := secureJoin(a.root, relPath)
+	if err != nil {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+
+	a.editMu.Lock()
+	defer a.editMu.Unlock()
+
+	content, doc, err := readMarkdownDocument(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	idx := -1
+	for i, t := range doc.Tasks {
+		if t.Line == req.Line {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		http.Error(w, "line is not a task item", http.StatusConflict)
+		return
+	}
+	task := doc.Tasks[idx]
+	// Clients only saw the masked text.
+	if task.Text != req.Text && a.redact.redactString(task.Text) != req.Text {
+		http.Error(w, "task has changed since it was read", http.StatusConflict)
+		return
+	}
+
+	checked := !task.Checked
+	if req.Checked != nil {
+		checked = *req.Checked
+	}
+	if checked != task.Checked {
+		box := " "
+		if checked {
+			box = "x"
+		}
+		content = content[:task.Box] + box + content[task.Box+1:]
+		if err := writeFileKeepMode(fullPath, []byte(content)); err != nil {
+			http.Error(w, "failed to write file", http.StatusInternalServerError)
+			return
+		}
+		task.Checked = checked
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(struct {
+		OK   bool     `json:"ok"`
+		Task taskItem `json:"task"`
+	}{OK: true, Task: newTaskItem(relPath, a.redact.redactHeadings(content, doc), task).redacted(a.redact)})
+}